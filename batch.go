@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// batchDB is the database given to the step functions by UpN. All the transactions
+// started by the step functions are the batch transaction which is finalized by UpN.
+type batchDB struct {
+	SQLDB
+	tx  SQLTx // tx is the batch transaction.
+	err error // err is the first error of a finalized step transaction.
+}
+
+// batchTx is the batch transaction as seen by a step function.
+type batchTx struct {
+	db *batchDB
+}
+
+func (tx batchTx) Tx() *sql.Tx {
+	return tx.db.tx.Tx()
+}
+
+// FinalizeTransaction records the error of the step so that the batch transaction is
+// rolled back, even when the step function ignores it like with ErrCancel.
+func (tx batchTx) FinalizeTransaction(err *error, dryRun bool) {
+	if *err != nil && tx.db.err == nil {
+		tx.db.err = *err
+	}
+}
+
+func (tx batchTx) now() time.Time {
+	return txNow(tx.db.tx)
+}
+
+func (db *batchDB) StartTransaction(ctx context.Context, opts *sql.TxOptions) (SQLTx, error) {
+	return batchTx{db: db}, nil
+}
+
+func (db *batchDB) Version(ctx context.Context) (Version, error) {
+	return db.VersionTx(db.tx)
+}
+
+func (db *batchDB) DefaultStepFunc(ctx context.Context, info StepInfo, dryRun bool, log Logger) error {
+	if log.Level() >= LevelDebug {
+		log.Debug("nil migration step", F("name", info.Name()), F("from", info.From()), F("to", info.To()))
+	}
+	return db.SetVersion(ctx, info, dryRun, log)
+}
+
+func (db *batchDB) SetVersion(ctx context.Context, info StepInfo, dryRun bool, log Logger) error {
+	return db.SetVersionTx(db.tx, info, dryRun, log)
+}
+
+// UpN executes the n next migration steps up in a single transaction.
+func (m *Migrator) UpN(n int) error {
+	return m.UpNCtx(context.Background(), n)
+}
+
+// UpNCtx executes the n next migration steps up in a single transaction that is committed
+// after the last step. The database version is changed after each step in the transaction.
+// When a step fails, or less than n steps remain, the transaction is rolled back and the
+// database version is unchanged. The locker, if any, is held during the whole run.
+//
+// The database must be an SQLDB and the transaction is serializable. The isolation level
+// set with Isolation is ignored. The NoTx and NoTxF step functions fail with
+// ErrNoTxInBatch as their SQL commands can't be executed in the transaction.
+func (m *Migrator) UpNCtx(ctx context.Context, n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return m.setLastError(fmt.Errorf("up n: %w", err))
+	}
+	return m.setLastError(unlock(m.upN(ctx, n)))
+}
+
+// upN executes n migration steps up in a single transaction. It requires that the
+// migrator is locked.
+func (m *Migrator) upN(ctx context.Context, n int) (err error) {
+	if n <= 0 {
+		return fmt.Errorf("up n: %w: n is %d", ErrBadParameters, n)
+	}
+	db, ok := m.db.(SQLDB)
+	if !ok {
+		return fmt.Errorf("up n: %w", ErrNotSQLDB)
+	}
+	start, override := m.cachedVersion, m.override
+	defer func() {
+		m.db = db
+		if err != nil {
+			m.cachedVersion, m.override = start, override
+			err = fmt.Errorf("up n: %w", err)
+		}
+	}()
+	tx, err := db.StartTransaction(m.withClock(ctx), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer FinalizeTransactionCtx(ctx, tx, &err, false)
+
+	batch := &batchDB{SQLDB: db, tx: tx}
+	m.db = batch
+	for range n {
+		if err = m.oneUp(ctx, false); err != nil {
+			return err
+		}
+		if batch.err != nil {
+			return batch.err
+		}
+	}
+	return nil
+}
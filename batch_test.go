@@ -0,0 +1,29 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMigratorUpNErrors(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	m, err := New(db, &mockStepper{[]StepFunc{nil, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpN(0); !errors.Is(err, ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", ErrBadParameters, err)
+	}
+	if err := m.UpN(1); !errors.Is(err, ErrNotSQLDB) {
+		t.Fatalf("expect %v, got %v", ErrNotSQLDB, err)
+	}
+	if db.version.ID != 0 {
+		t.Fatalf("expect v0, got %v", db.version)
+	}
+	if !errors.Is(m.LastError(), ErrNotSQLDB) {
+		t.Fatalf("expect last error %v, got %v", ErrNotSQLDB, m.LastError())
+	}
+}
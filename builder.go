@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Builder builds a sequence of migration steps with a fluent API. The errors are
+// collected and returned by Build.
+//
+//	steps, err := migrate.NewBuilder("example database").
+//		Up("create table", migrate.Cmd(`CREATE TABLE "example" ("id" INTEGER PRIMARY KEY)`)).
+//		Down(migrate.Cmd(`DROP TABLE "example"`)).
+//		Build()
+type Builder struct {
+	mu    sync.Mutex
+	name  string
+	steps []step
+	errs  []error
+}
+
+// NewBuilder returns a builder of migration steps. The name is the one given to NewSteps.
+func NewBuilder(name string) *Builder {
+	return &Builder{name: name}
+}
+
+// Up appends a step executing the SQL commands with Tx.
+func (b *Builder) Up(name string, cmds ...SQLCommand) *Builder {
+	return b.UpFunc(name, Tx(cmds...))
+}
+
+// UpFunc appends a step executing the step function f, which may be nil.
+func (b *Builder) UpFunc(name string, f StepFunc) *Builder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.steps = append(b.steps, step{name: name, up: f})
+	return b
+}
+
+// Down sets the down function of the last appended step to execute the SQL commands
+// with Tx.
+func (b *Builder) Down(cmds ...SQLCommand) *Builder {
+	return b.DownFunc(Tx(cmds...))
+}
+
+// DownFunc sets the down function of the last appended step to f.
+func (b *Builder) DownFunc(f StepFunc) *Builder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case len(b.steps) == 0:
+		b.errs = append(b.errs, fmt.Errorf("down without step"))
+	case b.steps[len(b.steps)-1].down != nil:
+		b.errs = append(b.errs, fmt.Errorf("down already set for step %d '%s'", len(b.steps), b.steps[len(b.steps)-1].name))
+	default:
+		b.steps[len(b.steps)-1].down = f
+	}
+	return b
+}
+
+// Build returns the migration steps, or all the errors found while building them as
+// a joined error.
+func (b *Builder) Build() (*Steps, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	errs := b.errs
+	s := NewSteps(b.name)
+	for _, st := range b.steps {
+		if err := s.Append(st.name, st.up, st.down); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("build steps: %w", errors.Join(errs...))
+	}
+	return s, nil
+}
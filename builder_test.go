@@ -0,0 +1,77 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	s, err := NewBuilder("test").
+		Up("create table", Cmd(`CREATE TABLE "test" ("id" INTEGER)`)).
+		Down(Cmd(`DROP TABLE "test"`)).
+		UpFunc("nil step", nil).
+		Up("irreversible step").
+		DownFunc(Irreversible).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := NewSteps("test")
+	exp.Append("create table", nil, nil)
+	exp.Append("nil step", nil, nil)
+	exp.Append("irreversible step", nil, nil)
+	if s.Len() != exp.Len() {
+		t.Fatalf("expect %d steps, got %d", exp.Len(), s.Len())
+	}
+	for ID := range exp.Len() {
+		v, _ := s.Version(ID)
+		ev, _ := exp.Version(ID)
+		if v != ev {
+			t.Fatalf("step %d: expect %v, got %v", ID, ev, v)
+		}
+	}
+	if s.steps[1].up == nil || s.steps[1].down == nil || s.steps[2].up != nil || s.steps[2].down != nil {
+		t.Fatal("unexpected step functions")
+	}
+
+	_, err = NewBuilder("test").
+		Down(Cmd(`DROP TABLE "test"`)).
+		Up("", Cmd(`CREATE TABLE "test" ("id" INTEGER)`)).
+		Up("step", Cmd(`CREATE TABLE "test" ("id" INTEGER)`)).
+		Down().
+		Down().
+		Build()
+	if err == nil {
+		t.Fatal("expect error")
+	}
+	for _, msg := range []string{"down without step", "name is empty", "down already set for step 2 'step'"} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expect %q in %q", msg, err)
+		}
+	}
+	if errors.Unwrap(err) == nil {
+		t.Errorf("expect wrapped errors")
+	}
+}
+
+func TestBuilderConcurrency(t *testing.T) {
+	b := NewBuilder("test")
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.UpFunc("step", nil)
+		}()
+	}
+	wg.Wait()
+	s, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 11 {
+		t.Fatalf("expect 11 steps, got %d", s.Len())
+	}
+}
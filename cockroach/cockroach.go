@@ -0,0 +1,333 @@
+// Package cockroach provides the migration support for CockroachDB databases.
+//
+// CockroachDB runs the transactions with the serializable isolation level and returns
+// serialization failures, with the SQLSTATE 40001, that must be retried by the client.
+// The Tx and TxF step functions of this package retry their transaction with the
+// savepoint cockroach_restart as recommended by CockroachDB.
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chmike/migrate"
+
+	_ "github.com/lib/pq"
+)
+
+// NewSteps instantiates a new migration step sequence. The name should not be
+// empty and ideally unique to the database as it is used to compute the root
+// checksum identifying the database.
+func NewSteps(name string) *migrate.Steps {
+	return migrate.NewSteps(name)
+}
+
+// NewStepsWith instantiates a new migration step sequence using the checksum function
+// fn. Changing the checksum function invalidates the version stored in the database.
+func NewStepsWith(name string, fn migrate.ChecksumFunc) *migrate.Steps {
+	return migrate.NewStepsWith(name, fn)
+}
+
+func init() {
+	migrate.Register("cockroachdb", func(url string) (migrate.SQLDB, error) {
+		return Open("postgresql" + strings.TrimPrefix(url, "cockroachdb"))
+	})
+}
+
+// defaultRetries is the default number of retries of a transaction.
+const defaultRetries = 10
+
+type config struct {
+	tableName       string
+	schema          string
+	history         bool
+	retries         int
+	connectAttempts int
+	connectBackoff  time.Duration
+}
+
+// Option function.
+type Option func(*config)
+
+// WithTableName changes the default version table name.
+func WithTableName(tableName string) Option {
+	return func(c *config) {
+		c.tableName = tableName
+	}
+}
+
+// WithSchema sets the schema of the version table. The search path of the
+// connection is used by default.
+func WithSchema(schema string) Option {
+	return func(c *config) {
+		c.schema = schema
+	}
+}
+
+// WithHistory records each change of the version in a history table created by Init.
+// The history table is named after the version table with its _version suffix replaced
+// by _history, like migrate_history.
+func WithHistory() Option {
+	return func(c *config) {
+		c.history = true
+	}
+}
+
+// WithRetries sets the maximum number of retries of the transaction of the Tx and TxF
+// step functions failing with a serialization failure. The default is 10.
+func WithRetries(retries int) Option {
+	return func(c *config) {
+		c.retries = retries
+	}
+}
+
+// WithConnectRetry makes Open try to connect to the database at most attempts times,
+// waiting backoff after the first failure and doubling the waiting time after each
+// following failure. It allows to wait for a database that is not yet ready.
+func WithConnectRetry(attempts int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.connectAttempts = attempts
+		c.connectBackoff = backoff
+	}
+}
+
+// validName matches a valid unquoted CockroachDB identifier.
+var validName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,62}$`)
+
+// driverName is the name of the sql driver.
+var driverName = "postgres"
+
+// Open opens a CockroachDB database with the given data source name, like
+// postgresql://user@host:26257/name?sslmode=verify-full.
+func Open(dsn string, options ...Option) (migrate.SQLDB, error) {
+	c := config{tableName: "migrate_version", retries: defaultRetries}
+	for _, option := range options {
+		option(&c)
+	}
+	if !validName.MatchString(c.tableName) {
+		return nil, fmt.Errorf("new cockroach: invalid table name '%s'", c.tableName)
+	}
+	if c.schema != "" && !validName.MatchString(c.schema) {
+		return nil, fmt.Errorf("new cockroach: invalid schema name '%s'", c.schema)
+	}
+	if c.retries < 0 {
+		return nil, fmt.Errorf("new cockroach: %w: negative retries %d", migrate.ErrBadParameters, c.retries)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate.ConnectRetry(c.connectAttempts, c.connectBackoff, db.Ping); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &crdbDB{SQLDB: migrate.NewSQLDB(db, queries(c)), retries: c.retries}, nil
+}
+
+// queries returns the CockroachDB queries for the configured version table.
+func queries(c config) *migrate.Queries {
+	table := `"` + c.tableName + `"`
+	history := `"` + strings.TrimSuffix(c.tableName, "_version") + `_history"`
+	if c.schema != "" {
+		table = `"` + c.schema + `".` + table
+		history = `"` + c.schema + `".` + history
+	}
+	q := &migrate.Queries{
+		CreateTableQuery: `CREATE TABLE IF NOT EXISTS ` + table + ` ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+		InitTableQuery:   `INSERT INTO ` + table + ` ("id", "checksum") VALUES ($1, $2)`,
+		VersionQuery:     `SELECT "id", "checksum" FROM ` + table + ` LIMIT 1`,
+		SetVersionQuery:  `UPDATE ` + table + ` SET "id" = $1, "checksum" = $2 WHERE "id" = $3 AND "checksum" = $4`,
+		TransactionalDDL: true,
+	}
+	if c.history {
+		q.CreateHistoryQuery = `CREATE TABLE IF NOT EXISTS ` + history + ` ("id" INT8 NOT NULL DEFAULT unique_rowid() PRIMARY KEY, "from_id" INTEGER NOT NULL, "to_id" INTEGER NOT NULL, "name" TEXT NOT NULL, "applied_at" TIMESTAMPTZ NOT NULL, "dry_run" BOOLEAN NOT NULL)`
+		q.InsertHistoryQuery = `INSERT INTO ` + history + ` ("from_id", "to_id", "name", "applied_at", "dry_run") VALUES ($1, $2, $3, $4, $5)`
+		q.HistoryQuery = `SELECT "id", "from_id", "to_id", "name", "applied_at", "dry_run" FROM ` + history + ` ORDER BY "id"`
+	}
+	return q
+}
+
+// crdbDB is an SQLDB whose nil step functions change the version in a retried
+// transaction.
+type crdbDB struct {
+	migrate.SQLDB
+	retries int // retries is the maximum number of retries of a transaction.
+}
+
+// DefaultStepFunc is called when the step function is nil. It sets the version to
+// info.To() in a transaction retried on serialization failures.
+func (db *crdbDB) DefaultStepFunc(ctx context.Context, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+	if log.Level() >= migrate.LevelDebug {
+		log.Debug("nil migration step", migrate.F("name", info.Name()), migrate.F("from", info.From()), migrate.F("to", info.To()))
+	}
+	return TxF()(ctx, db, info, dryRun, log)
+}
+
+// IsRetryable returns true when err is a serialization failure with the SQLSTATE 40001
+// after which the transaction must be retried.
+func IsRetryable(err error) bool {
+	var sqlErr interface{ SQLState() string }
+	return errors.As(err, &sqlErr) && sqlErr.SQLState() == "40001"
+}
+
+// New returns a new migrator.
+func NewMigrator(db migrate.SQLDB, s migrate.Stepper, l migrate.Logger, options ...migrate.Option) (*Migrator, error) {
+	return migrate.New(db, s, l, options...)
+}
+
+// Cmd is a function simplifying the creation of a Command.
+func Cmd(cmd string, args ...any) migrate.SQLCommand {
+	return migrate.SQLCommand{Cmd: cmd, Args: args}
+}
+
+// Tx returns a migration step function that executes all the SQL commands in
+// sequence wrapped in a transaction. The execution stops and rolls back as soon
+// as an error is returned by one of the commands. It is also rolled back when dryRun
+// is true. The transaction is retried on serialization failures like with TxF.
+func Tx(cmds ...migrate.SQLCommand) migrate.StepFunc {
+	return TxF(func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error {
+		return migrate.ExecTx(tx, log, cmds...)
+	})
+}
+
+// TxFunc is an migrate.TxFunc.
+type TxFunc = migrate.TxFunc
+
+// TxF returns a migration step function that executes all the user provided functions in
+// sequence wrapped in a serializable transaction. The execution stops and rolls back as
+// soon as an error is returned by one of the function and the step function returns the
+// error. The pseudo errors ErrAbort and ErrCancel are handled as with migrate.TxF.
+//
+// The work of the transaction is done after the savepoint cockroach_restart. When it
+// fails with a serialization failure, the transaction is rolled back to the savepoint and
+// the database version is checked again before executing the functions again. The
+// functions must thus be repeatable. The number of retries is set with WithRetries.
+func TxF(fs ...TxFunc) StepFunc {
+	return migrate.RegisterStepKind(func(ctx context.Context, gdb migrate.Database, info migrate.StepInfo, dryRun bool, log migrate.Logger) (err error) {
+		db, ok := gdb.(migrate.SQLDB)
+		if !ok {
+			return fmt.Errorf("cockroach txf: %w", migrate.ErrNotSQLDB)
+		}
+		retries := defaultRetries
+		if cdb, ok := gdb.(*crdbDB); ok {
+			retries = cdb.retries
+		}
+		defer func() {
+			if err != nil {
+				log.Error("tx sql command", migrate.F("name", info.Name()), migrate.F("from", info.From()), migrate.F("to", info.To()), migrate.F("error", err.Error()))
+			}
+		}()
+		defer func() {
+			if err != nil {
+				if errors.Is(err, migrate.ErrCancel) {
+					err = nil
+				} else if dryRun {
+					err = fmt.Errorf("cockroach txf %v -> %v dry run: %w", info.From(), info.To(), err)
+				} else {
+					err = fmt.Errorf("cockroach txf %v -> %v: %w", info.From(), info.To(), err)
+				}
+			}
+		}()
+
+		tx, err := db.StartTransaction(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			return err
+		}
+		defer migrate.FinalizeTransactionCtx(ctx, tx, &err, dryRun)
+
+		if _, err = tx.Tx().ExecContext(ctx, "SAVEPOINT cockroach_restart"); err != nil {
+			return err
+		}
+		for retry := 0; ; retry++ {
+			err = attempt(ctx, db, tx, info, dryRun, log, fs)
+			if err == nil || retry >= retries || !IsRetryable(err) {
+				break
+			}
+			log.Warn("retry transaction", migrate.F("name", info.Name()), migrate.F("retry", retry+1), migrate.F("error", err.Error()))
+			if _, rerr := tx.Tx().ExecContext(ctx, "ROLLBACK TO SAVEPOINT cockroach_restart"); rerr != nil {
+				return fmt.Errorf("%w; rollback to savepoint: %w", err, rerr)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		log.Info("migrate step", migrate.F("name", info.Name()), migrate.F("from", info.From()), migrate.F("to", info.To()), migrate.F("dryRun", dryRun))
+		return nil
+	}, migrate.StepTx)
+}
+
+// attempt executes the work of the transaction of TxF after the savepoint. The savepoint
+// is released, which commits the work, unless dryRun is true.
+func attempt(ctx context.Context, db migrate.SQLDB, tx SQLTx, info StepInfo, dryRun bool, log Logger, fs []TxFunc) error {
+	dbv, err := db.VersionTx(tx)
+	if err != nil {
+		return err
+	}
+	if err := migrate.CheckFrom(dbv, info); err != nil {
+		return err
+	}
+
+	if log.Level() >= migrate.LevelDebug {
+		log.Debug("tx func commands", migrate.F("count", len(fs)))
+	}
+	var cancel bool
+	for _, f := range fs {
+		if err := f(tx, info, dryRun, log); err != nil {
+			if !errors.Is(err, migrate.ErrCancel) {
+				return err
+			}
+			cancel = true
+		}
+	}
+	if cancel {
+		return migrate.ErrCancel
+	}
+
+	if err := db.SetVersionTx(tx, info, dryRun, log); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	_, err = tx.Tx().ExecContext(ctx, "RELEASE SAVEPOINT cockroach_restart")
+	return err
+}
+
+// NoTx returns a migration step function that executes the SQL commands in sequence
+// without a wrapping transaction. It terminates as soon as a command returns an error.
+// It doesn't execute any cmds when dryRun is true, unless in a deep dry run.
+func NoTx(cmds ...migrate.SQLCommand) StepFunc {
+	return migrate.NoTx(cmds...)
+}
+
+// NoTxFunc is an migrate.NoTxFunc.
+type NoTxFunc = migrate.NoTxFunc
+
+// NoTxF returns a migration step function that executes the user provided functions in sequence
+// without a wrapping transaction. It terminates as soon as a function returns an error.
+// It doesn't execute any function when dryRun is true. The pseudo error ErrCancel is
+// treated as ErrAbort as operations can't be cancelled and database version remains v1.
+// The pseudo error ErrSkip skips the remaining functions and still changes the version.
+//
+// Use with care as any error in the function may leave the database is an undefined state.
+func NoTxF(fs ...NoTxFunc) migrate.StepFunc {
+	return migrate.NoTxF(fs...)
+}
+
+// ExecTx executes the SQL commands in sequence in the transaction tx and logs them at the
+// debug level like Tx. It is intended to be called by a TxFunc.
+func ExecTx(tx SQLTx, log Logger, cmds ...migrate.SQLCommand) error {
+	return migrate.ExecTx(tx, log, cmds...)
+}
+
+// ExecNoTx executes the SQL commands in sequence without a transaction and logs them at
+// the debug level like NoTx. It is intended to be called by a NoTxFunc.
+func ExecNoTx(ctx context.Context, db SQLDB, log Logger, cmds ...migrate.SQLCommand) error {
+	return migrate.ExecNoTx(ctx, db, log, cmds...)
+}
@@ -0,0 +1,200 @@
+package cockroach
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chmike/migrate"
+)
+
+func init() {
+	driverName = "sqlmock"
+}
+
+// newMock returns a mocked database registered with the given data source name.
+func newMock(t *testing.T, dsn string) sqlmock.Sqlmock {
+	mockDB, mock, err := sqlmock.NewWithDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	return mock
+}
+
+// sqlStateError is an error with an SQLSTATE code like the errors of the drivers.
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sql state " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+const restartErr = sqlStateError("40001")
+
+func TestCockroachOpenErrors(t *testing.T) {
+	if _, err := Open("dsn", WithTableName("table with space")); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("dsn", WithSchema("schema.name")); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("dsn", WithRetries(-1)); !errors.Is(err, migrate.ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", migrate.ErrBadParameters, err)
+	}
+	if _, err := Open("unknown dsn"); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("unknown dsn", WithConnectRetry(3, time.Millisecond)); err == nil || !strings.Contains(err.Error(), "3 times") {
+		t.Fatalf("expect connect error, got %v", err)
+	}
+}
+
+func TestCockroachQueries(t *testing.T) {
+	newMock(t, "queries")
+
+	db, err := Open("queries", WithTableName("temp_version"), WithSchema("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := migrate.Queries{
+		CreateTableQuery: `CREATE TABLE IF NOT EXISTS "app"."temp_version" ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+		InitTableQuery:   `INSERT INTO "app"."temp_version" ("id", "checksum") VALUES ($1, $2)`,
+		VersionQuery:     `SELECT "id", "checksum" FROM "app"."temp_version" LIMIT 1`,
+		SetVersionQuery:  `UPDATE "app"."temp_version" SET "id" = $1, "checksum" = $2 WHERE "id" = $3 AND "checksum" = $4`,
+		TransactionalDDL: true,
+	}
+	if *db.Queries() != exp {
+		t.Fatalf("expect %+v, got %+v", exp, *db.Queries())
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	if !IsRetryable(restartErr) {
+		t.Fatal("expect retryable")
+	}
+	if !IsRetryable(fmt.Errorf("%w: %w", migrate.ErrNotInitialized, restartErr)) {
+		t.Fatal("expect wrapped error to be retryable")
+	}
+	if IsRetryable(sqlStateError("42P01")) || IsRetryable(errors.New("40001")) || IsRetryable(nil) {
+		t.Fatal("expect not retryable")
+	}
+}
+
+func TestTxRetry(t *testing.T) {
+	mock := newMock(t, "retry")
+	db, err := Open("retry", WithRetries(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+	s := NewSteps("test database")
+	s.Append("insert", Tx(Cmd(`INSERT INTO "test" ("id") VALUES (1)`)), nil)
+	v0, _ := s.Version(0)
+	v1, _ := s.Version(1)
+	info, up, err := s.Up(v0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAttempt := func(cmdErr error) {
+		mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(0, v0.ChecksumString()))
+		exec := mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "test"`))
+		if cmdErr != nil {
+			exec.WillReturnError(cmdErr)
+			return
+		}
+		exec.WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	ctx := context.Background()
+	log := migrate.NewNilLogger()
+
+	// success after a retry
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAttempt(restartErr)
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAttempt(nil)
+	mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+		WithArgs(1, v1.ChecksumString(), 0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if err := up(ctx, db, info, false, log); err != nil {
+		t.Fatal(err)
+	}
+
+	// retries exhausted
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAttempt(restartErr)
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAttempt(restartErr)
+	mock.ExpectRollback()
+	if err := up(ctx, db, info, false, log); !IsRetryable(err) {
+		t.Fatalf("expect retryable error, got %v", err)
+	}
+
+	// not retryable error
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAttempt(errors.New("syntax error"))
+	mock.ExpectRollback()
+	if err := up(ctx, db, info, false, log); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Fatalf("expect syntax error, got %v", err)
+	}
+
+	// dry run doesn't release the savepoint
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAttempt(nil)
+	mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+		WithArgs(1, v1.ChecksumString(), 0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	if err := up(ctx, db, info, true, log); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaultStepFunc(t *testing.T) {
+	mock := newMock(t, "default")
+	db, err := Open("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+	s := NewSteps("test database")
+	s.Append("nil step", nil, nil)
+	v0, _ := s.Version(0)
+	v1, _ := s.Version(1)
+	info, _, err := s.Up(v0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(0, v0.ChecksumString()))
+	mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+		WithArgs(1, v1.ChecksumString(), 0, v0.ChecksumString()).WillReturnError(restartErr)
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(0, v0.ChecksumString()))
+	mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+		WithArgs(1, v1.ChecksumString(), 0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT cockroach_restart").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if err := db.DefaultStepFunc(context.Background(), info, false, migrate.NewNilLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,57 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+)
+
+// DBFunc is a user provided function migrating a database through the Database
+// interface. It is intended for databases that are not SQL databases. It must not change
+// the database when dryRun is true.
+type DBFunc func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error
+
+// Step returns a migration step function that checks that the database version is
+// info.From(), executes the user provided functions in sequence and sets the database
+// version to info.To() with the DefaultStepFunc of the database. It terminates as soon
+// as a function returns an error. It only requires the Database interface so that it can
+// be used with any database.
+//
+// The changes to the database won't be cancelled when a function returns an error,
+// unless the database supports it.
+func Step(fs ...DBFunc) StepFunc {
+	return RegisterStepKind(func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) (err error) {
+		if skipDryRun(ctx, dryRun) {
+			return nil
+		}
+		defer func() {
+			if err != nil {
+				log.Error("step function", F("name", info.Name()), F("from", info.From()), F("to", info.To()), F("error", err.Error()))
+			}
+		}()
+		defer func() {
+			if err != nil {
+				err = fmt.Errorf("step %v -> %v: %w", info.From(), info.To(), err)
+			}
+		}()
+
+		dbv, err := db.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if err := CheckFrom(dbv, info); err != nil {
+			return err
+		}
+
+		for _, f := range fs {
+			if err = f(ctx, db, info, dryRun, log); err != nil {
+				return err
+			}
+		}
+
+		if err := db.DefaultStepFunc(ctx, info, dryRun, log); err != nil {
+			return err
+		}
+		log.Info("migrate step", F("name", info.Name()), F("from", info.From()), F("to", info.To()), F("dryRun", dryRun))
+		return nil
+	}, StepNoTx)
+}
@@ -0,0 +1,57 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStep(t *testing.T) {
+	var calls []bool
+	f := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		calls = append(calls, dryRun)
+		return nil
+	}
+	failFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		return errMock
+	}
+	db := &mockDatabase{version: Version{ID: 0}}
+	m, err := New(db, &mockStepper{[]StepFunc{nil, Step(f, f), Step(failFunc, f)}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUpDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 0 {
+		t.Fatalf("expect v0, got %v", db.version)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+	if len(calls) != 4 || !calls[0] || !calls[1] || calls[2] || calls[3] {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+	if err := m.OneUp(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if len(calls) != 4 || db.version.ID != 1 {
+		t.Fatalf("expect v1 without calls, got %v %v", db.version, calls)
+	}
+
+	info := &stepInfo{name: "step", from: Version{ID: 1}, to: Version{ID: 2}}
+	db.version = Version{ID: 2}
+	if err := Step(f)(context.Background(), db, info, false, NewNilLogger()); err == nil {
+		t.Fatal("expect error")
+	}
+	db.versionErr = errMock
+	if err := Step(f)(context.Background(), db, info, false, NewNilLogger()); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+}
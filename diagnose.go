@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Diagnosis is the result of Diagnose.
+type Diagnosis struct {
+	DB       Version // DB is the version in the database.
+	Expected Version // Expected is the version of the step with the ID of DB, or BadVersion.
+	StepID   int     // StepID is the ID of the step that appears modified, or -1 if unknown.
+	Message  string  // Message describes the probable cause of the mismatch.
+}
+
+func (d Diagnosis) String() string {
+	return d.Message
+}
+
+// Diagnose returns a diagnosis of the database version. When the database version
+// doesn't match the migration steps, it identifies the step that appears inserted or the
+// steps that appear swapped since the database was migrated.
+func (m *Migrator) Diagnose() (Diagnosis, error) {
+	return m.DiagnoseCtx(context.Background())
+}
+
+// DiagnoseCtx returns a diagnosis of the database version. When the database version
+// doesn't match the migration steps, it identifies the step that appears inserted or the
+// steps that appear swapped since the database was migrated.
+func (m *Migrator) DiagnoseCtx(ctx context.Context) (Diagnosis, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := Diagnosis{Expected: BadVersion, StepID: -1}
+	var err error
+	if d.DB, err = m.db.Version(ctx); err != nil {
+		return d, fmt.Errorf("diagnose: %w", err)
+	}
+	err = m.steps.Check(d.DB)
+	switch {
+	case err == nil:
+		d.Expected = d.DB
+		d.Message = fmt.Sprintf("database version %v matches the migration steps", d.DB)
+		return d, nil
+	case errors.Is(err, ErrBadVersionID):
+		d.Message = fmt.Sprintf("database version %v is beyond the last migration step: steps were removed", d.DB)
+		return d, nil
+	}
+	if d.Expected, err = m.steps.Version(d.DB.ID); err != nil {
+		return d, fmt.Errorf("diagnose: %w", err)
+	}
+	if d.DB.ID == 0 {
+		d.StepID = 0
+		d.Message = fmt.Sprintf("database version %v doesn't match %v: the name of the migration steps changed", d.DB, d.Expected)
+		return d, nil
+	}
+	if s, ok := m.steps.(*Steps); ok {
+		s.diagnose(&d)
+	}
+	if d.Message == "" {
+		d.Message = fmt.Sprintf("database version %v doesn't match %v: a step up to %d was modified or removed, or the name of the steps changed",
+			d.DB, d.Expected, d.DB.ID)
+	}
+	return d, nil
+}
+
+// chainChecksum returns the checksum of the sequence of the steps with the given IDs
+// when their IDs are renumbered from 1.
+func (s *Steps) chainChecksum(IDs []int) [32]byte {
+	checksum := s.rootChecksum()
+	for i, ID := range IDs {
+		checksum = s.stepChecksum(checksum, i+1, s.steps[ID].name, s.steps[ID].content)
+	}
+	return checksum
+}
+
+// diagnose sets the step ID and message of the diagnosis when the database checksum
+// matches the sequence of steps without one of the applied steps, or with two adjacent
+// applied steps swapped.
+func (s *Steps) diagnose(d *Diagnosis) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	IDs := make([]int, 0, d.DB.ID)
+	for k := 1; k <= d.DB.ID && d.DB.ID+1 < len(s.steps); k++ {
+		IDs = IDs[:0]
+		for ID := 1; ID <= d.DB.ID+1; ID++ {
+			if ID != k {
+				IDs = append(IDs, ID)
+			}
+		}
+		if s.chainChecksum(IDs) == d.DB.Checksum {
+			d.StepID = k
+			d.Message = fmt.Sprintf("step %d '%s' appears inserted among the applied steps", k, s.steps[k].name)
+			return
+		}
+	}
+	for k := 1; k < d.DB.ID; k++ {
+		IDs = IDs[:0]
+		for ID := 1; ID <= d.DB.ID; ID++ {
+			IDs = append(IDs, ID)
+		}
+		IDs[k-1], IDs[k] = IDs[k], IDs[k-1]
+		if s.chainChecksum(IDs) == d.DB.Checksum {
+			d.StepID = k
+			d.Message = fmt.Sprintf("steps %d '%s' and %d '%s' appear swapped", k, s.steps[k].name, k+1, s.steps[k+1].name)
+			return
+		}
+	}
+}
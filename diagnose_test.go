@@ -0,0 +1,59 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigratorDiagnose(t *testing.T) {
+	newSteps := func(root string, names ...string) *Steps {
+		s := NewSteps(root)
+		for _, name := range names {
+			s.Append(name, nil, nil)
+		}
+		return s
+	}
+	applied, _ := newSteps("test", "a", "b", "c").Version(3)
+	tests := []struct {
+		steps  *Steps
+		stepID int
+		msg    string
+	}{
+		{newSteps("test", "a", "b", "c", "d"), -1, "matches the migration steps"},
+		{newSteps("test", "a", "b"), -1, "beyond the last migration step"},
+		{newSteps("test", "a", "x", "b", "c"), 2, "step 2 'x' appears inserted"},
+		{newSteps("test", "a", "c", "b"), 2, "steps 2 'c' and 3 'b' appear swapped"},
+		{newSteps("test", "a", "x", "c"), -1, "a step up to 3 was modified or removed"},
+	}
+	for _, test := range tests {
+		m, err := New(&mockDatabase{version: applied}, test.steps, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := m.Diagnose()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.DB != applied || d.StepID != test.stepID || !strings.Contains(d.String(), test.msg) {
+			t.Errorf("expect step %d and %q, got %d and %q", test.stepID, test.msg, d.StepID, d)
+		}
+	}
+
+	root, _ := newSteps("old").Version(0)
+	m, err := New(&mockDatabase{version: root}, newSteps("test", "a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := m.Diagnose(); err != nil || d.StepID != 0 || !strings.Contains(d.Message, "name of the migration steps changed") {
+		t.Fatalf("unexpected diagnosis %v %v", d, err)
+	}
+
+	m, err = New(&mockDatabase{versionErr: errMock}, newSteps("test", "a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Diagnose(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+}
@@ -1,5 +1,7 @@
 package migrate
 
+import "fmt"
+
 type Error string
 
 const (
@@ -12,6 +14,11 @@ const (
 	// ErrBadVersionID is returned when Init found an out of range version ID in the database.
 	ErrBadVersionID Error = "bad version identifier"
 
+	// ErrDatabaseAhead is returned by Version when the version ID in the database is
+	// above the last migration step, like when the database was migrated by a newer
+	// version of the application.
+	ErrDatabaseAhead Error = "database ahead of migration steps"
+
 	// ErrBadVersionChecksum is returned when Init found a version with invalid checksum which is a
 	// hint that the migration steps don't match the one used for the database. Don't change
 	// any migration steps as it will result in changing checksums.
@@ -43,8 +50,71 @@ const (
 
 	// ErrAbort is returned by a user function to aborts a transaction.
 	ErrAbort Error = "abort transaction"
+
+	// ErrSkip is returned by a NoTxFunc to skip the remaining functions of the step and
+	// still change the database version.
+	ErrSkip Error = "skip step functions"
+
+	// ErrPendingMigrations is returned by AssertUpToDate when the database version is
+	// below the last migration step.
+	ErrPendingMigrations Error = "pending migrations"
+
+	// ErrMigrationLocked is returned when the migration lock is held by another migrator.
+	ErrMigrationLocked Error = "migration locked"
+
+	// ErrMissingDown is returned by Validate for a step with an up function and no down
+	// function.
+	ErrMissingDown Error = "missing down function"
+
+	// ErrConfirmationRequired is returned by AllDown when the migrator has a destructive
+	// guard and AllDownConfirmed must be called with the matching token.
+	ErrConfirmationRequired Error = "confirmation required"
+
+	// ErrDownDisabled is returned by the migration steps down when they are disabled
+	// with WithAllowDown.
+	ErrDownDisabled Error = "migration down disabled"
+
+	// ErrDuplicateChecksum is returned by CheckUnique when steps have the same checksum.
+	ErrDuplicateChecksum Error = "duplicate checksum"
+
+	// ErrIrreversible is returned by the Irreversible step function.
+	ErrIrreversible Error = "irreversible step"
+
+	// ErrDuplicateName is returned by Append when the step name is already used and
+	// unique names are required.
+	ErrDuplicateName Error = "duplicate step name"
+
+	// ErrNoTxInBatch is returned by the NoTx and NoTxF step functions executed by UpN as
+	// their SQL commands would not be rolled back with the batch transaction.
+	ErrNoTxInBatch Error = "non-transactional step in batch"
+
+	// ErrNoHistory is returned by History when the database has no migration history.
+	ErrNoHistory Error = "no migration history"
 )
 
 func (e Error) Error() string {
 	return string(e)
 }
+
+// StepError is the error returned when a migration step function fails. It carries
+// the step information and wraps the error returned by the step function.
+type StepError struct {
+	StepID   int     // StepID is the ID of the step executed up or down.
+	StepName string  // StepName is the name of the step.
+	From     Version // From is the database version before the step.
+	To       Version // To is the database version the step failed to reach.
+	Err      error   // Err is the step function error.
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d '%s': %v", e.StepID, e.StepName, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// newStepError returns a StepError for the step with the given ID.
+func newStepError(ID int, info StepInfo, err error) *StepError {
+	return &StepError{StepID: ID, StepName: info.Name(), From: info.From(), To: info.To(), Err: err}
+}
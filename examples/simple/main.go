@@ -50,16 +50,8 @@ func init() {
 
 func displayMigrationSteps() {
 	log.Println("-- migration steps --")
-	for i := range migrationSteps.Len() {
-		v, err := migrationSteps.Version(i)
-		if err != nil {
-			log.Fatalf("migration step %d version: %v", i, err)
-		}
-		name, err := migrationSteps.Name(i)
-		if err != nil {
-			log.Fatalf("migration step %d name: %v", i, err)
-		}
-		log.Printf("%d '%s' %v\n", i, name, v)
+	for _, step := range migrationSteps.All() {
+		log.Printf("%d '%s' %v\n", step.ID, step.Name, step.Version)
 	}
 	log.Println("---------------------")
 }
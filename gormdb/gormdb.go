@@ -0,0 +1,60 @@
+// Package gormdb adapts a GORM database to a migrate SQLDB so that the schema managed with
+// GORM is versioned with the migration steps.
+package gormdb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chmike/migrate"
+	"gorm.io/gorm"
+)
+
+// gormDB is an SQLDB holding the GORM database.
+type gormDB struct {
+	migrate.SQLDB
+	gdb *gorm.DB
+}
+
+// New returns an SQLDB using the sql database of gdb and the database specific queries q.
+// The version table is managed by the standard SQLDB operations.
+func New(gdb *gorm.DB, q *migrate.Queries) (migrate.SQLDB, error) {
+	if gdb == nil || q == nil {
+		return nil, fmt.Errorf("new gormdb: %w: nil database or queries", migrate.ErrBadParameters)
+	}
+	db, err := gdb.DB()
+	if err != nil {
+		return nil, fmt.Errorf("new gormdb: %w", err)
+	}
+	return &gormDB{SQLDB: migrate.NewSQLDB(db, q), gdb: gdb}, nil
+}
+
+// TxFunc is a user provided function called with the GORM database bound to the
+// transaction of the migration step.
+type TxFunc func(tx *gorm.DB, info migrate.StepInfo, dryRun bool, log migrate.Logger) error
+
+// TxF returns a migration step function like migrate.TxF that calls the user functions
+// with the GORM database bound to the migration transaction, so that they may call
+// tx.AutoMigrate(&Model{}). The database must be created with New.
+func TxF(fs ...TxFunc) migrate.StepFunc {
+	return migrate.RegisterStepKind(func(ctx context.Context, db migrate.Database, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+		g, ok := db.(*gormDB)
+		if !ok {
+			return fmt.Errorf("gorm txf: %w", migrate.ErrNotSQLDB)
+		}
+		txfs := make([]migrate.TxFunc, len(fs))
+		for i, f := range fs {
+			txfs[i] = func(tx migrate.SQLTx, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+				return f(g.bind(ctx, tx), info, dryRun, log)
+			}
+		}
+		return migrate.TxF(txfs...)(ctx, db, info, dryRun, log)
+	}, migrate.StepTx)
+}
+
+// bind returns a GORM database executing its operations in the transaction tx.
+func (g *gormDB) bind(ctx context.Context, tx migrate.SQLTx) *gorm.DB {
+	gtx := g.gdb.WithContext(ctx).Session(&gorm.Session{NewDB: true, SkipDefaultTransaction: true})
+	gtx.Statement.ConnPool = tx.Tx()
+	return gtx
+}
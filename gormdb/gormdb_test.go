@@ -0,0 +1,92 @@
+package gormdb
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/chmike/migrate"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var queries = migrate.Queries{
+	CreateTableQuery: `CREATE TABLE "migrate_version" ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+	InitTableQuery:   `INSERT INTO "migrate_version" ("id", "checksum") VALUES (?, ?)`,
+	VersionQuery:     `SELECT "id", "checksum" FROM "migrate_version" LIMIT 1`,
+	SetVersionQuery:  `UPDATE "migrate_version" SET "id" = ?, "checksum" = ? WHERE "id" = ? AND "checksum" = ?`,
+}
+
+type Book struct {
+	ID    uint
+	Title string
+}
+
+func TestGormDB(t *testing.T) {
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "data.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(nil, &queries); !errors.Is(err, migrate.ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", migrate.ErrBadParameters, err)
+	}
+	q := queries
+	db, err := New(gdb, &q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	s := migrate.NewSteps("books")
+	s.Append("create books",
+		TxF(func(tx *gorm.DB, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+			if err := tx.AutoMigrate(&Book{}); err != nil {
+				return err
+			}
+			return tx.Create(&Book{Title: "Go"}).Error
+		}),
+		TxF(func(tx *gorm.DB, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+			return tx.Migrator().DropTable(&Book{})
+		}),
+	)
+	m, err := migrate.New(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.OneUpDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if gdb.Migrator().HasTable(&Book{}) {
+		t.Fatal("unexpected books table after dry run")
+	}
+
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := gdb.Model(&Book{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expect 1 book, got %d", count)
+	}
+	if v, err := m.Version(); err != nil || v.ID != 1 {
+		t.Fatalf("expect v1, got %v, %v", v, err)
+	}
+
+	if err := m.AllDown(); err != nil {
+		t.Fatal(err)
+	}
+	if gdb.Migrator().HasTable(&Book{}) {
+		t.Fatal("unexpected books table after all down")
+	}
+
+	f := TxF()
+	if err := f(t.Context(), migrate.NewSQLDB(nil, &q), nil, false, migrate.NewNilLogger()); !errors.Is(err, migrate.ErrNotSQLDB) {
+		t.Fatalf("expect %v, got %v", migrate.ErrNotSQLDB, err)
+	}
+}
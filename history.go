@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HistoryEntry is a change of the database version recorded in the history table.
+type HistoryEntry struct {
+	ID        int64     `json:"id"`        // ID is the entry identifier.
+	From      int       `json:"from"`      // From is the version ID before the change.
+	To        int       `json:"to"`        // To is the version ID after the change.
+	Name      string    `json:"name"`      // Name is the migration step name.
+	AppliedAt time.Time `json:"appliedAt"` // AppliedAt is the time of the change.
+	DryRun    bool      `json:"dryRun"`    // DryRun is true for a dry run.
+}
+
+// historyTime scans a time returned by the drivers as a time.Time or a string.
+type historyTime struct {
+	t *time.Time
+}
+
+// historyTimeLayouts are the layouts of the times returned as a string.
+var historyTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+func (h historyTime) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case time.Time:
+		*h.t = v
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("unsupported time type %T", src)
+	}
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			*h.t = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time '%s'", s)
+}
+
+// History returns the changes of the database version recorded in the history table
+// ordered by ID.
+func (m *Migrator) History() ([]HistoryEntry, error) {
+	return m.HistoryCtx(context.Background())
+}
+
+// HistoryCtx returns the changes of the database version recorded in the history table
+// ordered by ID. Returns ErrNotSQLDB if the database is not an SQL database and
+// ErrNoHistory if its history is disabled.
+func (m *Migrator) HistoryCtx(ctx context.Context) ([]HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	db, ok := m.db.(SQLDB)
+	if !ok {
+		return nil, fmt.Errorf("history: %w", ErrNotSQLDB)
+	}
+	if db.Queries().HistoryQuery == "" {
+		return nil, fmt.Errorf("history: %w", ErrNoHistory)
+	}
+	rows, err := db.DB().QueryContext(ctx, db.Queries().HistoryQuery)
+	if err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+	defer rows.Close()
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		if err := rows.Scan(&e.ID, &e.From, &e.To, &e.Name, historyTime{&e.AppliedAt}, &e.DryRun); err != nil {
+			return nil, fmt.Errorf("history: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+	return entries, nil
+}
@@ -1,12 +1,16 @@
 package migrate
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Different log levels supported
@@ -31,6 +35,87 @@ func F(key string, value any) Field {
 	return Field{Key: key, Value: value}
 }
 
+// Render returns the value to log. It is the resolved value of a slog.LogValuer, the
+// string of a fmt.Stringer, or the value itself otherwise.
+func (f Field) Render() any {
+	switch v := f.Value.(type) {
+	case slog.LogValuer:
+		r := v.LogValue().Resolve()
+		if r.Kind() == slog.KindGroup {
+			return r.String()
+		}
+		return r.Any()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// -- context fields --
+
+// logFieldsKey is the context key of the fields added with WithLogFields.
+type logFieldsKey struct{}
+
+// WithLogFields returns a context in which the given fields are added to the fields
+// already set with WithLogFields. The migrator adds them to every message logged by
+// a method receiving the context and by the step functions it calls. It allows, for
+// instance, to log a request ID with every message of a migration run.
+func WithLogFields(ctx context.Context, fields ...Field) context.Context {
+	prev := LogFields(ctx)
+	all := make([]Field, 0, len(prev)+len(fields))
+	all = append(append(all, prev...), fields...)
+	return context.WithValue(ctx, logFieldsKey{}, all)
+}
+
+// LogFields returns the fields set with WithLogFields.
+func LogFields(ctx context.Context) []Field {
+	fields, _ := ctx.Value(logFieldsKey{}).([]Field)
+	return fields
+}
+
+// fieldsLogger is a logger adding fields to all the messages.
+type fieldsLogger struct {
+	Logger
+	fields []Field
+}
+
+// withLogFields returns l adding the fields set in ctx with WithLogFields to all the
+// messages, or l when there are none.
+func withLogFields(ctx context.Context, l Logger) Logger {
+	fields := LogFields(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return &fieldsLogger{Logger: l, fields: fields}
+}
+
+func (l *fieldsLogger) Error(msg string, fields ...Field) {
+	l.Logger.Error(msg, l.append(fields)...)
+}
+
+func (l *fieldsLogger) Warn(msg string, fields ...Field) {
+	l.Logger.Warn(msg, l.append(fields)...)
+}
+
+func (l *fieldsLogger) Info(msg string, fields ...Field) {
+	l.Logger.Info(msg, l.append(fields)...)
+}
+
+func (l *fieldsLogger) Debug(msg string, fields ...Field) {
+	l.Logger.Debug(msg, l.append(fields)...)
+}
+
+func (l *fieldsLogger) With(fields ...Field) Logger {
+	return &fieldsLogger{Logger: l.Logger.With(fields...), fields: l.fields}
+}
+
+// append returns the message fields followed by the context fields.
+func (l *fieldsLogger) append(fields []Field) []Field {
+	all := make([]Field, 0, len(fields)+len(l.fields))
+	return append(append(all, fields...), l.fields...)
+}
+
 // -- nil adapter --
 
 // NilAdapter is a nil logger that doesn't produce any log.
@@ -68,6 +153,11 @@ func (a *NilAdapter) Info(msg string, fields ...Field) {
 func (a *NilAdapter) Debug(msg string, fields ...Field) {
 }
 
+// With returns a child logger with the level of the logger.
+func (a *NilAdapter) With(fields ...Field) Logger {
+	return &NilAdapter{level: a.level}
+}
+
 // -- slog adapter --
 
 // SlogAdapter adapts slog.Logger to Logger
@@ -155,12 +245,33 @@ func (a *SlogAdapter) Debug(msg string, fields ...Field) {
 	a.log(slog.LevelDebug, msg, fields...)
 }
 
+// With returns a child logger adding the fields to all its messages.
+func (a *SlogAdapter) With(fields ...Field) Logger {
+	args := make([]any, 0, len(fields))
+	for _, attr := range slogAttrs(fields) {
+		args = append(args, attr)
+	}
+	return &SlogAdapter{
+		logger: a.logger.With(args...),
+		level:  a.Level(),
+	}
+}
+
 func (a *SlogAdapter) log(level slog.Level, msg string, fields ...Field) {
+	a.logger.LogAttrs(context.Background(), level, msg, slogAttrs(fields)...)
+}
+
+// slogAttrs returns the fields as slog attributes.
+func slogAttrs(fields []Field) []slog.Attr {
 	attrs := make([]slog.Attr, 0, len(fields))
 	for _, f := range fields {
-		attrs = append(attrs, slog.Any(f.Key, f.Value))
+		if _, ok := f.Value.(slog.LogValuer); ok {
+			attrs = append(attrs, slog.Any(f.Key, f.Value))
+		} else {
+			attrs = append(attrs, slog.Any(f.Key, f.Render()))
+		}
 	}
-	a.logger.LogAttrs(context.Background(), level, msg, attrs...)
+	return attrs
 }
 
 // -- (std) log adapter --
@@ -169,6 +280,8 @@ func (a *SlogAdapter) log(level slog.Level, msg string, fields ...Field) {
 type LogAdapter struct {
 	logger *log.Logger
 	level  LogLevel
+	fields []Field // fields added to all the messages.
+	json   bool    // messages are JSON objects.
 	mu     sync.RWMutex
 }
 
@@ -191,6 +304,30 @@ func NewLogLoggerWith(logger *log.Logger, lvl LogLevel) Logger {
 	}
 }
 
+// NewLogLoggerJSON creates a new std logger writing the messages as a JSON object per
+// line with the time, level, msg and fields keys. It writes to the output of the default
+// logger without its prefix and flags so that the lines are valid JSON.
+func NewLogLoggerJSON(lvl LogLevel) Logger {
+	return &LogAdapter{
+		logger: log.New(log.Writer(), "", 0),
+		level:  lvl,
+		json:   true,
+	}
+}
+
+// NewLogLoggerJSONWith creates a new std logger writing the messages as JSON objects
+// with the given logger. The logger should have no prefix and flags.
+func NewLogLoggerJSONWith(logger *log.Logger, lvl LogLevel) Logger {
+	if logger == nil {
+		logger = log.New(log.Writer(), "", 0)
+	}
+	return &LogAdapter{
+		logger: logger,
+		level:  lvl,
+		json:   true,
+	}
+}
+
 // Level returns the current logging level.
 func (a *LogAdapter) Level() LogLevel {
 	a.mu.RLock()
@@ -250,15 +387,142 @@ func (a *LogAdapter) Debug(msg string, fields ...Field) {
 	a.log("DEBUG", msg, fields...)
 }
 
+// With returns a child logger adding the fields to all its messages.
+func (a *LogAdapter) With(fields ...Field) Logger {
+	return &LogAdapter{
+		logger: a.logger,
+		level:  a.Level(),
+		fields: append(slices.Clip(a.fields), fields...),
+		json:   a.json,
+	}
+}
+
 // // Log logs the message and associated fields.
 func (a *LogAdapter) log(levelStr string, msg string, fields ...Field) {
+	if len(a.fields) > 0 {
+		fields = append(slices.Clip(a.fields), fields...)
+	}
+	if a.json {
+		a.logJSON(levelStr, msg, fields)
+		return
+	}
 	var buf strings.Builder
 	buf.WriteString(fmt.Sprintf("[%s] %s", levelStr, msg))
 	if len(fields) > 0 {
 		buf.WriteString(" |")
 		for _, field := range fields {
-			buf.WriteString(fmt.Sprintf(" %s='%v'", field.Key, field.Value))
+			buf.WriteString(fmt.Sprintf(" %s='%v'", field.Key, field.Render()))
 		}
 	}
 	a.logger.Println(buf.String())
 }
+
+// logJSON logs the message and associated fields as a JSON object. A field value that
+// can't be encoded in JSON is logged as a string.
+func (a *LogAdapter) logJSON(levelStr string, msg string, fields []Field) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	appendJSON(&buf, time.Now().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	appendJSON(&buf, levelStr)
+	buf.WriteString(`,"msg":`)
+	appendJSON(&buf, msg)
+	for _, field := range fields {
+		buf.WriteByte(',')
+		appendJSON(&buf, field.Key)
+		buf.WriteByte(':')
+		appendJSON(&buf, field.Render())
+	}
+	buf.WriteByte('}')
+	a.logger.Println(buf.String())
+}
+
+// appendJSON appends the JSON encoding of v to buf, or of its string if v is an error
+// or can't be encoded in JSON.
+func appendJSON(buf *bytes.Buffer, v any) {
+	if e, ok := v.(error); ok {
+		v = e.Error()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+// -- func adapter --
+
+// FuncAdapter adapts a function to the logger. It allows to bridge to any logger.
+type FuncAdapter struct {
+	fn     func(level LogLevel, msg string, fields []Field)
+	level  LogLevel
+	fields []Field // fields added to all the messages.
+	mu     sync.RWMutex
+}
+
+// NewFuncLogger returns a Logger calling fn with the messages whose level is at or above
+// lvl. A nil fn discards the messages.
+func NewFuncLogger(fn func(level LogLevel, msg string, fields []Field), lvl LogLevel) Logger {
+	return &FuncAdapter{
+		fn:    fn,
+		level: lvl,
+	}
+}
+
+// Level returns the current logging level.
+func (a *FuncAdapter) Level() LogLevel {
+	a.mu.RLock()
+	currentLevel := a.level
+	a.mu.RUnlock()
+	return currentLevel
+}
+
+// SetLevel set the logging level.
+func (a *FuncAdapter) SetLevel(lvl LogLevel) {
+	a.mu.Lock()
+	a.level = lvl
+	a.mu.Unlock()
+}
+
+// Error logs an error level message.
+func (a *FuncAdapter) Error(msg string, fields ...Field) {
+	a.log(LevelError, msg, fields)
+}
+
+// Warn logs a warning level message.
+func (a *FuncAdapter) Warn(msg string, fields ...Field) {
+	a.log(LevelWarn, msg, fields)
+}
+
+// Info logs an info level message.
+func (a *FuncAdapter) Info(msg string, fields ...Field) {
+	a.log(LevelInfo, msg, fields)
+}
+
+// Debug logs an debug level message.
+func (a *FuncAdapter) Debug(msg string, fields ...Field) {
+	a.log(LevelDebug, msg, fields)
+}
+
+// With returns a child logger adding the fields to all its messages.
+func (a *FuncAdapter) With(fields ...Field) Logger {
+	return &FuncAdapter{
+		fn:     a.fn,
+		level:  a.Level(),
+		fields: append(slices.Clip(a.fields), fields...),
+	}
+}
+
+// log calls the function when the level is at or above the current logging level.
+func (a *FuncAdapter) log(level LogLevel, msg string, fields []Field) {
+	a.mu.RLock()
+	currentLevel := a.level
+	a.mu.RUnlock()
+	if currentLevel > level || a.fn == nil {
+		return
+	}
+	if len(a.fields) > 0 {
+		fields = append(slices.Clip(a.fields), fields...)
+	}
+	a.fn(level, msg, fields)
+}
@@ -3,10 +3,14 @@ package migrate
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"log/slog"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 // testCapturingHandler is slog handler to capture logs.
@@ -188,6 +192,179 @@ func TestLogAdapter(t *testing.T) {
 
 }
 
+func TestLogAdapterJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogLoggerJSONWith(log.New(&buf, "", 0), LevelInfo)
+	logger.Debug("discarded")
+	logger.With(F("step", "add_index")).Info("info message", F("n", 3), F("version", Version{ID: 1}), F("err", errMock), F("fn", func() {}))
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry["time"].(string)); err != nil {
+		t.Fatal(err)
+	}
+	delete(entry, "time")
+	exp := map[string]any{
+		"level":   "INFO",
+		"msg":     "info message",
+		"step":    "add_index",
+		"n":       float64(3),
+		"version": Version{ID: 1}.String(),
+		"err":     errMock.Error(),
+	}
+	for k, v := range exp {
+		if entry[k] != v {
+			t.Fatalf("expect %s=%v, got %v", k, v, entry[k])
+		}
+	}
+	if fn, ok := entry["fn"].(string); !ok || fn == "" {
+		t.Fatalf("expect fn string, got %v", entry["fn"])
+	}
+
+	buf.Reset()
+	NewLogLoggerWith(log.New(&buf, "", 0), LevelInfo).Info("info message")
+	if exp := "[INFO] info message\n"; buf.String() != exp {
+		t.Fatalf("expect %q, got %q", exp, buf.String())
+	}
+	if NewLogLoggerJSON(LevelInfo).Level() != LevelInfo {
+		t.Fatal("unexpected level")
+	}
+}
+
+type secret string
+
+func (s secret) LogValue() slog.Value { return slog.StringValue("***") }
+
+type point struct{ X, Y int }
+
+func (p point) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("x", p.X), slog.Int("y", p.Y))
+}
+
+func TestFuncAdapter(t *testing.T) {
+	var logs []string
+	fn := func(level LogLevel, msg string, fields []Field) {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d %s", level, msg)
+		for _, f := range fields {
+			fmt.Fprintf(&sb, " %s=%v", f.Key, f.Render())
+		}
+		logs = append(logs, sb.String())
+	}
+	logger := NewFuncLogger(fn, LevelDebug)
+	logger.Error("error message", F("key", "value"))
+	logger.Warn("warn message")
+	logger.Info("info message", F("version", Version{ID: 1}))
+	logger.Debug("debug message")
+	exp := []string{
+		"3 error message key=value",
+		"2 warn message",
+		"1 info message version=" + Version{ID: 1}.String(),
+		"0 debug message",
+	}
+	if !slices.Equal(logs, exp) {
+		t.Fatalf("expect %q, got %q", exp, logs)
+	}
+
+	logs = nil
+	logger.SetLevel(LevelWarn)
+	if logger.Level() != LevelWarn {
+		t.Errorf("expect %v, got %v", LevelWarn, logger.Level())
+	}
+	logger.Info("info message")
+	logger.Debug("debug message")
+	logger.Warn("warn message")
+	if exp := []string{"2 warn message"}; !slices.Equal(logs, exp) {
+		t.Fatalf("expect %q, got %q", exp, logs)
+	}
+
+	logger = NewFuncLogger(nil, LevelDebug)
+	logger.Error("discarded")
+}
+
+func TestLoggerWith(t *testing.T) {
+	var logs []string
+	fn := func(level LogLevel, msg string, fields []Field) {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d %s", level, msg)
+		for _, f := range fields {
+			fmt.Fprintf(&sb, " %s=%v", f.Key, f.Render())
+		}
+		logs = append(logs, sb.String())
+	}
+	logger := NewFuncLogger(fn, LevelInfo)
+	child := logger.With(F("step", "add_index"))
+	child.SetLevel(LevelDebug)
+	if logger.Level() != LevelInfo {
+		t.Fatalf("expect %v, got %v", LevelInfo, logger.Level())
+	}
+	child.Debug("debug message", F("key", "value"))
+	child.With(F("n", 1)).Info("info message")
+	logger.Info("parent message")
+	exp := []string{
+		"0 debug message step=add_index key=value",
+		"1 info message step=add_index n=1",
+		"1 parent message",
+	}
+	if !slices.Equal(logs, exp) {
+		t.Fatalf("expect %q, got %q", exp, logs)
+	}
+
+	logs = nil
+	ctx := WithLogFields(context.Background(), F("run", 7))
+	withLogFields(ctx, logger).With(F("step", "add_index")).Info("info message")
+	if exp := []string{"1 info message step=add_index run=7"}; !slices.Equal(logs, exp) {
+		t.Fatalf("expect %q, got %q", exp, logs)
+	}
+
+	var buf bytes.Buffer
+	NewLogLoggerWith(log.New(&buf, "", 0), LevelInfo).With(F("step", "add_index")).Info("info message", F("key", "value"))
+	if exp := "[INFO] info message | step='add_index' key='value'\n"; buf.String() != exp {
+		t.Fatalf("expect %q, got %q", exp, buf.String())
+	}
+
+	buf.Reset()
+	NewSlogLoggerWith(slog.New(slog.NewTextHandler(&buf, nil)), LevelInfo).With(F("step", "add_index")).Info("info message")
+	if !strings.Contains(buf.String(), "msg=\"info message\" step=add_index") {
+		t.Fatalf("unexpected log %q", buf.String())
+	}
+
+	if l := NewNilLogger().With(F("step", "add_index")); l.Level() != LevelInfo {
+		t.Fatalf("expect %v, got %v", LevelInfo, l.Level())
+	}
+}
+
+func TestFieldRender(t *testing.T) {
+	tests := []struct {
+		field Field
+		exp   any
+	}{
+		{F("cmd", SQLCommand{Cmd: "SELECT ?", Args: []any{1}}), "`SELECT ?` args:[1]"},
+		{F("from", Version{ID: 1}), Version{ID: 1}.String()},
+		{F("password", secret("pass")), "***"},
+		{F("point", point{1, 2}), "[x=1 y=2]"},
+		{F("int", 3), 3},
+	}
+	for _, test := range tests {
+		if v := test.field.Render(); v != test.exp {
+			t.Errorf("expect %v, got %v", test.exp, v)
+		}
+	}
+
+	var buf bytes.Buffer
+	NewLogLoggerWith(log.New(&buf, "", 0), LevelInfo).Info("msg", F("cmd", SQLCommand{Cmd: "SELECT ?", Args: []any{1}}), F("password", secret("pass")))
+	if exp := "[INFO] msg | cmd='`SELECT ?` args:[1]' password='***'\n"; buf.String() != exp {
+		t.Errorf("expect %q, got %q", exp, buf.String())
+	}
+
+	buf.Reset()
+	NewSlogLoggerWith(slog.New(slog.NewJSONHandler(&buf, nil)), LevelInfo).Info("msg", F("cmd", SQLCommand{Cmd: "SELECT 1"}), F("point", point{1, 2}))
+	if exp := `"cmd":"SELECT 1","point":{"x":1,"y":2}`; !strings.Contains(buf.String(), exp) {
+		t.Errorf("expect %q in %q", exp, buf.String())
+	}
+}
+
 func TestDefaultLoggers(t *testing.T) {
 	slogLogger := NewSlogLoggerWith(nil, LevelInfo)
 	if slogLogger == nil {
@@ -233,3 +410,47 @@ func TestConcurrentAccess(t *testing.T) {
 	<-done
 	<-done
 }
+
+func TestWithLogFields(t *testing.T) {
+	var logs []string
+	fn := func(level LogLevel, msg string, fields []Field) {
+		var sb strings.Builder
+		sb.WriteString(msg)
+		for _, f := range fields {
+			fmt.Fprintf(&sb, " %s=%v", f.Key, f.Render())
+		}
+		logs = append(logs, sb.String())
+	}
+	logFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		log.Info("executing", F("name", info.Name()))
+		return db.DefaultStepFunc(ctx, info, dryRun, log)
+	}
+	db := &mockDatabase{version: Version{ID: 0}}
+	steps := &mockStepper{[]StepFunc{nil, logFunc}}
+	m, err := New(db, steps, NewFuncLogger(fn, LevelInfo), WithPlanLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithLogFields(context.Background(), F("request_id", "r1"))
+	ctx = WithLogFields(ctx, F("user", "bob"))
+	if err := m.AllUpCtx(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 {
+		t.Fatal("expect logs")
+	}
+	for _, l := range logs {
+		if !strings.HasSuffix(l, " request_id=r1 user=bob") {
+			t.Fatalf("expect context fields in %q", l)
+		}
+	}
+	if !slices.Contains(logs, "executing name=step 1 request_id=r1 user=bob") {
+		t.Fatalf("expect step log, got %q", logs)
+	}
+	if fields := LogFields(context.Background()); fields != nil {
+		t.Fatalf("expect no fields, got %v", fields)
+	}
+}
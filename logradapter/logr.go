@@ -0,0 +1,130 @@
+// Package logradapter provides a migrate.Logger writing to a go-logr logger.
+//
+// The logr logger has no warning level. The error messages are logged with the Error
+// method of the logr logger, the warning and info messages at the verbosity level 0 and
+// the debug messages at the verbosity level 1.
+package logradapter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/chmike/migrate"
+
+	"github.com/go-logr/logr"
+)
+
+// Verbosity levels of the messages.
+const (
+	warnV  = 0
+	infoV  = 0
+	debugV = 1
+)
+
+type logrAdapter struct {
+	logger logr.Logger
+	level  migrate.LogLevel
+	mu     sync.RWMutex
+}
+
+// New returns a logger using the given logr logger and level. A zero logr logger
+// discards the messages.
+func New(l logr.Logger, lvl migrate.LogLevel) migrate.Logger {
+	if l.GetSink() == nil {
+		l = logr.Discard()
+	}
+	return &logrAdapter{
+		logger: l,
+		level:  lvl,
+	}
+}
+
+// Level returns the current logging level.
+func (a *logrAdapter) Level() migrate.LogLevel {
+	a.mu.RLock()
+	currentLevel := a.level
+	a.mu.RUnlock()
+	return currentLevel
+}
+
+// SetLevel set the logging level.
+func (a *logrAdapter) SetLevel(lvl migrate.LogLevel) {
+	a.mu.Lock()
+	a.level = lvl
+	a.mu.Unlock()
+}
+
+// With returns a child logger adding the fields to all its messages.
+func (a *logrAdapter) With(fields ...migrate.Field) migrate.Logger {
+	return &logrAdapter{
+		logger: a.logger.WithValues(keysAndValues(fields)...),
+		level:  a.Level(),
+	}
+}
+
+// keysAndValues returns the fields as logr key value pairs.
+func keysAndValues(fields []migrate.Field) []any {
+	kv := make([]any, 0, 2*len(fields))
+	for _, f := range fields {
+		kv = append(kv, f.Key, f.Render())
+	}
+	return kv
+}
+
+// Error logs an error level message. The value of the field with the "error" key, if
+// any, is the error of the logr message.
+func (a *logrAdapter) Error(msg string, fields ...migrate.Field) {
+	a.mu.RLock()
+	currentLevel := a.level
+	a.mu.RUnlock()
+	if currentLevel > migrate.LevelError {
+		return
+	}
+	var err error
+	kv := make([]any, 0, 2*len(fields))
+	for _, f := range fields {
+		if f.Key == "error" && err == nil {
+			var ok bool
+			if err, ok = f.Value.(error); !ok {
+				err = errors.New(fmt.Sprint(f.Render()))
+			}
+			continue
+		}
+		kv = append(kv, f.Key, f.Render())
+	}
+	a.logger.Error(err, msg, kv...)
+}
+
+// Warn logs a warning level message.
+func (a *logrAdapter) Warn(msg string, fields ...migrate.Field) {
+	a.mu.RLock()
+	currentLevel := a.level
+	a.mu.RUnlock()
+	if currentLevel > migrate.LevelWarn {
+		return
+	}
+	a.logger.V(warnV).Info(msg, keysAndValues(fields)...)
+}
+
+// Info logs an info level message.
+func (a *logrAdapter) Info(msg string, fields ...migrate.Field) {
+	a.mu.RLock()
+	currentLevel := a.level
+	a.mu.RUnlock()
+	if currentLevel > migrate.LevelInfo {
+		return
+	}
+	a.logger.V(infoV).Info(msg, keysAndValues(fields)...)
+}
+
+// Debug logs an debug level message.
+func (a *logrAdapter) Debug(msg string, fields ...migrate.Field) {
+	a.mu.RLock()
+	currentLevel := a.level
+	a.mu.RUnlock()
+	if currentLevel > migrate.LevelDebug {
+		return
+	}
+	a.logger.V(debugV).Info(msg, keysAndValues(fields)...)
+}
@@ -0,0 +1,106 @@
+package logradapter
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/chmike/migrate"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRecorder returns a logr logger recording its messages with the given verbosity.
+func newRecorder(verbosity int) (logr.Logger, *[]string) {
+	var mu sync.Mutex
+	var lines []string
+	l := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		lines = append(lines, args)
+		mu.Unlock()
+	}, funcr.Options{Verbosity: verbosity})
+	return l, &lines
+}
+
+func TestNewLogrLogger(t *testing.T) {
+	l, _ := newRecorder(0)
+	logger := New(l, migrate.LevelWarn)
+
+	logrLogger, ok := logger.(*logrAdapter)
+	assert.True(t, ok, "Logger should be of type *logrAdapter")
+	assert.Equal(t, migrate.LevelWarn, logrLogger.Level(), "Log level should be WarnLevel")
+
+	// A zero logr logger discards the messages
+	logger = New(logr.Logger{}, migrate.LevelDebug)
+	assert.NotPanics(t, func() { logger.Info("discarded") })
+}
+
+func TestLogrAdapter_SetLevel(t *testing.T) {
+	l, _ := newRecorder(0)
+	logger := New(l, migrate.LevelInfo)
+	logger.SetLevel(migrate.LevelError)
+	assert.Equal(t, migrate.LevelError, logger.Level(), "Log level should be updated to ErrorLevel")
+}
+
+func TestLogrAdapter_Log(t *testing.T) {
+	l, lines := newRecorder(1)
+	logger := New(l, migrate.LevelDebug)
+
+	logger.Error("error message", migrate.F("error", "failed"), migrate.F("count", 1))
+	logger.Warn("warn message", migrate.F("count", 3))
+	logger.Info("info message", migrate.F("version", migrate.Version{ID: 1}))
+	logger.Debug("debug message")
+
+	exp := []string{
+		`"msg"="error message" "error"="failed" "count"=1`,
+		`"level"=0 "msg"="warn message" "count"=3`,
+		fmt.Sprintf(`"level"=0 "msg"="info message" "version"=%q`, migrate.Version{ID: 1}.String()),
+		`"level"=1 "msg"="debug message"`,
+	}
+	assert.Equal(t, exp, *lines)
+
+	// Messages below the level are not logged
+	*lines = nil
+	logger.SetLevel(migrate.LevelWarn)
+	logger.Info("info message")
+	logger.Debug("debug message")
+	assert.Empty(t, *lines)
+
+	// Messages above the logr verbosity are not logged
+	l, lines = newRecorder(0)
+	logger = New(l, migrate.LevelDebug)
+	logger.Debug("debug message")
+	assert.Empty(t, *lines)
+}
+
+func TestConcurrency(t *testing.T) {
+	l, lines := newRecorder(0)
+	logger := New(l, migrate.LevelInfo)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.SetLevel(migrate.LevelInfo)
+			logger.Info("message", migrate.F("i", i))
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, *lines, 10)
+}
+
+func TestLogrAdapter_With(t *testing.T) {
+	l, lines := newRecorder(1)
+	logger := New(l, migrate.LevelInfo)
+	child := logger.With(migrate.F("step", "add_index"))
+	child.SetLevel(migrate.LevelDebug)
+	assert.Equal(t, migrate.LevelInfo, logger.Level(), "Parent level should be unchanged")
+
+	child.Debug("debug message", migrate.F("key", "value"))
+	logger.Debug("discarded")
+	assert.Len(t, *lines, 1)
+	assert.Contains(t, (*lines)[0], `"step"="add_index"`)
+	assert.Contains(t, (*lines)[0], `"key"="value"`)
+}
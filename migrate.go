@@ -4,21 +4,306 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Migrator is a Migrater for the given database, stepper and logger.
 type Migrator struct {
-	mu            sync.Mutex // common mutex.
-	db            Database   // database
-	steps         Stepper    // migration stepper
-	logger        Logger     // logger
-	cachedVersion Version    // cached version
+	mu            sync.Mutex        // common mutex.
+	db            Database          // database
+	steps         Stepper           // migration stepper
+	logger        Logger            // logger
+	cachedVersion Version           // cached version
+	locker        Locker            // migration locker
+	lastErr       error             // last migration error
+	hooks         Hooks             // step hooks
+	quietNoLog    bool              // LevelNoLog also silences the hooks
+	wrappers      []StepWrapper     // step wrappers
+	guardToken    string            // AllDown confirmation token
+	planLog       bool              // log the plan of AllUp
+	resultPath    string            // result file path
+	resultFile    *os.File          // result file
+	stepTimeout   time.Duration     // maximum duration of a step
+	defaultStep   StepFunc          // step function used when nil
+	casRetries    int               // retries of a step up losing a version race
+	readOnly      bool              // dry runs don't write to the database
+	report        *RunReport        // report of the running AllUpReport
+	downDisabled  bool              // migration steps down are refused
+	downDryRun    bool              // dry runs down are allowed when steps down are refused
+	clock         Clock             // clock of the history timestamps
+	onBadVersion  BadVersionHandler // bad version checksum handler
+	override      *stepInfo         // pending override of the stored version
+	closed        bool              // Close was called
+}
+
+// Hooks are functions called around the execution of each migration step. A nil
+// function is ignored.
+type Hooks struct {
+	// BeforeStep is called before the execution of a migration step.
+	BeforeStep func(info StepInfo, dryRun bool)
+
+	// AfterStep is called after the execution of a migration step with its error
+	// and duration.
+	AfterStep func(info StepInfo, dryRun bool, err error, d time.Duration)
+
+	// Independent is true when the hooks must be called regardless of the logger level,
+	// like hooks emitting metrics. It only matters with WithQuietNoLog.
+	Independent bool
+}
+
+// Option is a migrator option.
+type Option func(*Migrator)
+
+// WithLocker sets the locker acquired by AllUp and AllDown for the whole run to prevent
+// concurrent migrations of the database.
+func WithLocker(locker Locker) Option {
+	return func(m *Migrator) {
+		m.locker = locker
+	}
+}
+
+// WithDestructiveGuard makes AllDown return ErrConfirmationRequired. All the migration steps
+// down must then be executed with AllDownConfirmed and the given token. The token must
+// not be empty.
+func WithDestructiveGuard(token string) Option {
+	return func(m *Migrator) {
+		m.guardToken = token
+	}
+}
+
+// WithAllowDown sets whether the migration steps down may be executed. When allow is
+// false, OneDown, AllDown, Redo and OneDownDryRun return ErrDownDisabled without changing
+// the database. It protects a production database against an accidental rollback. The
+// migration steps down are allowed by default.
+func WithAllowDown(allow bool) Option {
+	return func(m *Migrator) {
+		m.downDisabled = !allow
+	}
+}
+
+// WithAllowDownDryRun sets whether OneDownDryRun may be executed when the migration steps
+// down are disabled with WithAllowDown, so that the rollback can still be planned.
+func WithAllowDownDryRun(allow bool) Option {
+	return func(m *Migrator) {
+		m.downDryRun = allow
+	}
+}
+
+// Clock is the source of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type clockKey struct{}
+
+// WithClock sets the clock giving the time of the changes recorded in the history table.
+// It allows the tests to check the recorded times. The default clock is time.Now.
+func WithClock(c Clock) Option {
+	return func(m *Migrator) {
+		m.clock = c
+	}
+}
+
+// withClock returns a context in which the transactions started by StartTransaction use
+// the clock of the migrator, if any.
+func (m *Migrator) withClock(ctx context.Context) context.Context {
+	if m.clock == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, clockKey{}, m.clock)
+}
+
+// BadVersionHandler is called with the version stored in the database when its checksum
+// doesn't match the migration steps. The error err wraps ErrBadVersionChecksum.
+type BadVersionHandler func(stored Version, err error) error
+
+// WithBadVersionHandler sets the handler called when the checksum of the version stored
+// in the database doesn't match the migration steps, like after an intentional change of
+// a step. When the handler returns an error, the version is invalid and the error is
+// returned. When it returns nil, the migrator proceeds with the version of the step with
+// its ID. The stored version is only overridden in the database by the next migration
+// step executed, so that reading the version never writes to the database. The dry
+// runs thus fail with ErrBadVersionChecksum before, unless WithReadOnlyVersionCheck is
+// used. It is an escape hatch for a controlled recovery and must be used with care.
+func WithBadVersionHandler(handler BadVersionHandler) Option {
+	return func(m *Migrator) {
+		m.onBadVersion = handler
+	}
+}
+
+// WithPlanLog makes AllUp log at the info level the ordered list of the pending steps
+// before executing them.
+func WithPlanLog() Option {
+	return func(m *Migrator) {
+		m.planLog = true
+	}
+}
+
+// WithHooks sets the hooks called around the execution of each migration step.
+func WithHooks(hooks Hooks) Option {
+	return func(m *Migrator) {
+		m.hooks = hooks
+	}
+}
+
+// WithQuietNoLog makes LevelNoLog silence the hooks too. The hooks are not called while
+// the level of the logger is LevelNoLog, unless they are marked Independent, so that
+// hooks logging the steps don't produce output when the logs are disabled. Without this
+// option, the hooks are called whatever the logger level.
+func WithQuietNoLog() Option {
+	return func(m *Migrator) {
+		m.quietNoLog = true
+	}
+}
+
+// hooksEnabled returns true when the hooks must be called.
+func (m *Migrator) hooksEnabled() bool {
+	return !m.quietNoLog || m.hooks.Independent || m.logger.Level() < LevelNoLog
+}
+
+// WithStepTimeout limits the duration of the execution of each migration step to d. The
+// context given to the step function is canceled when d expires, which rolls back its
+// transaction, and the step error then wraps context.DeadlineExceeded. The duration is
+// not limited when d is zero or negative.
+func WithStepTimeout(d time.Duration) Option {
+	return func(m *Migrator) {
+		m.stepTimeout = d
+	}
+}
+
+// WithDefaultStepFunc sets the step function executed in place of a nil step function.
+// It replaces the DefaultStepFunc of the database which only changes the version. The
+// function f may call db.DefaultStepFunc to change the version, or return an error to
+// refuse empty migration steps.
+func WithDefaultStepFunc(f StepFunc) Option {
+	return func(m *Migrator) {
+		m.defaultStep = f
+	}
+}
+
+// WithCASRetry makes a migration step up that fails with ErrBadVersion re-read the
+// database version, as another process may have changed it concurrently. The step is
+// considered applied when the database version was advanced to its target version or
+// beyond, and it is executed again when the database version is unchanged, up to
+// retries times. The last error is returned otherwise. It allows concurrent AllUp to
+// succeed. Steps executed in a dry run are not retried.
+func WithCASRetry(retries int) Option {
+	return func(m *Migrator) {
+		m.casRetries = retries
+	}
+}
+
+// WithReadOnlyVersionCheck makes the dry runs only read the database version in a
+// read-only transaction. InitDryRun checks that the database is not initialized, and
+// OneUpDryRun and OneDownDryRun check that the database version is the version before
+// the step. The step functions are called without database access, so that only the
+// SQL commands of the Tx, TxCounted and NoTx step functions are logged at the debug level.
+// It allows to check the database version on a read replica.
+func WithReadOnlyVersionCheck() Option {
+	return func(m *Migrator) {
+		m.readOnly = true
+	}
+}
+
+// StepWrapper is a function wrapping the execution of a migration step. It must call
+// step with ctx or a context derived from it, and return its error. It allows, for
+// instance, to execute the step in a tracing span.
+type StepWrapper func(ctx context.Context, info StepInfo, dryRun bool, step func(context.Context) error) error
+
+// WithStepWrapper adds a wrapper around the execution of each migration step. The first
+// added wrapper is the outermost.
+func WithStepWrapper(w StepWrapper) Option {
+	return func(m *Migrator) {
+		if w != nil {
+			m.wrappers = append(m.wrappers, w)
+		}
+	}
+}
+
+// readOnlyStep checks that the database version is info.From() and calls the step
+// function f without database access to log its SQL commands.
+func (m *Migrator) readOnlyStep(ctx context.Context, info StepInfo, f StepFunc) error {
+	v, err := m.db.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if m.override != nil && v == m.override.from {
+		v = m.override.to
+	}
+	if err := CheckFrom(v, info); err != nil {
+		if errors.Is(err, ErrBadVersion) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrBadVersion, err)
+	}
+	log := withLogFields(ctx, m.logger)
+	if report, _ := probeStep(ctx, info, f); log.Level() >= LevelDebug {
+		for _, cmd := range report.Cmds {
+			log.Debug("read-only dry run sql command", F("name", info.Name()), F("cmd", cmd))
+		}
+	}
+	log.Info("migrate step", F("name", info.Name()), F("from", info.From()), F("to", info.To()), F("dryRun", true))
+	return nil
+}
+
+// runStep executes the step function f, or the default step function if f is nil,
+// in the step wrappers and calls the hooks around it.
+func (m *Migrator) runStep(ctx context.Context, info StepInfo, f StepFunc, dryRun bool) error {
+	if !dryRun {
+		if err := m.applyOverride(ctx); err != nil {
+			return err
+		}
+	}
+	hooks := m.hooksEnabled()
+	if hooks && m.hooks.BeforeStep != nil {
+		m.hooks.BeforeStep(info, dryRun)
+	}
+	if f == nil {
+		f = m.defaultStep
+	}
+	ctx = m.withClock(ctx)
+	step := func(ctx context.Context) error {
+		if dryRun && m.readOnly {
+			return m.readOnlyStep(ctx, info, f)
+		}
+		if f == nil {
+			return m.db.DefaultStepFunc(ctx, info, dryRun, withLogFields(ctx, m.logger))
+		}
+		return f(ctx, m.db, info, dryRun, withLogFields(ctx, m.logger))
+	}
+	for i := len(m.wrappers) - 1; i >= 0; i-- {
+		w, next := m.wrappers[i], step
+		step = func(ctx context.Context) error {
+			return w(ctx, info, dryRun, next)
+		}
+	}
+	if m.stepTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.stepTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := step(ctx)
+	d := time.Since(start)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", err, context.DeadlineExceeded)
+	}
+	m.writeResult(info, dryRun, err, d)
+	m.reportStep(info, dryRun, err, d)
+	if hooks && m.hooks.AfterStep != nil {
+		m.hooks.AfterStep(info, dryRun, err, d)
+	}
+	return err
 }
 
 // New creates a new migrator. Returns ErrBadParameters if the parameters are invalid,
-// or ErrBadVersion if the version in the database isn't found in the stepper.
-func New(db Database, steps Stepper, l Logger) (*Migrator, error) {
+// or ErrBadVersion if the version in the database isn't found in the stepper. The
+// migrator should be closed with Close when it is no longer used.
+func New(db Database, steps Stepper, l Logger, options ...Option) (*Migrator, error) {
 	if steps == nil || db == nil {
 		return nil, fmt.Errorf("%w: nil database or stepper", ErrBadParameters)
 	}
@@ -26,11 +311,77 @@ func New(db Database, steps Stepper, l Logger) (*Migrator, error) {
 		l = NewNilLogger()
 	}
 
-	return &Migrator{
+	m := &Migrator{
 		db:            db,
 		steps:         steps,
 		logger:        l,
 		cachedVersion: badVersion,
+	}
+	for _, option := range options {
+		option(m)
+	}
+	if err := m.openResultFile(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Close closes the result file, if any, and releases the resources of the locker and of
+// the database. The *sql.DB of an SQLDB is closed, and the locker or a database that is
+// not an SQLDB is closed when it is an io.Closer. Closing a closed migrator does nothing.
+func (m *Migrator) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	errs := []error{m.closeResultFile()}
+	if c, ok := m.locker.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	switch db := m.db.(type) {
+	case SQLDB:
+		errs = append(errs, db.DB().Close())
+	case io.Closer:
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// setLastError records the error of a migration run and returns it. ErrEndOfSteps is
+// not a migration failure and clears the last error.
+func (m *Migrator) setLastError(err error) error {
+	if errors.Is(err, ErrEndOfSteps) {
+		m.lastErr = nil
+	} else {
+		m.lastErr = err
+	}
+	return err
+}
+
+// LastError returns the error of the last OneUp, OneDown, AllUp or AllDown run, or nil
+// if it succeeded. Dry runs don't change the last error.
+func (m *Migrator) LastError() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastErr
+}
+
+// lock acquires the locker, if any, and returns the function releasing it. The returned
+// function joins the unlock error with the given error.
+func (m *Migrator) lock(ctx context.Context) (func(err error) error, error) {
+	if m.locker == nil {
+		return func(err error) error { return err }, nil
+	}
+	if err := m.locker.Lock(ctx); err != nil {
+		return nil, err
+	}
+	return func(err error) error {
+		if unlockErr := m.locker.Unlock(ctx); unlockErr != nil {
+			return errors.Join(err, fmt.Errorf("unlock: %w", unlockErr))
+		}
+		return err
 	}, nil
 }
 
@@ -40,35 +391,206 @@ func (m *Migrator) Version() (v Version, err error) {
 }
 
 // VersionCtx returns the current version of the database after checking its
-// validity against the migrations steps.
+// validity against the migrations steps. The error wraps ErrDatabaseAhead when the
+// version ID is above the last migration step, which happens when the database was
+// migrated by a newer version of the application.
 func (m *Migrator) VersionCtx(ctx context.Context) (Version, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.versionCtx(ctx)
 }
 
+// RawVersion returns the version stored in the database without checking it against
+// the migration steps.
+func (m *Migrator) RawVersion() (Version, error) {
+	return m.RawVersionCtx(context.Background())
+}
+
+// RawVersionCtx returns the version stored in the database without checking it against
+// the migration steps. It allows to read the version of a database whose checksum doesn't
+// match the migration steps. The cached version used by the migration steps is unchanged.
+func (m *Migrator) RawVersionCtx(ctx context.Context) (Version, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.db.Version(ctx)
+}
+
+// IsAtBaseline returns true when the database version is v0.
+func (m *Migrator) IsAtBaseline() (bool, error) {
+	return m.IsAtBaselineCtx(context.Background())
+}
+
+// IsAtBaselineCtx returns true when the database version is v0 after checking its
+// validity against the migration steps.
+//
+// The version v0 is set by Init and reached by AllDown. The database is initialized, as
+// it has a version, but no migration step is applied to it. It differs from a database
+// that is not initialized, which has no version, for which ErrNotInitialized is returned.
+func (m *Migrator) IsAtBaselineCtx(ctx context.Context) (bool, error) {
+	v, err := m.VersionCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+	return v.ID == 0, nil
+}
+
+// VersionString returns the current version of the database formatted as a string.
+func (m *Migrator) VersionString() (string, error) {
+	return m.VersionStringCtx(context.Background())
+}
+
+// VersionStringCtx returns the current version of the database formatted as a string
+// after checking its validity against the migrations steps.
+func (m *Migrator) VersionStringCtx(ctx context.Context) (string, error) {
+	v, err := m.VersionCtx(ctx)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// VersionID returns the ID of the current version of the database.
+func (m *Migrator) VersionID() (int, error) {
+	return m.VersionIDCtx(context.Background())
+}
+
+// VersionIDCtx returns the ID of the current version of the database after checking its
+// validity against the migrations steps.
+func (m *Migrator) VersionIDCtx(ctx context.Context) (int, error) {
+	v, err := m.VersionCtx(ctx)
+	if err != nil {
+		return BadVersion.ID, err
+	}
+	return v.ID, nil
+}
+
 // VersionCtx returns the current version of the database after checking its
 // validity against the migrations steps.
 func (m *Migrator) versionCtx(ctx context.Context) (Version, error) {
 	m.cachedVersion = badVersion
+	m.override = nil
 	v, err := m.db.Version(ctx)
 	if err != nil {
 		return m.cachedVersion, err
 	}
 	if err := m.steps.Check(v); err != nil {
+		if m.onBadVersion != nil && errors.Is(err, ErrBadVersionChecksum) {
+			return m.overrideVersion(ctx, v, err)
+		}
+		if last := m.steps.Len() - 1; v.ID > last {
+			return m.cachedVersion, fmt.Errorf("%w: %w: db is %v, last step is v%d", ErrBadVersion, ErrDatabaseAhead, v, last)
+		}
+		if !errors.Is(err, ErrBadVersion) {
+			err = fmt.Errorf("%w: %w", ErrBadVersion, err)
+		}
 		return m.cachedVersion, err
 	}
 	m.cachedVersion = v
 	return m.cachedVersion, nil
 }
 
+// overrideVersion calls the bad version handler and, when it returns nil, returns the
+// version of the step with the ID of the stored version. The override of the stored
+// version is pending until applyOverride is called by a migration step.
+func (m *Migrator) overrideVersion(ctx context.Context, stored Version, err error) (Version, error) {
+	if err := m.onBadVersion(stored, err); err != nil {
+		if !errors.Is(err, ErrBadVersion) {
+			err = fmt.Errorf("%w: %w", ErrBadVersion, err)
+		}
+		return m.cachedVersion, err
+	}
+	v, err := m.steps.Version(stored.ID)
+	if err != nil {
+		return m.cachedVersion, fmt.Errorf("%w: %w", ErrBadVersion, err)
+	}
+	m.override = &stepInfo{name: "bad version override", from: stored, to: v}
+	m.cachedVersion = v
+	return m.cachedVersion, nil
+}
+
+// applyOverride replaces the stored version in the database with the version accepted
+// by the bad version handler, if any. It requires that the migrator is locked.
+func (m *Migrator) applyOverride(ctx context.Context) error {
+	if m.override == nil {
+		return nil
+	}
+	log := withLogFields(ctx, m.logger)
+	if err := m.db.DefaultStepFunc(ctx, m.override, false, log); err != nil {
+		return fmt.Errorf("%w: override: %w", ErrBadVersion, err)
+	}
+	log.Warn("database version overridden", F("stored", m.override.from), F("version", m.override.to))
+	m.override = nil
+	return nil
+}
+
+// ForceVersion sets the database version to the version of step ID without executing
+// any migration step and regardless of the stored version.
+func (m *Migrator) ForceVersion(ID int) error {
+	return m.ForceVersionCtx(context.Background(), ID)
+}
+
+// ForceVersionCtx sets the database version to the version of step ID without executing
+// any migration step. The stored version is replaced whatever its ID and checksum. The
+// locker, if any, is held during the change.
+//
+// WARNING: it is intended for an operator repairing a database by hand. The migrator
+// then assumes that the database is in the state reached by the step ID, and the next
+// migration steps may fail or corrupt the database if it isn't.
+func (m *Migrator) ForceVersionCtx(ctx context.Context, ID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return fmt.Errorf("force version: %w", err)
+	}
+	return unlock(m.forceVersion(ctx, ID))
+}
+
+// forceVersion replaces the stored version with the version of step ID. It requires
+// that the migrator is locked.
+func (m *Migrator) forceVersion(ctx context.Context, ID int) error {
+	v, err := m.steps.Version(ID)
+	if err != nil {
+		return fmt.Errorf("force version: %w", err)
+	}
+	m.cachedVersion = badVersion
+	m.override = nil
+	stored, err := m.db.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("force version: %w", err)
+	}
+	// The version is only changed when it is still the stored version.
+	info := &stepInfo{name: "force version", from: stored, to: v}
+	log := withLogFields(ctx, m.logger)
+	if err := m.db.DefaultStepFunc(ctx, info, false, log); err != nil {
+		return fmt.Errorf("force version: %w", err)
+	}
+	log.Warn("database version forced", F("stored", stored), F("version", v))
+	m.cachedVersion = v
+	return nil
+}
+
 func (m *Migrator) initCtx(ctx context.Context, dryRun bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.init(ctx, dryRun)
+}
+
+// init initializes the database version to v0. It requires that the migrator is locked.
+func (m *Migrator) init(ctx context.Context, dryRun bool) error {
 	_, err := m.versionCtx(ctx)
 	if err == nil {
 		return fmt.Errorf("%w as %v", ErrAlreadyInitialized, m.cachedVersion)
 	}
+	if dryRun && m.readOnly {
+		if !errors.Is(err, ErrNotInitialized) {
+			return err
+		}
+		if _, err := m.steps.Version(0); err != nil {
+			return fmt.Errorf("%w: %w", ErrNotInitialized, err)
+		}
+		return nil
+	}
 
 	v, err := m.steps.Version(0)
 	if err != nil {
@@ -83,6 +605,33 @@ func (m *Migrator) initCtx(ctx context.Context, dryRun bool) error {
 	return nil
 }
 
+// Baseline initializes the database version to the version of step targetID after
+// verifying that it is not initialized. It marks an existing database as already migrated
+// up to targetID without executing the migration steps.
+func (m *Migrator) Baseline(targetID int) error {
+	return m.BaselineCtx(context.Background(), targetID)
+}
+
+// BaselineCtx initializes the database version to the version of step targetID after
+// verifying that it is not initialized. It returns ErrAlreadyInitialized if the database
+// is initialized or an error if targetID is not a valid step ID.
+func (m *Migrator) BaselineCtx(ctx context.Context, targetID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, err := m.db.Version(ctx); err == nil {
+		return fmt.Errorf("baseline: %w as %v", ErrAlreadyInitialized, v)
+	}
+	v, err := m.steps.Version(targetID)
+	if err != nil {
+		return fmt.Errorf("baseline: %w", err)
+	}
+	if err := m.db.InitVersion(ctx, v, false); err != nil {
+		return fmt.Errorf("baseline: %w: %w", ErrNotInitialized, err)
+	}
+	m.cachedVersion = v
+	return nil
+}
+
 // Init initializes the database version to v0 after verifying that it is not initialized.
 func (m *Migrator) Init() error {
 	return m.InitCtx(context.Background())
@@ -113,34 +662,50 @@ func (m *Migrator) oneUp(ctx context.Context, dryRun bool) error {
 	if err != nil {
 		return err
 	}
-	if up == nil {
-		err = m.db.DefaultStepFunc(ctx, info, dryRun, m.logger)
-	} else {
-		err = up(ctx, m.db, info, dryRun, m.logger)
+	for retry := 0; ; retry++ {
+		if err = m.runStep(ctx, info, up, dryRun); err == nil {
+			break
+		}
+		if dryRun || retry >= m.casRetries || !errors.Is(err, ErrBadVersion) {
+			return newStepError(info.To().ID, info, err)
+		}
+		v, verr := m.db.Version(ctx)
+		if verr != nil || m.steps.Check(v) != nil {
+			return newStepError(info.To().ID, info, err)
+		}
+		if v.ID >= info.To().ID {
+			withLogFields(ctx, m.logger).Info("migration step applied concurrently", F("name", info.Name()), F("version", v))
+			m.cachedVersion = v
+			return nil
+		}
+		if v != info.From() {
+			return newStepError(info.To().ID, info, err)
+		}
 	}
-	if err == nil && !dryRun {
+	if !dryRun {
 		m.cachedVersion = info.To()
 	}
-	return err
+	return nil
 }
 
 // oneDown attempts to execute one migration step up. It requires that the migrator is locked.
 // It is the user's responsibility to ensure that another migrator doesn't migrate the
 // database at the same time.
 func (m *Migrator) oneDown(ctx context.Context, dryRun bool) error {
+	if m.downDisabled && !(dryRun && m.downDryRun) {
+		return ErrDownDisabled
+	}
 	info, down, err := m.steps.Down(m.cachedVersion)
 	if err != nil {
 		return err
 	}
-	if down == nil {
-		err = m.db.DefaultStepFunc(ctx, info, dryRun, m.logger)
-	} else {
-		err = down(ctx, m.db, info, dryRun, m.logger)
+	if err = m.runStep(ctx, info, down, dryRun); err != nil {
+		return newStepError(info.From().ID, info, err)
 	}
-	if err == nil && !dryRun {
+	if !dryRun {
 		m.cachedVersion = info.To()
 	}
-	return err
+	return nil
 }
 
 // OneUp attempts to execute one migration step up.
@@ -153,9 +718,9 @@ func (m *Migrator) OneUpCtx(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if err := m.oneUp(ctx, false); err != nil {
-		return fmt.Errorf("one up: %w", err)
+		return m.setLastError(fmt.Errorf("one up: %w", err))
 	}
-	return nil
+	return m.setLastError(nil)
 }
 
 // OneDown attempts to execute one migration step down.
@@ -168,9 +733,9 @@ func (m *Migrator) OneDownCtx(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if err := m.oneDown(ctx, false); err != nil {
-		return fmt.Errorf("one down: %w", err)
+		return m.setLastError(fmt.Errorf("one down: %w", err))
 	}
-	return nil
+	return m.setLastError(nil)
 }
 
 // OneUpDryRun attempts to execute one migration step up.
@@ -208,11 +773,103 @@ func (m *Migrator) AllUp() error {
 	return m.AllUpCtx(context.Background())
 }
 
-// AllUpCtx attempts to executes all migration steps up.
+// AllUpCtx attempts to executes all migration steps up. The locker, if any, is held
+// during the whole run.
 func (m *Migrator) AllUpCtx(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return m.setLastError(fmt.Errorf("all up: %w", err))
+	}
+	return m.setLastError(unlock(m.allUp(ctx)))
+}
+
+// ProgressFunc is called by AllUpWithProgress before each migration step with the number
+// of applied steps and the total number of steps of the run.
+type ProgressFunc func(done, total int, info StepInfo)
+
+// AllUpWithProgress executes all the migration steps up like AllUpCtx and calls progress
+// before each step. The total is the number of steps above the database version when the
+// run starts, and done the number of steps applied since then.
+func (m *Migrator) AllUpWithProgress(ctx context.Context, progress ProgressFunc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return m.setLastError(fmt.Errorf("all up: %w", err))
+	}
+	return m.setLastError(unlock(m.allUpProgress(ctx, progress)))
+}
+
+// Setup initializes the database if it is not initialized and executes all the migration
+// steps up. It returns the number of applied steps, which are the applied steps before the
+// failed step when an error is returned. It brings a new database, or a database in any
+// version, up to date. The locker, if any, is held during the whole run.
+func (m *Migrator) Setup(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, m.setLastError(fmt.Errorf("setup: %w", err))
+	}
+	n, err := m.setup(ctx)
+	return n, m.setLastError(unlock(err))
+}
+
+// setup initializes the database if needed and executes all migration steps up. It
+// requires that the migrator is locked.
+func (m *Migrator) setup(ctx context.Context) (int, error) {
+	if err := m.init(ctx, false); err != nil && !errors.Is(err, ErrAlreadyInitialized) {
+		return 0, fmt.Errorf("setup: %w", err)
+	}
+	start := m.cachedVersion.ID
+	if err := m.allUp(ctx); err != nil {
+		return m.cachedVersion.ID - start, fmt.Errorf("setup: %w", err)
+	}
+	return m.cachedVersion.ID - start, nil
+}
+
+// logPlan logs the pending migration steps up.
+func (m *Migrator) logPlan(ctx context.Context) {
+	log := withLogFields(ctx, m.logger)
+	var infos []StepInfo
+	for v := m.cachedVersion; ; {
+		info, _, err := m.steps.Up(v)
+		if err != nil {
+			break
+		}
+		infos = append(infos, info)
+		v = info.To()
+	}
+	log.Info("migration plan", F("from", m.cachedVersion), F("steps", len(infos)))
+	for _, info := range infos {
+		log.Info("planned step", F("name", info.Name()), F("from", info.From()), F("to", info.To()))
+	}
+}
+
+// allUp executes all migration steps up. It requires that the migrator is locked.
+// It stops before the next step when the context is cancelled.
+func (m *Migrator) allUp(ctx context.Context) error {
+	return m.allUpProgress(ctx, nil)
+}
+
+// allUpProgress executes all migration steps up like allUp and calls progress, when not
+// nil, before each step. It requires that the migrator is locked.
+func (m *Migrator) allUpProgress(ctx context.Context, progress ProgressFunc) error {
+	if m.planLog && m.logger.Level() <= LevelInfo {
+		m.logPlan(ctx)
+	}
+	start := m.cachedVersion.ID
 	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("all up: %w", err)
+		}
+		if progress != nil {
+			if info, _, err := m.steps.Up(m.cachedVersion); err == nil {
+				progress(info.From().ID-start, m.steps.Len()-1-start, info)
+			}
+		}
 		if err := m.oneUp(ctx, false); err != nil {
 			if errors.Is(err, ErrEndOfSteps) {
 				return nil
@@ -222,16 +879,114 @@ func (m *Migrator) AllUpCtx(ctx context.Context) error {
 	}
 }
 
+// Redo executes the migration step down of the database version followed by its migration
+// step up. It returns ErrEndOfSteps if the database version is v0.
+func (m *Migrator) Redo() error {
+	return m.RedoCtx(context.Background())
+}
+
+// RedoCtx executes the migration step down of the database version followed by its
+// migration step up. It returns ErrEndOfSteps if the database version is v0. When the
+// step up fails, it is rolled back and the database remains in the version below the
+// original version. The locker, if any, is held during the whole run.
+func (m *Migrator) RedoCtx(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return m.setLastError(fmt.Errorf("redo: %w", err))
+	}
+	return m.setLastError(unlock(m.redo(ctx)))
+}
+
+// redo executes one migration step down followed by one migration step up. It requires
+// that the migrator is locked.
+func (m *Migrator) redo(ctx context.Context) error {
+	if err := m.oneDown(ctx, false); err != nil {
+		return fmt.Errorf("redo: %w", err)
+	}
+	if err := m.oneUp(ctx, false); err != nil {
+		return fmt.Errorf("redo: database left in %v: %w", m.cachedVersion, err)
+	}
+	return nil
+}
+
+// Interactive executes the migration steps up one at a time after the confirm function
+// returned true for it. It stops at the first step for which confirm returns false, when
+// all steps are executed or when the context is cancelled. The locker, if any, is held
+// during the whole run.
+func (m *Migrator) Interactive(ctx context.Context, confirm func(info StepInfo) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return m.setLastError(fmt.Errorf("interactive: %w", err))
+	}
+	return m.setLastError(unlock(m.interactive(ctx, confirm)))
+}
+
+// interactive executes the confirmed migration steps up. It requires that the migrator
+// is locked.
+func (m *Migrator) interactive(ctx context.Context, confirm func(info StepInfo) bool) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("interactive: %w", err)
+		}
+		info, _, err := m.steps.Up(m.cachedVersion)
+		if err != nil {
+			if errors.Is(err, ErrEndOfSteps) {
+				return nil
+			}
+			return fmt.Errorf("interactive: %w", err)
+		}
+		if !confirm(info) {
+			return nil
+		}
+		if err := m.oneUp(ctx, false); err != nil {
+			return fmt.Errorf("interactive: %w", err)
+		}
+	}
+}
+
 // AllDown attempts to executes all migration steps down.
 func (m *Migrator) AllDown() error {
 	return m.AllDownCtx(context.Background())
 }
 
-// AllDownCtx attempts to executes all migration steps down.
+// AllDownCtx attempts to executes all migration steps down. The locker, if any, is held
+// during the whole run. It returns ErrConfirmationRequired when the migrator has a
+// destructive guard.
 func (m *Migrator) AllDownCtx(ctx context.Context) error {
+	return m.allDownConfirmed(ctx, "")
+}
+
+// AllDownConfirmed attempts to executes all migration steps down when token matches the
+// token of the destructive guard, otherwise it returns ErrConfirmationRequired. The
+// token is ignored when the migrator has no destructive guard.
+func (m *Migrator) AllDownConfirmed(ctx context.Context, token string) error {
+	return m.allDownConfirmed(ctx, token)
+}
+
+func (m *Migrator) allDownConfirmed(ctx context.Context, token string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if m.guardToken != "" && token != m.guardToken {
+		return fmt.Errorf("all down: %w", ErrConfirmationRequired)
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return m.setLastError(fmt.Errorf("all down: %w", err))
+	}
+	return m.setLastError(unlock(m.allDown(ctx)))
+}
+
+// allDown executes all migration steps down. It requires that the migrator is locked.
+// It stops before the next step when the context is cancelled.
+func (m *Migrator) allDown(ctx context.Context) error {
 	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("all down: %w", err)
+		}
 		if err := m.oneDown(ctx, false); err != nil {
 			if errors.Is(err, ErrEndOfSteps) {
 				return nil
@@ -240,3 +995,132 @@ func (m *Migrator) AllDownCtx(ctx context.Context) error {
 		}
 	}
 }
+
+// StepStatus is the status of a migration step relative to the database version.
+type StepStatus struct {
+	ID      int     // ID is the step identifier.
+	Name    string  // Name is the step name.
+	Version Version // Version is the version of the database after the step.
+	Applied bool    // Applied is true when the step is applied to the database.
+
+	// Transactional is true when the step function up executes in a transaction, like
+	// with Tx or TxF. It is false for NoTx, NoTxF and the user defined step functions as
+	// reported by DescribeStep.
+	Transactional bool
+
+	// Skipped is the reason why the step function up is not executed and the step only
+	// changes the version, like SkipFilteredByTag with StatusTagged. It is empty when the
+	// step function is executed.
+	Skipped string
+}
+
+// Status returns the status of all migration steps without executing any of them.
+func (m *Migrator) Status() ([]StepStatus, error) {
+	return m.StatusCtx(context.Background())
+}
+
+// StatusCtx returns the status of all migration steps without executing any of them.
+// A step is applied when its ID is lower or equal to the database version ID.
+func (m *Migrator) StatusCtx(ctx context.Context) ([]StepStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status(ctx)
+}
+
+// status returns the status of all migration steps. It requires that the migrator is
+// locked.
+func (m *Migrator) status(ctx context.Context) ([]StepStatus, error) {
+	dbv, err := m.versionCtx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("status: %w", err)
+	}
+	status := make([]StepStatus, m.steps.Len())
+	for ID := range status {
+		v, err := m.steps.Version(ID)
+		if err != nil {
+			return nil, fmt.Errorf("status: %w", err)
+		}
+		name, err := m.steps.Name(ID)
+		if err != nil {
+			return nil, fmt.Errorf("status: %w", err)
+		}
+		status[ID] = StepStatus{ID: ID, Name: name, Version: v, Applied: ID <= dbv.ID}
+		if ID > 0 {
+			prev, err := m.steps.Version(ID - 1)
+			if err != nil {
+				return nil, fmt.Errorf("status: %w", err)
+			}
+			_, up, err := m.steps.Up(prev)
+			if err != nil {
+				return nil, fmt.Errorf("status: %w", err)
+			}
+			if status[ID].Skipped = skipReason(m.steps, ID); status[ID].Skipped != "" {
+				up = m.defaultStep
+			}
+			status[ID].Transactional = DescribeStep(up) == StepTx
+		}
+	}
+	return status, nil
+}
+
+// AssertUpToDate returns ErrPendingMigrations if the database version is below the last
+// migration step. It doesn't execute any migration step.
+func (m *Migrator) AssertUpToDate() error {
+	return m.AssertUpToDateCtx(context.Background())
+}
+
+// AssertUpToDateCtx returns ErrPendingMigrations listing the names of the pending steps
+// if the database version is below the last migration step. It doesn't execute any
+// migration step. It is intended for applications whose migrations are applied out of
+// band and that must refuse to start with a database behind the code.
+func (m *Migrator) AssertUpToDateCtx(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dbv, err := m.versionCtx(ctx)
+	if err != nil {
+		return fmt.Errorf("assert up to date: %w", err)
+	}
+	var pending []string
+	for ID := dbv.ID + 1; ID < m.steps.Len(); ID++ {
+		name, err := m.steps.Name(ID)
+		if err != nil {
+			return fmt.Errorf("assert up to date: %w", err)
+		}
+		pending = append(pending, fmt.Sprintf("'%s'", name))
+	}
+	if len(pending) != 0 {
+		return fmt.Errorf("%w: %s", ErrPendingMigrations, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Pending returns the number of migration steps up between the database version and the
+// last migration step.
+func (m *Migrator) Pending() (int, error) {
+	return m.PendingCtx(context.Background())
+}
+
+// PendingCtx returns the number of migration steps up between the database version and
+// the last migration step. It returns ErrBadVersion if the database version is not found
+// in the migration steps.
+func (m *Migrator) PendingCtx(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dbv, err := m.versionCtx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("pending: %w", err)
+	}
+	return m.steps.Len() - 1 - dbv.ID, nil
+}
+
+// IsUpToDate returns true if the database version is the last migration step.
+func (m *Migrator) IsUpToDate() (bool, error) {
+	return m.IsUpToDateCtx(context.Background())
+}
+
+// IsUpToDateCtx returns true if the database version is the last migration step. It
+// returns ErrBadVersion if the database version is not found in the migration steps.
+func (m *Migrator) IsUpToDateCtx(ctx context.Context) (bool, error) {
+	n, err := m.PendingCtx(ctx)
+	return err == nil && n == 0, err
+}
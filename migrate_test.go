@@ -1,10 +1,17 @@
 package migrate
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
 )
 
 // Mock types
@@ -381,3 +388,1220 @@ func TestMigrator(t *testing.T) {
 		})
 	}
 }
+
+func TestMigratorStatus(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 1}}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []StepStatus{
+		{ID: 0, Name: "step 0", Version: Version{ID: 0}, Applied: true},
+		{ID: 1, Name: "step 1", Version: Version{ID: 1}, Applied: true},
+		{ID: 2, Name: "step 2", Version: Version{ID: 2}, Applied: false},
+	}
+	if !slices.Equal(status, exp) {
+		t.Fatalf("expect %v, got %v", exp, status)
+	}
+
+	db.versionErr = errMock
+	if _, err := m.Status(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+}
+
+type mockLocker struct {
+	locked    bool
+	lockErr   error
+	unlockErr error
+}
+
+func (l *mockLocker) Lock(ctx context.Context) error {
+	if l.lockErr != nil {
+		return l.lockErr
+	}
+	l.locked = true
+	return nil
+}
+
+func (l *mockLocker) Unlock(ctx context.Context) error {
+	l.locked = false
+	return l.unlockErr
+}
+
+func TestMigratorLocker(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	locker := &mockLocker{}
+	var lockedDuringStep bool
+	stepFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		lockedDuringStep = locker.locked
+		return db.DefaultStepFunc(ctx, info, dryRun, log)
+	}
+	steps := &mockStepper{[]StepFunc{nil, stepFunc, stepFunc}}
+	m, err := New(db, steps, nil, WithLocker(locker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if !lockedDuringStep || locker.locked {
+		t.Fatalf("expect locked during step and unlocked after run")
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect version 2, got %v", db.version)
+	}
+
+	locker.lockErr = ErrMigrationLocked
+	if err := m.AllDown(); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("expect %v, got %v", ErrMigrationLocked, err)
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect version 2, got %v", db.version)
+	}
+	locker.lockErr = nil
+
+	locker.unlockErr = errMock
+	if err := m.AllDown(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if db.version.ID != 0 {
+		t.Fatalf("expect version 0, got %v", db.version)
+	}
+}
+
+func TestMigratorAssertUpToDate(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.AssertUpToDate()
+	if !errors.Is(err, ErrPendingMigrations) {
+		t.Fatalf("expect %v, got %v", ErrPendingMigrations, err)
+	}
+	if exp := "pending migrations: 'step 1', 'step 2'"; err.Error() != exp {
+		t.Fatalf("expect %q, got %q", exp, err)
+	}
+
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AssertUpToDate(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.versionErr = errMock
+	if err := m.AssertUpToDate(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+}
+
+func TestMigratorStepError(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	failFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		return errMock
+	}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, failFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.AllUp()
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("expect step error, got %v", err)
+	}
+	if stepErr.StepID != 2 || stepErr.StepName != "step 2" || stepErr.From.ID != 1 || stepErr.To.ID != 2 {
+		t.Fatalf("unexpected step error %+v", stepErr)
+	}
+	if !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if exp := "all up: step 2 'step 2': mock error"; err.Error() != exp {
+		t.Fatalf("expect %q, got %q", exp, err)
+	}
+
+	err = m.OneDown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.OneDown()
+	if !errors.Is(err, ErrEndOfSteps) {
+		t.Fatalf("expect %v, got %v", ErrEndOfSteps, err)
+	}
+	if errors.As(err, &stepErr) {
+		t.Fatalf("unexpected step error %v", err)
+	}
+
+	steps.steps[1] = failFunc
+	db.version = Version{ID: 1}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	err = m.OneDown()
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("expect step error, got %v", err)
+	}
+	if stepErr.StepID != 1 || stepErr.From.ID != 1 || stepErr.To.ID != 0 {
+		t.Fatalf("unexpected step error %+v", stepErr)
+	}
+}
+
+func TestMigratorPending(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := m.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expect 2, got %d", n)
+	}
+	ok, err := m.IsUpToDate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expect not up to date")
+	}
+
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	n, err = m.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expect 0, got %d", n)
+	}
+	ok, err = m.IsUpToDate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expect up to date")
+	}
+
+	db.version = Version{ID: 10}
+	if _, err := m.Pending(); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", ErrBadVersion, err)
+	}
+	if ok, err := m.IsUpToDate(); ok || !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", ErrBadVersion, err)
+	}
+
+	s := NewSteps("test-db")
+	m, err = New(&mockDatabase{version: Version{ID: 0}}, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Pending()
+	if !errors.Is(err, ErrBadVersion) || !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v and %v, got %v", ErrBadVersion, ErrBadVersionChecksum, err)
+	}
+}
+
+func TestMigratorLastError(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	fail := true
+	failFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		if fail {
+			return errMock
+		}
+		return mockFunc(ctx, db, info, dryRun, log)
+	}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, failFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LastError(); err != nil {
+		t.Fatalf("expect nil, got %v", err)
+	}
+
+	err = m.AllUp()
+	if err == nil {
+		t.Fatal("expect error")
+	}
+	if m.LastError() != err {
+		t.Fatalf("expect %v, got %v", err, m.LastError())
+	}
+
+	if err := m.OneUpDryRun(); err == nil {
+		t.Fatal("expect error")
+	}
+	if m.LastError() != err {
+		t.Fatalf("expect %v, got %v", err, m.LastError())
+	}
+
+	fail = false
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LastError(); err != nil {
+		t.Fatalf("expect nil, got %v", err)
+	}
+	if err := m.OneUp(); !errors.Is(err, ErrEndOfSteps) {
+		t.Fatalf("expect %v, got %v", ErrEndOfSteps, err)
+	}
+	if err := m.LastError(); err != nil {
+		t.Fatalf("expect nil, got %v", err)
+	}
+}
+
+func TestMigratorCancel(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		cancel()
+		return mockFunc(ctx, db, info, dryRun, log)
+	}
+	steps := &mockStepper{[]StepFunc{nil, cancelFunc, mockFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.AllUpCtx(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = m.AllDownCtx(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+}
+
+func TestMigratorHooks(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	failFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		time.Sleep(time.Millisecond)
+		return errMock
+	}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, failFunc}}
+	var calls []string
+	m, err := New(db, steps, nil, WithHooks(Hooks{
+		BeforeStep: func(info StepInfo, dryRun bool) {
+			calls = append(calls, fmt.Sprintf("before %s %t", info.Name(), dryRun))
+		},
+		AfterStep: func(info StepInfo, dryRun bool, err error, d time.Duration) {
+			calls = append(calls, fmt.Sprintf("after %s %t %v", info.Name(), dryRun, err))
+			if info.Name() == "step 2" && d < time.Millisecond {
+				t.Errorf("expect duration >= 1ms, got %v", d)
+			}
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUpDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	exp := []string{
+		"before step 1 true", "after step 1 true <nil>",
+		"before step 1 false", "after step 1 false <nil>",
+		"before step 2 false", "after step 2 false mock error",
+	}
+	if !slices.Equal(calls, exp) {
+		t.Fatalf("expect %q, got %q", exp, calls)
+	}
+}
+
+func TestMigratorQuietNoLog(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.New(&buf, "", 0)
+	hooks := Hooks{
+		BeforeStep: func(info StepInfo, dryRun bool) {
+			out.Printf("before %s", info.Name())
+		},
+		AfterStep: func(info StepInfo, dryRun bool, err error, d time.Duration) {
+			out.Printf("after %s", info.Name())
+		},
+	}
+	run := func(hooks Hooks, level LogLevel, options ...Option) string {
+		buf.Reset()
+		db := &mockDatabase{version: Version{ID: 0}}
+		options = append(options, WithHooks(hooks))
+		m, err := New(db, &mockStepper{[]StepFunc{nil, mockFunc}}, NewLogLoggerWith(out, level), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Version(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.AllUp(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if got := run(hooks, LevelNoLog, WithQuietNoLog()); got != "" {
+		t.Fatalf("expect no output, got %q", got)
+	}
+	if got := run(hooks, LevelNoLog); got != "before step 1\nafter step 1\n" {
+		t.Fatalf("expect hook output, got %q", got)
+	}
+	if got := run(hooks, LevelError, WithQuietNoLog()); got != "before step 1\nafter step 1\n" {
+		t.Fatalf("expect hook output, got %q", got)
+	}
+	hooks.Independent = true
+	if got := run(hooks, LevelNoLog, WithQuietNoLog()); got != "before step 1\nafter step 1\n" {
+		t.Fatalf("expect hook output, got %q", got)
+	}
+}
+
+func TestMigratorIrreversible(t *testing.T) {
+	s := NewSteps("test")
+	s.Append("step 1", nil, nil)
+	s.Append("step 2", nil, Irreversible)
+	v0, _ := s.Version(0)
+	db := &mockDatabase{version: v0}
+	m, err := New(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	err = m.AllDown()
+	if !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("expect %v, got %v", ErrIrreversible, err)
+	}
+	if !strings.Contains(err.Error(), "step 'step 2'") {
+		t.Fatalf("expect step name in error, got %v", err)
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect v2, got %v", db.version)
+	}
+}
+
+func TestMigratorStepTimeout(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	slowFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		<-ctx.Done()
+		return errMock
+	}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, slowFunc}}
+	m, err := New(db, steps, nil, WithStepTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	err = m.AllUp()
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, errMock) {
+		t.Fatalf("expect %v and %v, got %v", errMock, context.DeadlineExceeded, err)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+}
+
+func TestMigratorDefaultStepFunc(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	var names []string
+	defaultFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		names = append(names, info.Name())
+		if info.To().ID == 2 {
+			return errMock
+		}
+		return db.DefaultStepFunc(ctx, info, dryRun, log)
+	}
+	steps := &mockStepper{[]StepFunc{nil, nil, nil}}
+	m, err := New(db, steps, nil, WithDefaultStepFunc(defaultFunc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+	if exp := []string{"step 1", "step 2"}; !slices.Equal(names, exp) {
+		t.Fatalf("expect %v, got %v", exp, names)
+	}
+}
+
+func TestMigratorCASRetry(t *testing.T) {
+	// raceFunc simulates another process applying the step concurrently.
+	raceFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		db.(*mockDatabase).version = info.To()
+		return ErrBadVersion
+	}
+	db := &mockDatabase{version: Version{ID: 0}}
+	m, err := New(db, &mockStepper{[]StepFunc{nil, raceFunc, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", ErrBadVersion, err)
+	}
+
+	db = &mockDatabase{version: Version{ID: 0}}
+	m, err = New(db, &mockStepper{[]StepFunc{nil, raceFunc, mockFunc}}, nil, WithCASRetry(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect v2, got %v", db.version)
+	}
+
+	// The step is executed again while the version is unchanged.
+	var calls int
+	failFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		calls++
+		return ErrBadVersion
+	}
+	db = &mockDatabase{version: Version{ID: 0}}
+	m, err = New(db, &mockStepper{[]StepFunc{nil, failFunc}}, nil, WithCASRetry(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", ErrBadVersion, err)
+	}
+	if calls != 4 {
+		t.Fatalf("expect 4 calls, got %d", calls)
+	}
+	calls = 0
+	if err := m.OneUpDryRun(); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", ErrBadVersion, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expect 1 call, got %d", calls)
+	}
+}
+
+func TestMigratorReadOnlyVersionCheck(t *testing.T) {
+	db := &mockDatabase{versionErr: ErrNotInitialized, initError: errMock}
+	var dbs []Database
+	recordFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		dbs = append(dbs, db)
+		return nil
+	}
+	steps := &mockStepper{[]StepFunc{nil, recordFunc, nil}}
+	m, err := New(db, steps, nil, WithReadOnlyVersionCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.InitDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	db.versionErr = errMock
+	if err := m.InitDryRun(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+
+	db.versionErr, db.initError = nil, nil
+	db.initialized = true
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	db.setVersionErr = errMock
+	if err := m.OneUpDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if len(dbs) != 1 || dbs[0] != (planDB{}) {
+		t.Fatalf("expect step called with plan database, got %v", dbs)
+	}
+	db.version = Version{ID: 1}
+	if err := m.OneUpDryRun(); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", ErrBadVersion, err)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if len(dbs) != 2 || dbs[1] != db {
+		t.Fatalf("expect step called with database, got %v", dbs)
+	}
+}
+
+func TestMigratorIsAtBaseline(t *testing.T) {
+	db := &mockDatabase{versionErr: ErrNotInitialized}
+	m, err := New(db, &mockStepper{[]StepFunc{nil, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := m.IsAtBaseline(); ok || !errors.Is(err, ErrNotInitialized) {
+		t.Fatalf("expect %v, got %t %v", ErrNotInitialized, ok, err)
+	}
+	db.versionErr = nil
+	if ok, err := m.IsAtBaseline(); !ok || err != nil {
+		t.Fatalf("expect true, got %t %v", ok, err)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := m.IsAtBaseline(); ok || err != nil {
+		t.Fatalf("expect false, got %t %v", ok, err)
+	}
+}
+
+func TestMigratorAllUpWithProgress(t *testing.T) {
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc, mockFunc, mockFunc}}
+	v1, _ := steps.Version(1)
+	db := &mockDatabase{version: v1}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	progress := func(done, total int, info StepInfo) {
+		got = append(got, fmt.Sprintf("%d/%d %s", done, total, info.Name()))
+	}
+	if err := m.AllUpWithProgress(context.Background(), progress); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"0/3 step 2", "1/3 step 3", "2/3 step 4"}; !slices.Equal(got, exp) {
+		t.Fatalf("expect %v, got %v", exp, got)
+	}
+	if db.version.ID != 4 {
+		t.Fatalf("expect v4, got %v", db.version)
+	}
+
+	got = nil
+	db.version, _ = steps.Version(2)
+	db.setVersionErr = errMock
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUpWithProgress(context.Background(), progress); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if exp := []string{"0/2 step 3"}; !slices.Equal(got, exp) {
+		t.Fatalf("expect %v, got %v", exp, got)
+	}
+}
+
+type closerDatabase struct {
+	mockDatabase
+	closed int
+}
+
+func (db *closerDatabase) Close() error {
+	db.closed++
+	return errMock
+}
+
+func TestMigratorClose(t *testing.T) {
+	db := &closerDatabase{}
+	m, err := New(db, &mockStepper{[]StepFunc{nil}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if err := m.Close(); err != nil || db.closed != 1 {
+		t.Fatalf("expect 1 close, got %d %v", db.closed, err)
+	}
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectClose()
+	m, err = New(NewSQLDB(mockDB, mockQ), &mockStepper{[]StepFunc{nil}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigratorSetup(t *testing.T) {
+	ctx := context.Background()
+	db := &mockDatabase{versionErr: ErrNotInitialized}
+	m, err := New(db, &mockStepper{[]StepFunc{nil, mockFunc, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Setup(ctx); n != 2 || err != nil {
+		t.Fatalf("expect 2 steps, got %d %v", n, err)
+	}
+	if !db.initialized || db.version.ID != 2 {
+		t.Fatalf("expect initialized v2, got %t %v", db.initialized, db.version)
+	}
+	db.versionErr = nil
+	if n, err := m.Setup(ctx); n != 0 || err != nil {
+		t.Fatalf("expect 0 steps, got %d %v", n, err)
+	}
+
+	m, err = New(db, &mockStepper{[]StepFunc{nil, mockFunc, mockFunc, mockFunc, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Setup(ctx); n != 2 || err != nil {
+		t.Fatalf("expect 2 steps, got %d %v", n, err)
+	}
+
+	db.version = Version{ID: 2}
+	db.setVersionErr = errMock
+	if n, err := m.Setup(ctx); n != 0 || !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %d %v", errMock, n, err)
+	}
+	if !errors.Is(m.LastError(), errMock) {
+		t.Fatalf("expect last error %v, got %v", errMock, m.LastError())
+	}
+
+	db = &mockDatabase{versionErr: ErrNotInitialized, initError: errMock}
+	m, err = New(db, &mockStepper{[]StepFunc{nil, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Setup(ctx); n != 0 || !errors.Is(err, ErrNotInitialized) {
+		t.Fatalf("expect %v, got %d %v", ErrNotInitialized, n, err)
+	}
+}
+
+func TestMigratorBadVersionHandler(t *testing.T) {
+	checkFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		if v, err := db.Version(ctx); err != nil || v != info.From() {
+			return fmt.Errorf("%w: db is %v", ErrBadVersion, v)
+		}
+		return db.DefaultStepFunc(ctx, info, dryRun, log)
+	}
+	s := NewSteps("test")
+	_ = s.Append("step 1", mockFunc, mockFunc)
+	_ = s.Append("step 2", checkFunc, mockFunc)
+	v1, _ := s.Version(1)
+	v2, _ := s.Version(2)
+	stored := Version{ID: 1, Checksum: [32]byte{1}}
+	db := &mockDatabase{version: stored, initialized: true}
+
+	var handled Version
+	refuse := func(v Version, err error) error {
+		handled = v
+		if !errors.Is(err, ErrBadVersionChecksum) {
+			t.Fatalf("expect %v, got %v", ErrBadVersionChecksum, err)
+		}
+		return errMock
+	}
+	m, err := New(db, s, nil, WithBadVersionHandler(refuse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); !errors.Is(err, errMock) || !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if handled != stored || db.version != stored {
+		t.Fatalf("expect %v, got %v and %v", stored, handled, db.version)
+	}
+
+	accept := func(v Version, err error) error { return nil }
+	m, err = New(db, s, nil, WithBadVersionHandler(accept), WithReadOnlyVersionCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Version(); err != nil || v != v1 {
+		t.Fatalf("expect %v, got %v %v", v1, v, err)
+	}
+	if db.version != stored {
+		t.Fatalf("expect %v, got %v", stored, db.version)
+	}
+	if err := m.OneUpDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version != stored {
+		t.Fatalf("expect %v, got %v", stored, db.version)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version != v2 {
+		t.Fatalf("expect %v, got %v", v2, db.version)
+	}
+
+	db.version = Version{ID: 5, Checksum: [32]byte{1}}
+	if _, err := m.Version(); !errors.Is(err, ErrDatabaseAhead) {
+		t.Fatalf("expect %v, got %v", ErrDatabaseAhead, err)
+	}
+}
+
+func TestMigratorDatabaseAhead(t *testing.T) {
+	steps := NewSteps("test")
+	steps.Append("step 1", nil, nil)
+	steps.Append("step 2", nil, nil)
+	db := &mockDatabase{version: Version{ID: 3, Checksum: [32]byte{1}}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); !errors.Is(err, ErrDatabaseAhead) || !errors.Is(err, ErrBadVersion) || errors.Is(err, ErrBadVersionID) {
+		t.Fatalf("expect %v, got %v", ErrDatabaseAhead, err)
+	}
+	db.version = Version{ID: -1}
+	if _, err := m.Version(); errors.Is(err, ErrDatabaseAhead) || !errors.Is(err, ErrBadVersionID) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionID, err)
+	}
+}
+
+func TestMigratorForceVersion(t *testing.T) {
+	steps := NewSteps("test")
+	steps.Append("step 1", nil, nil)
+	steps.Append("step 2", nil, nil)
+	v2, _ := steps.Version(2)
+	bad := Version{ID: 1, Checksum: [32]byte{1}}
+	db := &forceDatabase{mockDatabase: mockDatabase{version: bad}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionChecksum, err)
+	}
+	if err := m.ForceVersion(2); err != nil {
+		t.Fatal(err)
+	}
+	if db.version != v2 || db.from != bad {
+		t.Fatalf("expect %v from %v, got %v from %v", v2, bad, db.version, db.from)
+	}
+	if v, err := m.Version(); err != nil || v != v2 {
+		t.Fatalf("expect %v, got %v %v", v2, v, err)
+	}
+	if err := m.ForceVersion(3); !errors.Is(err, ErrBadVersionID) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionID, err)
+	}
+	db.setVersionErr = errMock
+	if err := m.ForceVersion(1); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+}
+
+// forceDatabase is a mockDatabase recording the version replaced by DefaultStepFunc.
+type forceDatabase struct {
+	mockDatabase
+	from Version
+}
+
+func (m *forceDatabase) DefaultStepFunc(ctx context.Context, info StepInfo, dryRun bool, log Logger) error {
+	if m.setVersionErr == nil && !dryRun {
+		m.from = info.From()
+	}
+	return m.mockDatabase.DefaultStepFunc(ctx, info, dryRun, log)
+}
+
+func TestMigratorRawVersion(t *testing.T) {
+	bad := Version{ID: 5, Checksum: [32]byte{1}}
+	db := &mockDatabase{version: bad}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", ErrBadVersion, err)
+	}
+	v, err := m.RawVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != bad {
+		t.Fatalf("expect %v, got %v", bad, v)
+	}
+	if m.cachedVersion != badVersion {
+		t.Fatalf("expect bad cached version, got %v", m.cachedVersion)
+	}
+	db.versionErr = errMock
+	if _, err := m.RawVersion(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+}
+
+type ctxKey struct{}
+
+func TestMigratorStepWrapper(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	var calls []string
+	checkFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		calls = append(calls, fmt.Sprintf("step %v", ctx.Value(ctxKey{})))
+		return errMock
+	}
+	steps := &mockStepper{[]StepFunc{nil, checkFunc}}
+	wrapper := func(name string) StepWrapper {
+		return func(ctx context.Context, info StepInfo, dryRun bool, step func(context.Context) error) error {
+			calls = append(calls, "enter "+name)
+			err := step(context.WithValue(ctx, ctxKey{}, name))
+			calls = append(calls, fmt.Sprintf("exit %s %v", name, err))
+			return err
+		}
+	}
+	m, err := New(db, steps, nil, WithStepWrapper(wrapper("outer")), WithStepWrapper(nil), WithStepWrapper(wrapper("inner")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	exp := []string{"enter outer", "enter inner", "step inner", "exit inner mock error", "exit outer mock error"}
+	if !slices.Equal(calls, exp) {
+		t.Fatalf("expect %q, got %q", exp, calls)
+	}
+}
+
+func TestMigratorInteractive(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc, mockFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	err = m.Interactive(context.Background(), func(info StepInfo) bool {
+		names = append(names, info.Name())
+		return info.To().ID < 3
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"step 1", "step 2", "step 3"}; !slices.Equal(names, exp) {
+		t.Fatalf("expect %q, got %q", exp, names)
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect v2, got %v", db.version)
+	}
+
+	err = m.Interactive(context.Background(), func(info StepInfo) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 3 {
+		t.Fatalf("expect v3, got %v", db.version)
+	}
+
+	db.setVersionErr = errMock
+	m.cachedVersion = Version{ID: 2}
+	err = m.Interactive(context.Background(), func(info StepInfo) bool { return true })
+	if !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+}
+
+func TestMigratorDestructiveGuard(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 2}}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc}}
+	m, err := New(db, steps, nil, WithDestructiveGuard("drop it"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllDown(); !errors.Is(err, ErrConfirmationRequired) {
+		t.Fatalf("expect %v, got %v", ErrConfirmationRequired, err)
+	}
+	if err := m.AllDownConfirmed(context.Background(), "wrong"); !errors.Is(err, ErrConfirmationRequired) {
+		t.Fatalf("expect %v, got %v", ErrConfirmationRequired, err)
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect v2, got %v", db.version)
+	}
+	if err := m.AllDownConfirmed(context.Background(), "drop it"); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 0 {
+		t.Fatalf("expect v0, got %v", db.version)
+	}
+
+	db.version = Version{ID: 2}
+	m, err = New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllDown(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 0 {
+		t.Fatalf("expect v0, got %v", db.version)
+	}
+}
+
+func TestMigratorAllowDown(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 2}}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc}}
+	m, err := New(db, steps, nil, WithAllowDown(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneDown(); !errors.Is(err, ErrDownDisabled) {
+		t.Fatalf("expect %v, got %v", ErrDownDisabled, err)
+	}
+	if err := m.AllDown(); !errors.Is(err, ErrDownDisabled) {
+		t.Fatalf("expect %v, got %v", ErrDownDisabled, err)
+	}
+	if err := m.Redo(); !errors.Is(err, ErrDownDisabled) {
+		t.Fatalf("expect %v, got %v", ErrDownDisabled, err)
+	}
+	if err := m.OneDownDryRun(); !errors.Is(err, ErrDownDisabled) {
+		t.Fatalf("expect %v, got %v", ErrDownDisabled, err)
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect v2, got %v", db.version)
+	}
+
+	m, err = New(db, steps, nil, WithAllowDown(false), WithAllowDownDryRun(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneDownDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneDown(); !errors.Is(err, ErrDownDisabled) {
+		t.Fatalf("expect %v, got %v", ErrDownDisabled, err)
+	}
+
+	m, err = New(db, steps, nil, WithAllowDown(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneDown(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+}
+
+func TestMigratorPlanLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogLoggerWith(log.New(&buf, "", 0), LevelInfo)
+	logFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		log.Info("executing", F("name", info.Name()))
+		return db.DefaultStepFunc(ctx, info, dryRun, log)
+	}
+	db := &mockDatabase{version: Version{ID: 1}}
+	steps := &mockStepper{[]StepFunc{nil, logFunc, logFunc, logFunc}}
+	m, err := New(db, steps, logger, WithPlanLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expect 5 lines, got %q", lines)
+	}
+	exp := []string{"migration plan", "planned step | name='step 2'", "planned step | name='step 3'", "executing | name='step 2'", "executing | name='step 3'"}
+	for i := range exp {
+		if !strings.Contains(lines[i], exp[i]) {
+			t.Fatalf("expect line %d to contain %q, got %q", i, exp[i], lines[i])
+		}
+	}
+
+	buf.Reset()
+	db.version = Version{ID: 1}
+	m, err = New(db, steps, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "plan") {
+		t.Fatalf("unexpected plan log %q", buf.String())
+	}
+}
+
+func TestMigratorRedo(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 2}}
+	var calls []string
+	logFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		calls = append(calls, fmt.Sprintf("%d->%d", info.From().ID, info.To().ID))
+		return db.DefaultStepFunc(ctx, info, dryRun, log)
+	}
+	steps := &mockStepper{[]StepFunc{nil, logFunc, logFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"2->1", "1->2"}; !slices.Equal(calls, exp) {
+		t.Fatalf("expect %q, got %q", exp, calls)
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect v2, got %v", db.version)
+	}
+
+	steps.steps[2] = func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		if info.To().ID == 2 {
+			return errMock
+		}
+		return db.DefaultStepFunc(ctx, info, dryRun, log)
+	}
+	if err := m.Redo(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+
+	db.version = Version{ID: 0}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Redo(); !errors.Is(err, ErrEndOfSteps) {
+		t.Fatalf("expect %v, got %v", ErrEndOfSteps, err)
+	}
+}
+
+func TestMigratorBaseline(t *testing.T) {
+	db := &mockDatabase{versionErr: ErrNotInitialized}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc, mockFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Baseline(4); err == nil {
+		t.Fatal("expect error")
+	}
+	if err := m.Baseline(2); err != nil {
+		t.Fatal(err)
+	}
+	if !db.initialized || db.version.ID != 2 {
+		t.Fatalf("expect initialized v2, got %v", db.version)
+	}
+
+	db.versionErr = nil
+	if err := m.Baseline(2); !errors.Is(err, ErrAlreadyInitialized) {
+		t.Fatalf("expect %v, got %v", ErrAlreadyInitialized, err)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 3 {
+		t.Fatalf("expect v3, got %v", db.version)
+	}
+}
+
+func TestMigratorVersionStringAndID(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 1}}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc}}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str, err := m.VersionString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := (Version{ID: 1}).String(); str != exp {
+		t.Fatalf("expect %q, got %q", exp, str)
+	}
+	id, err := m.VersionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Fatalf("expect 1, got %d", id)
+	}
+
+	db.version = Version{ID: 10}
+	if str, err := m.VersionString(); !errors.Is(err, ErrBadVersion) || str != "" {
+		t.Fatalf("expect %v, got %q, %v", ErrBadVersion, str, err)
+	}
+	if id, err := m.VersionID(); !errors.Is(err, ErrBadVersion) || id != -1 {
+		t.Fatalf("expect %v, got %d, %v", ErrBadVersion, id, err)
+	}
+}
@@ -0,0 +1,277 @@
+// Package migratecli is a command line interface migrating a database with the given
+// migration steps. It is intended to be called from the main function of an application:
+//
+//	func main() {
+//		if err := migratecli.RunCLI(steps, os.Args[1:]); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// The database backend is selected by the scheme of the -dsn URL: sqlite://, postgres://,
+// mysql://, sqlserver:// or cockroachdb://.
+package migratecli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/chmike/migrate"
+	_ "github.com/chmike/migrate/cockroach"
+	_ "github.com/chmike/migrate/mssql"
+	_ "github.com/chmike/migrate/mysql"
+	_ "github.com/chmike/migrate/postgres"
+	_ "github.com/chmike/migrate/sqlite"
+)
+
+const usage = `usage: [flags] command
+
+commands:
+  up        execute all the pending migration steps, or one with -one
+  down      undo all the migration steps, or one with -one
+  to N      migrate up or down to the version N
+  force N   set the database version to N without executing steps (repair only)
+  status    list the migration steps, whether they are applied and no-tx when not transactional
+  version   print the database version
+
+flags:
+`
+
+// logLevels are the log levels accepted by the -log-level flag.
+var logLevels = map[string]migrate.LogLevel{
+	"debug": migrate.LevelDebug,
+	"info":  migrate.LevelInfo,
+	"warn":  migrate.LevelWarn,
+	"error": migrate.LevelError,
+	"none":  migrate.LevelNoLog,
+}
+
+// config is the parsed command line.
+type config struct {
+	dsn      string
+	dryRun   bool
+	one      bool
+	logLevel migrate.LogLevel
+	cmd      string
+	args     []string
+}
+
+// parse parses the command line arguments. The flags may be given before or after the
+// command.
+func parse(args []string, output io.Writer) (*config, error) {
+	var c config
+	var level string
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&c.dsn, "dsn", "", "database URL (sqlite://, postgres://, mysql://, sqlserver:// or cockroachdb://)")
+	fs.BoolVar(&c.dryRun, "dry-run", false, "roll back the migration step, or list the steps of up")
+	fs.BoolVar(&c.one, "one", false, "execute only one migration step with up and down")
+	fs.StringVar(&level, "log-level", "info", "log level: debug, info, warn, error or none")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return nil, fmt.Errorf("%w: missing command", migrate.ErrBadParameters)
+	}
+	c.cmd, c.args = positional[0], positional[1:]
+	if c.dsn == "" {
+		return nil, fmt.Errorf("%w: missing -dsn", migrate.ErrBadParameters)
+	}
+	var ok bool
+	if c.logLevel, ok = logLevels[level]; !ok {
+		return nil, fmt.Errorf("%w: invalid log level '%s'", migrate.ErrBadParameters, level)
+	}
+	return &c, nil
+}
+
+// RunCLI parses the command line arguments args, without the program name, and executes
+// the command on the database with the migration steps. The output is written to the
+// standard output and the logs to the standard error.
+func RunCLI(steps *migrate.Steps, args []string) error {
+	return RunCLICtx(context.Background(), steps, args)
+}
+
+// RunCLICtx parses the command line arguments args, without the program name, and executes
+// the command on the database with the migration steps. The output is written to the
+// standard output and the logs to the standard error.
+func RunCLICtx(ctx context.Context, steps *migrate.Steps, args []string) error {
+	return run(ctx, steps, args, os.Stdout)
+}
+
+func run(ctx context.Context, steps *migrate.Steps, args []string, out io.Writer) error {
+	if steps == nil {
+		return fmt.Errorf("migrate cli: %w: nil steps", migrate.ErrBadParameters)
+	}
+	c, err := parse(args, out)
+	if err != nil {
+		return fmt.Errorf("migrate cli: %w", err)
+	}
+	db, err := migrate.OpenURL(c.dsn)
+	if err != nil {
+		return fmt.Errorf("migrate cli: %w", err)
+	}
+	defer db.DB().Close()
+	m, err := migrate.New(db, steps, migrate.NewLogLogger(c.logLevel))
+	if err != nil {
+		return fmt.Errorf("migrate cli: %w", err)
+	}
+	if err := execute(ctx, m, steps, c, out); err != nil {
+		return fmt.Errorf("migrate cli: %s: %w", c.cmd, err)
+	}
+	return nil
+}
+
+// execute executes the command of the command line.
+func execute(ctx context.Context, m *migrate.Migrator, steps *migrate.Steps, c *config, out io.Writer) error {
+	if c.cmd != "to" && c.cmd != "force" && len(c.args) != 0 {
+		return fmt.Errorf("%w: unexpected arguments %q", migrate.ErrBadParameters, c.args)
+	}
+	switch c.cmd {
+	case "version":
+		v, err := m.VersionCtx(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d %s\n", v.ID, v.ChecksumString())
+	case "status":
+		status, err := m.StatusCtx(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			if s.ID > 0 && !s.Transactional {
+				state += " no-tx"
+			}
+			fmt.Fprintf(out, "%s %d '%s'\n", state, s.ID, s.Name)
+		}
+	case "up":
+		initialized, err := initialize(ctx, m, c.dryRun)
+		if err != nil {
+			return err
+		}
+		switch {
+		case c.dryRun && !initialized:
+			// the steps can't be executed in a dry run of an uninitialized database
+			for ID := 1; ID < steps.Len() && (ID == 1 || !c.one); ID++ {
+				name, _ := steps.Name(ID)
+				from, _ := steps.Version(ID - 1)
+				to, _ := steps.Version(ID)
+				fmt.Fprintf(out, "'%s' %v -> %v\n", name, from, to)
+			}
+		case c.dryRun && c.one:
+			return m.OneUpDryRunCtx(ctx)
+		case c.dryRun:
+			plan, err := m.PlanUpCtx(ctx)
+			if err != nil {
+				return err
+			}
+			for _, s := range plan {
+				fmt.Fprintf(out, "'%s' %v -> %v\n", s.Name, s.From, s.To)
+			}
+		case c.one:
+			return m.OneUpCtx(ctx)
+		default:
+			return m.AllUpCtx(ctx)
+		}
+	case "down":
+		if c.dryRun && !c.one {
+			return fmt.Errorf("%w: dry run requires -one", migrate.ErrBadParameters)
+		}
+		if _, err := m.VersionCtx(ctx); err != nil {
+			return err
+		}
+		switch {
+		case c.dryRun:
+			return m.OneDownDryRunCtx(ctx)
+		case c.one:
+			return m.OneDownCtx(ctx)
+		default:
+			return m.AllDownCtx(ctx)
+		}
+	case "to":
+		if len(c.args) != 1 {
+			return fmt.Errorf("%w: expect one version ID", migrate.ErrBadParameters)
+		}
+		ID, err := strconv.Atoi(c.args[0])
+		if err != nil || ID < 0 || ID >= steps.Len() {
+			return fmt.Errorf("%w: invalid version ID '%s'", migrate.ErrBadParameters, c.args[0])
+		}
+		if c.dryRun {
+			return fmt.Errorf("%w: dry run not supported", migrate.ErrBadParameters)
+		}
+		if _, err := initialize(ctx, m, false); err != nil {
+			return err
+		}
+		return migrateTo(ctx, m, ID)
+	case "force":
+		if len(c.args) != 1 {
+			return fmt.Errorf("%w: expect one version ID", migrate.ErrBadParameters)
+		}
+		ID, err := strconv.Atoi(c.args[0])
+		if err != nil || ID < 0 || ID >= steps.Len() {
+			return fmt.Errorf("%w: invalid version ID '%s'", migrate.ErrBadParameters, c.args[0])
+		}
+		if c.dryRun {
+			return fmt.Errorf("%w: dry run not supported", migrate.ErrBadParameters)
+		}
+		return m.ForceVersionCtx(ctx, ID)
+	default:
+		return fmt.Errorf("%w: unknown command", migrate.ErrBadParameters)
+	}
+	return nil
+}
+
+// initialize reads the database version and initializes the database if it isn't. It
+// returns false when the database is not initialized because dryRun is true.
+func initialize(ctx context.Context, m *migrate.Migrator, dryRun bool) (bool, error) {
+	_, err := m.VersionCtx(ctx)
+	if !errors.Is(err, migrate.ErrNotInitialized) {
+		return err == nil, err
+	}
+	if dryRun {
+		return false, m.InitDryRunCtx(ctx)
+	}
+	return true, m.InitCtx(ctx)
+}
+
+// migrateTo executes the migration steps up or down until the version ID is reached.
+func migrateTo(ctx context.Context, m *migrate.Migrator, ID int) error {
+	for {
+		current, err := m.VersionIDCtx(ctx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case current < ID:
+			err = m.OneUpCtx(ctx)
+		case current > ID:
+			err = m.OneDownCtx(ctx)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package migratecli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chmike/migrate"
+	"github.com/chmike/migrate/sqlite"
+)
+
+func testSteps() *migrate.Steps {
+	s := sqlite.NewSteps("test database")
+	s.Append("create table",
+		sqlite.Tx(sqlite.Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY, "msg" TEXT NOT NULL)`)),
+		sqlite.Tx(sqlite.Cmd(`DROP TABLE "test"`)),
+	)
+	s.Append("insert row",
+		sqlite.Tx(sqlite.Cmd(`INSERT INTO "test" ("msg") VALUES ('hello')`)),
+		sqlite.Tx(sqlite.Cmd(`DELETE FROM "test"`)),
+	)
+	s.Append("nil step", nil, nil)
+	return s
+}
+
+func TestRunCLI(t *testing.T) {
+	steps := testSteps()
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	v2, _ := steps.Version(2)
+
+	tests := []struct {
+		args []string
+		out  string
+	}{
+		{[]string{"-dsn", dsn, "-log-level", "none", "to", "2"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "2 " + v2.ChecksumString() + "\n"},
+		{[]string{"-dsn", dsn, "status"},
+			"applied 0 'test database'\napplied 1 'create table'\napplied 2 'insert row'\npending 3 'nil step'\n",
+		},
+		{[]string{"-dsn", dsn, "up", "-dry-run"}, "'nil step' v2:"},
+		{[]string{"-dsn", dsn, "up", "-dry-run", "-one"}, ""},
+		{[]string{"-dsn", dsn, "down", "-one", "-dry-run"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "2 "},
+		{[]string{"-dsn", dsn, "-log-level", "none", "down", "-one"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "1 "},
+		{[]string{"-dsn", dsn, "up", "-one"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "2 "},
+		{[]string{"-dsn", dsn, "up"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "3 "},
+		{[]string{"-dsn", dsn, "up", "-dry-run"}, ""},
+		{[]string{"-dsn", dsn, "to", "0"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "0 "},
+		{[]string{"-dsn", dsn, "up"}, ""},
+		{[]string{"-dsn", dsn, "down"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "0 "},
+		{[]string{"-dsn", dsn, "-log-level", "none", "force", "3"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "3 "},
+		{[]string{"-dsn", dsn, "-log-level", "none", "force", "0"}, ""},
+		{[]string{"-dsn", dsn, "version"}, "0 "},
+	}
+	// the dry run of an uninitialized database lists the steps
+	var out bytes.Buffer
+	newDSN := "sqlite://" + filepath.Join(t.TempDir(), "new.db")
+	if err := run(context.Background(), steps, []string{"-dsn", newDSN, "-log-level", "none", "up", "-dry-run", "-one"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "'create table' v0:"; !strings.HasPrefix(out.String(), exp) || strings.Count(out.String(), "\n") != 1 {
+		t.Fatalf("expect output %q, got %q", exp, out.String())
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := run(context.Background(), steps, test.args, &out); err != nil {
+			t.Fatalf("%q: %v", test.args, err)
+		}
+		if !strings.HasPrefix(out.String(), test.out) || test.out == "" && out.Len() != 0 {
+			t.Fatalf("%q: expect output %q, got %q", test.args, test.out, out.String())
+		}
+	}
+}
+
+func TestRunCLIErrors(t *testing.T) {
+	steps := testSteps()
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	// each test has its own database as opening an SQLite database creates an empty file
+	tests := [][]string{
+		{},
+		{"up"},
+		{"-dsn", dsn},
+		{"-dsn", dsn, "-log-level", "verbose", "up"},
+		{"-dsn", "unknown://db", "up"},
+		{"-dsn", dsn, "sideways"},
+		{"-dsn", dsn, "up", "now"},
+		{"-dsn", dsn, "to"},
+		{"-dsn", dsn, "to", "4"},
+		{"-dsn", dsn, "to", "-dry-run", "1"},
+		{"-dsn", dsn, "force", "4"},
+		{"-dsn", dsn, "force", "-dry-run", "1"},
+		{"-dsn", dsn, "down", "-dry-run"},
+	}
+	for i, args := range tests {
+		for j := range args {
+			if args[j] == dsn {
+				args[j] = "sqlite://" + filepath.Join(t.TempDir(), fmt.Sprintf("test%d.db", i))
+			}
+		}
+		var out bytes.Buffer
+		if err := run(context.Background(), steps, args, &out); !errors.Is(err, migrate.ErrBadParameters) {
+			t.Fatalf("%q: expect %v, got %v", args, migrate.ErrBadParameters, err)
+		}
+	}
+	if err := run(context.Background(), steps, []string{"-dsn", dsn, "version"}, &bytes.Buffer{}); !errors.Is(err, migrate.ErrNotInitialized) {
+		t.Fatalf("expect %v, got %v", migrate.ErrNotInitialized, err)
+	}
+	if err := run(context.Background(), nil, nil, &bytes.Buffer{}); !errors.Is(err, migrate.ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", migrate.ErrBadParameters, err)
+	}
+}
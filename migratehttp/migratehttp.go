@@ -0,0 +1,48 @@
+// Package migratehttp provides an http handler reporting the migration state of a
+// database.
+package migratehttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chmike/migrate"
+)
+
+// State is the migration state of a database served by the handler.
+type State struct {
+	Version   int    `json:"version"`             // Version is the database version ID.
+	Checksum  string `json:"checksum"`            // Checksum is the database version checksum.
+	Pending   int    `json:"pending"`             // Pending is the number of pending steps up.
+	LastError string `json:"lastError,omitempty"` // LastError is the last migration error.
+	Error     string `json:"error,omitempty"`     // Error is the error getting the state.
+}
+
+// Handler returns an http handler serving the migration state of the database as JSON
+// in response to GET requests. The status code is 500 when the state can't be obtained.
+func Handler(m *migrate.Migrator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		var state State
+		status := http.StatusOK
+		if err := m.LastError(); err != nil {
+			state.LastError = err.Error()
+		}
+		v, err := m.VersionCtx(r.Context())
+		if err == nil {
+			state.Version, state.Checksum = v.ID, v.ChecksumString()
+			state.Pending, err = m.PendingCtx(r.Context())
+		}
+		if err != nil {
+			state.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(state)
+	})
+}
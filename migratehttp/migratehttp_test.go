@@ -0,0 +1,87 @@
+package migratehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chmike/migrate"
+)
+
+type mockDatabase struct {
+	version    migrate.Version
+	versionErr error
+}
+
+func (m *mockDatabase) InitVersion(ctx context.Context, v migrate.Version, dryRun bool) error {
+	return nil
+}
+
+func (m *mockDatabase) Version(ctx context.Context) (migrate.Version, error) {
+	return m.version, m.versionErr
+}
+
+func (m *mockDatabase) DefaultStepFunc(ctx context.Context, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+	if m.versionErr != nil {
+		return m.versionErr
+	}
+	if !dryRun {
+		m.version = info.To()
+	}
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	s := migrate.NewSteps("test database")
+	s.Append("step 1", nil, nil)
+	s.Append("step 2", nil, nil)
+	v0, _ := s.Version(0)
+	v1, _ := s.Version(1)
+	db := &mockDatabase{version: v0}
+	m, err := migrate.New(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	h := Handler(m)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expect application/json, got %s", ct)
+	}
+	exp := `{"version":1,"checksum":"` + v1.ChecksumString() + `","pending":1}` + "\n"
+	if w.Body.String() != exp {
+		t.Fatalf("expect %s, got %s", exp, w.Body.String())
+	}
+
+	db.versionErr = errors.New("connection error")
+	if err := m.OneUp(); err == nil {
+		t.Fatal("expect error")
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expect %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	exp = `{"version":0,"checksum":"","pending":0,"lastError":"one up: step 2 'step 2': connection error","error":"connection error"}` + "\n"
+	if w.Body.String() != exp {
+		t.Fatalf("expect %s, got %s", exp, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
@@ -0,0 +1,41 @@
+// Package migrateotel emits OpenTelemetry spans for the migration steps.
+package migrateotel
+
+import (
+	"context"
+
+	"github.com/chmike/migrate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracer returns a migrator option starting a span with the tracer for each executed
+// migration step. The span is named after the step and is a child of the span in the
+// context given to the migrator methods. It records the from and to version IDs, the
+// direction and the dry run flag as attributes, and is marked as errored when the step
+// fails. The option does nothing when tracer is nil.
+func WithTracer(tracer trace.Tracer) migrate.Option {
+	if tracer == nil {
+		return func(*migrate.Migrator) {}
+	}
+	return migrate.WithStepWrapper(func(ctx context.Context, info migrate.StepInfo, dryRun bool, step func(context.Context) error) error {
+		direction := "up"
+		if info.To().ID < info.From().ID {
+			direction = "down"
+		}
+		ctx, span := tracer.Start(ctx, info.Name(), trace.WithAttributes(
+			attribute.Int("migrate.from", info.From().ID),
+			attribute.Int("migrate.to", info.To().ID),
+			attribute.String("migrate.direction", direction),
+			attribute.Bool("migrate.dry_run", dryRun),
+		))
+		defer span.End()
+		err := step(ctx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	})
+}
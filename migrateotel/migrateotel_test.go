@@ -0,0 +1,129 @@
+package migrateotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chmike/migrate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type mockDatabase struct {
+	version migrate.Version
+}
+
+func (m *mockDatabase) InitVersion(ctx context.Context, v migrate.Version, dryRun bool) error {
+	return nil
+}
+
+func (m *mockDatabase) Version(ctx context.Context) (migrate.Version, error) {
+	return m.version, nil
+}
+
+func (m *mockDatabase) DefaultStepFunc(ctx context.Context, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+	if !dryRun {
+		m.version = info.To()
+	}
+	return nil
+}
+
+var errMock = errors.New("mock error")
+
+func failFunc(ctx context.Context, db migrate.Database, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+	return errMock
+}
+
+func TestWithTracer(t *testing.T) {
+	s := migrate.NewSteps("test database")
+	s.Append("step 1", nil, nil)
+	s.Append("step 2", failFunc, nil)
+	v0, _ := s.Version(0)
+	db := &mockDatabase{version: v0}
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	m, err := migrate.New(db, s, nil, WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	if err := m.OneUpCtx(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUpCtx(ctx); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if err := m.OneDownCtx(ctx); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("expect 4 spans, got %d", len(spans))
+	}
+	tests := []struct {
+		name      string
+		from, to  int
+		direction string
+		status    codes.Code
+	}{
+		{"step 1", 0, 1, "up", codes.Unset},
+		{"step 2", 1, 2, "up", codes.Error},
+		{"step 1", 1, 0, "down", codes.Unset},
+	}
+	for i, test := range tests {
+		span := spans[i]
+		if span.Name() != test.name {
+			t.Errorf("span %d: expect name %q, got %q", i, test.name, span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %d: expect parent span", i)
+		}
+		if span.Status().Code != test.status {
+			t.Errorf("span %d: expect status %v, got %v", i, test.status, span.Status().Code)
+		}
+		exp := []attribute.KeyValue{
+			attribute.Int("migrate.from", test.from),
+			attribute.Int("migrate.to", test.to),
+			attribute.String("migrate.direction", test.direction),
+			attribute.Bool("migrate.dry_run", false),
+		}
+		attrs := span.Attributes()
+		if len(attrs) != len(exp) {
+			t.Fatalf("span %d: expect %v, got %v", i, exp, attrs)
+		}
+		for j := range exp {
+			if attrs[j] != exp[j] {
+				t.Errorf("span %d: expect %v, got %v", i, exp[j], attrs[j])
+			}
+		}
+	}
+}
+
+func TestWithNilTracer(t *testing.T) {
+	s := migrate.NewSteps("test database")
+	s.Append("step 1", nil, nil)
+	v0, _ := s.Version(0)
+	db := &mockDatabase{version: v0}
+	m, err := migrate.New(db, s, nil, WithTracer(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+}
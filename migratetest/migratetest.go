@@ -0,0 +1,104 @@
+// Package migratetest provides helpers to test migration steps.
+package migratetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/chmike/migrate"
+)
+
+// RoundTrip initializes the database and executes the migration steps up one at a time,
+// and then down to version 0. It checks that each step changes the version as expected
+// and that the dry run of each step up leaves the version unchanged. The test fails with
+// the step name and versions on the first error or mismatch. The database must not be
+// initialized.
+func RoundTrip(t testing.TB, db migrate.SQLDB, steps *migrate.Steps) {
+	t.Helper()
+	m, err := migrate.New(db, steps, nil)
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	checkVersion := func(op string, ID int) {
+		t.Helper()
+		v, err := m.Version()
+		if err != nil {
+			t.Fatalf("round trip: %s: %v", op, err)
+		}
+		exp, err := steps.Version(ID)
+		if err != nil {
+			t.Fatalf("round trip: %s: %v", op, err)
+		}
+		if v != exp {
+			t.Fatalf("round trip: %s: expect version %v, got %v", op, exp, v)
+		}
+	}
+	checkVersion("init", 0)
+	for ID := 1; ID < steps.Len(); ID++ {
+		name, _ := steps.Name(ID)
+		if err := m.OneUpDryRun(); err != nil {
+			t.Fatalf("round trip: dry run up '%s': %v", name, err)
+		}
+		checkVersion("dry run up '"+name+"'", ID-1)
+		if err := m.OneUp(); err != nil {
+			t.Fatalf("round trip: up '%s': %v", name, err)
+		}
+		checkVersion("up '"+name+"'", ID)
+	}
+	for ID := steps.Len() - 1; ID > 0; ID-- {
+		name, _ := steps.Name(ID)
+		if err := m.OneDown(); err != nil {
+			t.Fatalf("round trip: down '%s': %v", name, err)
+		}
+		checkVersion("down '"+name+"'", ID-1)
+	}
+}
+
+// CrossCheck initializes each database and executes all the migration steps up and then
+// all down to version 0. The databases, typically of different backends opened by the
+// caller, are migrated in parallel to detect the SQL commands unsupported by one of them.
+// The test fails with an error for each failed database giving its index, the type of its
+// driver and the failed step. A database that is already initialized must be at version 0.
+func CrossCheck(t testing.TB, steps *migrate.Steps, dbs ...migrate.SQLDB) {
+	t.Helper()
+	errs := make([]error, len(dbs))
+	var wg sync.WaitGroup
+	for i, db := range dbs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = crossCheck(db, steps)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("cross check: db %d (%T): %v", i, dbs[i].DB().Driver(), err)
+		}
+	}
+}
+
+// crossCheck executes all the migration steps up and down on the database.
+func crossCheck(db migrate.SQLDB, steps *migrate.Steps) error {
+	m, err := migrate.New(db, steps, nil)
+	if err != nil {
+		return err
+	}
+	if err := m.Init(); err != nil && !errors.Is(err, migrate.ErrAlreadyInitialized) {
+		return err
+	}
+	if v, err := m.Version(); err != nil {
+		return err
+	} else if v.ID != 0 {
+		return fmt.Errorf("database version is %v instead of v0", v)
+	}
+	if err := m.AllUp(); err != nil {
+		return err
+	}
+	return m.AllDown()
+}
@@ -0,0 +1,112 @@
+package migratetest
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/chmike/migrate"
+	"github.com/chmike/migrate/sqlite"
+)
+
+// recorder is a testing.TB recording the fatal error and the errors.
+type recorder struct {
+	testing.TB
+	msg  string
+	errs []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.msg = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// roundTrip runs RoundTrip with a recorder and returns the fatal error message.
+func roundTrip(t *testing.T, db migrate.SQLDB, steps *migrate.Steps) string {
+	r := &recorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RoundTrip(r, db, steps)
+	}()
+	<-done
+	return r.msg
+}
+
+func openMemory(t *testing.T) migrate.SQLDB {
+	db, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB().Close() })
+	return db
+}
+
+func TestRoundTrip(t *testing.T) {
+	s := sqlite.NewSteps("test database")
+	s.Append("create table",
+		sqlite.Tx(sqlite.Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY, "msg" TEXT NOT NULL)`)),
+		sqlite.Tx(sqlite.Cmd(`DROP TABLE "test"`)),
+	)
+	s.Append("insert row",
+		sqlite.Tx(sqlite.Cmd(`INSERT INTO "test" ("msg") VALUES ('hello')`)),
+		sqlite.Tx(sqlite.Cmd(`DELETE FROM "test"`)),
+	)
+	RoundTrip(t, openMemory(t), s)
+}
+
+func TestRoundTripFailures(t *testing.T) {
+	s := sqlite.NewSteps("test database")
+	s.Append("create table",
+		sqlite.Tx(sqlite.Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY)`)),
+		sqlite.Tx(sqlite.Cmd(`DROP TABLE "missing"`)),
+	)
+	if msg, exp := roundTrip(t, openMemory(t), s), "round trip: down 'create table': "; !strings.HasPrefix(msg, exp) {
+		t.Fatalf("expect %q, got %q", exp, msg)
+	}
+
+	s = sqlite.NewSteps("test database")
+	s.Append("bad step", sqlite.Tx(sqlite.Cmd(`CREATE TABLE`)), nil)
+	if msg, exp := roundTrip(t, openMemory(t), s), "round trip: dry run up 'bad step': "; !strings.HasPrefix(msg, exp) {
+		t.Fatalf("expect %q, got %q", exp, msg)
+	}
+
+	s = sqlite.NewSteps("test database")
+	s.Append("nil step", nil, nil)
+	db := openMemory(t)
+	RoundTrip(t, db, s)
+	if msg, exp := roundTrip(t, db, s), "round trip: already initialized"; !strings.HasPrefix(msg, exp) {
+		t.Fatalf("expect %q, got %q", exp, msg)
+	}
+}
+
+func TestCrossCheck(t *testing.T) {
+	s := sqlite.NewSteps("test database")
+	s.Append("create table",
+		sqlite.Tx(sqlite.Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY, "msg" TEXT NOT NULL)`)),
+		sqlite.Tx(sqlite.Cmd(`DROP TABLE "test"`)),
+	)
+	s.Append("insert row",
+		sqlite.Tx(sqlite.Cmd(`INSERT INTO "test" ("msg") VALUES ('hello')`)),
+		sqlite.Tx(sqlite.Cmd(`DELETE FROM "test"`)),
+	)
+	CrossCheck(t, s, openMemory(t), openMemory(t))
+
+	// the table already exists in the second database
+	bad := openMemory(t)
+	if _, err := bad.DB().Exec(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{TB: t}
+	CrossCheck(r, s, openMemory(t), bad)
+	if len(r.errs) != 1 || !strings.HasPrefix(r.errs[0], "cross check: db 1 (*sqlite3.SQLiteDriver): all up: step 1 'create table': ") {
+		t.Fatalf("unexpected errors %q", r.errs)
+	}
+}
@@ -0,0 +1,174 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chmike/migrate"
+)
+
+func init() {
+	driverName = "sqlmock"
+}
+
+// newMock returns a mocked database registered with the given data source name.
+func newMock(t *testing.T, dsn string) sqlmock.Sqlmock {
+	mockDB, mock, err := sqlmock.NewWithDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	return mock
+}
+
+func TestMSSQLOpenErrors(t *testing.T) {
+	if _, err := Open("dsn", WithTableName("table with space")); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("dsn", WithSchema("schema.name")); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("unknown dsn"); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("unknown dsn", WithConnectRetry(3, time.Millisecond)); err == nil || !strings.Contains(err.Error(), "3 times") {
+		t.Fatalf("expect connect error, got %v", err)
+	}
+}
+
+func TestMSSQLQueries(t *testing.T) {
+	newMock(t, "queries")
+
+	db, err := Open("queries", WithTableName("temp_version"), WithSchema("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := migrate.Queries{
+		CreateTableQuery: `IF OBJECT_ID(N'[app].[temp_version]', N'U') IS NULL CREATE TABLE [app].[temp_version] ([id] INT NOT NULL, [checksum] NVARCHAR(64) NOT NULL)`,
+		InitTableQuery:   `INSERT INTO [app].[temp_version] ([id], [checksum]) VALUES (@p1, @p2)`,
+		VersionQuery:     `SELECT TOP 1 [id], [checksum] FROM [app].[temp_version]`,
+		SetVersionQuery:  `UPDATE [app].[temp_version] SET [id] = @p1, [checksum] = @p2 WHERE [id] = @p3 AND [checksum] = @p4`,
+		TransactionalDDL: true,
+	}
+	if *db.Queries() != exp {
+		t.Fatalf("expect %+v, got %+v", exp, *db.Queries())
+	}
+}
+
+func TestMSSQLHistoryQueries(t *testing.T) {
+	newMock(t, "history")
+
+	db, err := Open("history", WithHistory(), WithTableName("temp_version"), WithSchema("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+	if exp := `INSERT INTO [app].[temp_history] ([from_id], [to_id], [name], [applied_at], [dry_run]) VALUES (@p1, @p2, @p3, @p4, @p5)`; q.InsertHistoryQuery != exp {
+		t.Fatalf("expect %q, got %q", exp, q.InsertHistoryQuery)
+	}
+	if exp := `SELECT [id], [from_id], [to_id], [name], [applied_at], [dry_run] FROM [app].[temp_history] ORDER BY [id]`; q.HistoryQuery != exp {
+		t.Fatalf("expect %q, got %q", exp, q.HistoryQuery)
+	}
+	if !strings.HasPrefix(q.CreateHistoryQuery, `IF OBJECT_ID(N'[app].[temp_history]', N'U') IS NULL CREATE TABLE [app].[temp_history] (`) {
+		t.Fatalf("unexpected create history query %q", q.CreateHistoryQuery)
+	}
+}
+
+func TestMSSQLMigrate(t *testing.T) {
+	mock := newMock(t, "migrate")
+
+	db, err := Open("migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+
+	s := NewSteps("test database")
+	s.Append("create table",
+		Tx(Cmd(`CREATE TABLE [test] ([id] INT IDENTITY PRIMARY KEY, [msg] NVARCHAR(MAX) NOT NULL)`)),
+		Tx(Cmd(`DROP TABLE [test]`)),
+	)
+	v0, _ := s.Version(0)
+	v1, _ := s.Version(1)
+
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).WillReturnError(errors.New(`invalid object name 'migrate_version'`))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(q.CreateTableQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(q.InitTableQuery)).WithArgs(0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(0, v0.ChecksumString()))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE [test]`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+		WithArgs(1, v1.ChecksumString(), 0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// optsDB records the options of the started transactions.
+type optsDB struct {
+	migrate.SQLDB
+	opts *sql.TxOptions
+}
+
+func (db *optsDB) StartTransaction(ctx context.Context, opts *sql.TxOptions) (migrate.SQLTx, error) {
+	db.opts = opts
+	return nil, errors.New("no transaction")
+}
+
+func TestMSSQLReadOnly(t *testing.T) {
+	inner := &optsDB{}
+	db := &mssqlDB{SQLDB: inner}
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}
+	if _, err := db.StartTransaction(context.Background(), opts); err == nil {
+		t.Fatal("expect error")
+	}
+	if inner.opts.ReadOnly || inner.opts.Isolation != sql.LevelSerializable {
+		t.Fatalf("unexpected transaction options %+v", *inner.opts)
+	}
+	if !opts.ReadOnly {
+		t.Fatal("expect caller options unchanged")
+	}
+	if _, err := db.Version(context.Background()); err == nil {
+		t.Fatal("expect error")
+	}
+	if inner.opts.ReadOnly {
+		t.Fatal("expect read-write transaction")
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	url := "sqlserver://user@host?database=db"
+	newMock(t, url)
+	db, err := migrate.OpenURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `SELECT TOP 1 [id], [checksum] FROM [migrate_version]`; db.Queries().VersionQuery != exp {
+		t.Fatalf("expect %q, got %q", exp, db.Queries().VersionQuery)
+	}
+}
@@ -0,0 +1,82 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opener opens an SQL database from a URL whose scheme is the one it was registered with.
+type Opener func(url string) (SQLDB, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = make(map[string]Opener)
+)
+
+// Register makes a database opener available by the given URL scheme. It is intended
+// to be called from the init function of the backend packages. Register panics if it
+// is called twice with the same scheme or if opener is nil.
+func Register(scheme string, opener Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	if opener == nil {
+		panic("migrate: register opener is nil")
+	}
+	if _, dup := openers[scheme]; dup {
+		panic("migrate: register called twice for scheme " + scheme)
+	}
+	openers[scheme] = opener
+}
+
+// Schemes returns the sorted list of registered URL schemes.
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// OpenURL opens the SQL database with the opener registered for the URL scheme like
+// sqlite://path, postgres://... or mysql://... The backend package must be imported,
+// for instance with a blank import, to register its opener.
+func OpenURL(url string) (SQLDB, error) {
+	scheme, _, ok := strings.Cut(url, "://")
+	if !ok {
+		return nil, fmt.Errorf("open url: %w: missing scheme", ErrBadParameters)
+	}
+	openersMu.RLock()
+	opener, ok := openers[scheme]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("open url: %w: unknown scheme '%s' (forgotten import?)", ErrBadParameters, scheme)
+	}
+	db, err := opener(url)
+	if err != nil {
+		return nil, fmt.Errorf("open url: %w", err)
+	}
+	return db, nil
+}
+
+// ConnectRetry calls connect until it succeeds, at most attempts times. It waits backoff
+// after the first failure, and doubles the waiting time after each following failure.
+// The last error is returned wrapped when all attempts fail. It is intended for the
+// backends to wait for a database that is not yet ready to accept connections.
+func ConnectRetry(attempts int, backoff time.Duration, connect func() error) error {
+	err := connect()
+	for i := 1; i < attempts && err != nil; i++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = connect()
+	}
+	if err != nil && attempts > 1 {
+		return fmt.Errorf("connect failed %d times: %w", attempts, err)
+	}
+	return err
+}
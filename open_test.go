@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOpenURL(t *testing.T) {
+	var gotURL string
+	Register("test", func(url string) (SQLDB, error) {
+		gotURL = url
+		return &sqlDB{}, nil
+	})
+	Register("testerror", func(url string) (SQLDB, error) {
+		return nil, errMock
+	})
+	if !slices.Contains(Schemes(), "test") || !slices.Contains(Schemes(), "testerror") {
+		t.Fatalf("expect test schemes in %v", Schemes())
+	}
+
+	db, err := OpenURL("test://path/to/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db == nil {
+		t.Fatal("expect non-nil database")
+	}
+	if exp := "test://path/to/db"; gotURL != exp {
+		t.Fatalf("expect %q, got %q", exp, gotURL)
+	}
+
+	if _, err := OpenURL("testerror://path"); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if _, err := OpenURL("unknown://path"); !errors.Is(err, ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", ErrBadParameters, err)
+	}
+	if _, err := OpenURL("path"); !errors.Is(err, ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", ErrBadParameters, err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expect panic")
+			}
+		}()
+		Register("test", func(url string) (SQLDB, error) { return nil, nil })
+	}()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expect panic")
+			}
+		}()
+		Register("nil", nil)
+	}()
+}
+
+func TestConnectRetry(t *testing.T) {
+	var calls int
+	connect := func() error {
+		calls++
+		if calls < 3 {
+			return errMock
+		}
+		return nil
+	}
+	if err := ConnectRetry(5, time.Millisecond, connect); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("expect 3 calls, got %d", calls)
+	}
+
+	calls = 0
+	if err := ConnectRetry(2, time.Millisecond, connect); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if calls != 2 {
+		t.Fatalf("expect 2 calls, got %d", calls)
+	}
+
+	calls = 0
+	if err := ConnectRetry(0, time.Millisecond, connect); err != errMock {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expect 1 call, got %d", calls)
+	}
+}
@@ -0,0 +1,202 @@
+// Package pgxdb is a PostgreSQL migration backend using the native pgx interface instead
+// of database/sql. The step functions Tx, TxF and NoTx of this package must be used in
+// place of the migrate ones as they pass pgx transactions.
+package pgxdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/chmike/migrate"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrNotPgxDB is returned by the step functions of this package when the database is not
+// a pgx database.
+const ErrNotPgxDB migrate.Error = "not a pgx database"
+
+// Conn is a pgx connection. It is implemented by *pgx.Conn and *pgxpool.Pool.
+type Conn interface {
+	// BeginTx starts a transaction.
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+
+	// Exec executes an SQL command.
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+type config struct {
+	tableName string
+	schema    string
+}
+
+// Option function.
+type Option func(*config)
+
+// WithTableName changes the default version table name.
+func WithTableName(tableName string) Option {
+	return func(c *config) {
+		c.tableName = tableName
+	}
+}
+
+// WithSchema sets the schema of the version table. The search path of the
+// connection is used by default.
+func WithSchema(schema string) Option {
+	return func(c *config) {
+		c.schema = schema
+	}
+}
+
+// validName matches a valid unquoted PostgreSQL identifier.
+var validName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,62}$`)
+
+// serializable are the options of the transactions.
+var serializable = pgx.TxOptions{IsoLevel: pgx.Serializable}
+
+// DB is a PostgreSQL database accessed with pgx.
+type DB struct {
+	conn Conn             // conn is the pgx connection.
+	q    *migrate.Queries // q are the version table queries.
+}
+
+var _ migrate.Database = &DB{}
+
+// New returns the database of the pgx connection.
+func New(conn Conn, options ...Option) (*DB, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("new pgxdb: %w: nil connection", migrate.ErrBadParameters)
+	}
+	c := config{tableName: "migrate_version"}
+	for _, option := range options {
+		option(&c)
+	}
+	if !validName.MatchString(c.tableName) {
+		return nil, fmt.Errorf("new pgxdb: invalid table name '%s'", c.tableName)
+	}
+	if c.schema != "" && !validName.MatchString(c.schema) {
+		return nil, fmt.Errorf("new pgxdb: invalid schema name '%s'", c.schema)
+	}
+	return &DB{conn: conn, q: queries(c)}, nil
+}
+
+// queries returns the PostgreSQL queries for the configured version table.
+func queries(c config) *migrate.Queries {
+	table := `"` + c.tableName + `"`
+	if c.schema != "" {
+		table = `"` + c.schema + `".` + table
+	}
+	return &migrate.Queries{
+		CreateTableQuery: `CREATE TABLE IF NOT EXISTS ` + table + ` ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+		InitTableQuery:   `INSERT INTO ` + table + ` ("id", "checksum") VALUES ($1, $2)`,
+		VersionQuery:     `SELECT "id", "checksum" FROM ` + table + ` LIMIT 1`,
+		SetVersionQuery:  `UPDATE ` + table + ` SET "id" = $1, "checksum" = $2 WHERE "id" = $3 AND "checksum" = $4`,
+	}
+}
+
+// Conn returns the pgx connection.
+func (db *DB) Conn() Conn { return db.conn }
+
+// Queries returns the version table queries.
+func (db *DB) Queries() *migrate.Queries { return db.q }
+
+// StartTransaction starts a transaction. It must be followed by a defer FinalizeTransaction.
+func (db *DB) StartTransaction(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	tx, err := db.conn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", migrate.ErrBeginTx, err)
+	}
+	return tx, nil
+}
+
+// FinalizeTransaction is intended to be called as deferred function after a successful call
+// to StartTransaction. It commits the transaction when err is nil and dryRun is false,
+// otherwise it rolls back the transaction.
+func FinalizeTransaction(ctx context.Context, tx pgx.Tx, err *error, dryRun bool) {
+	if *err != nil || dryRun {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+			if *err != nil {
+				*err = fmt.Errorf("%w; %w: %w", *err, migrate.ErrRollbackTx, rollbackErr)
+			} else {
+				*err = fmt.Errorf("%w: %w", migrate.ErrRollbackTx, rollbackErr)
+			}
+		}
+	} else if commitErr := tx.Commit(ctx); commitErr != nil {
+		*err = fmt.Errorf("%w: %w", migrate.ErrCommitTx, commitErr)
+	}
+}
+
+// InitVersion initialize the version information. Returns ErrAlreadyInitialized
+// if the database is already initialized.
+func (db *DB) InitVersion(ctx context.Context, v migrate.Version, dryRun bool) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("%w: %w", migrate.ErrNotInitialized, err)
+		}
+	}()
+	tx, err := db.StartTransaction(ctx, serializable)
+	if err != nil {
+		return err
+	}
+	defer FinalizeTransaction(ctx, tx, &err, dryRun)
+
+	if _, err = tx.Exec(ctx, db.q.CreateTableQuery); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, db.q.InitTableQuery, db.q.Args(v.ID, db.q.ChecksumArg(v))...)
+	return err
+}
+
+// Version returns the current database version. Returns ErrNotInitialized if
+// the database is not initialized.
+func (db *DB) Version(ctx context.Context) (v migrate.Version, err error) {
+	tx, err := db.StartTransaction(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return migrate.BadVersion, err
+	}
+	defer FinalizeTransaction(ctx, tx, &err, false)
+	return db.VersionTx(ctx, tx)
+}
+
+// VersionTx returns the current database version in the transaction tx. Returns
+// ErrNotInitialized if the database is not initialized.
+func (db *DB) VersionTx(ctx context.Context, tx pgx.Tx) (migrate.Version, error) {
+	return db.q.ScanVersion(tx.QueryRow(ctx, db.q.VersionQuery))
+}
+
+// DefaultStepFunc is called when the step function is nil. It sets the version to info.To()
+// when the database version is info.From() and dryRun is false, otherwise it returns ErrBadVersion.
+func (db *DB) DefaultStepFunc(ctx context.Context, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+	if log.Level() >= migrate.LevelDebug {
+		log.Debug("nil migration step", migrate.F("name", info.Name()), migrate.F("from", info.From()), migrate.F("to", info.To()))
+	}
+	return db.SetVersion(ctx, info, dryRun)
+}
+
+// SetVersion sets the version to info.To() in a transaction if it is info.From(), otherwise
+// it returns ErrBadVersion.
+func (db *DB) SetVersion(ctx context.Context, info migrate.StepInfo, dryRun bool) (err error) {
+	tx, err := db.StartTransaction(ctx, serializable)
+	if err != nil {
+		return err
+	}
+	defer FinalizeTransaction(ctx, tx, &err, dryRun)
+	return db.SetVersionTx(ctx, tx, info)
+}
+
+// SetVersionTx sets the version to info.To() in the transaction tx if it is info.From(),
+// otherwise it returns ErrBadVersion.
+func (db *DB) SetVersionTx(ctx context.Context, tx pgx.Tx, info migrate.StepInfo) error {
+	tag, err := tx.Exec(ctx, db.q.SetVersionQuery, db.q.Args(
+		info.To().ID, db.q.ChecksumArg(info.To()),
+		info.From().ID, db.q.ChecksumArg(info.From()),
+	)...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return migrate.ErrBadVersion
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package pgxdb
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/chmike/migrate"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+var readOnly = pgx.TxOptions{IsoLevel: pgx.Serializable, AccessMode: pgx.ReadOnly}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil); !errors.Is(err, migrate.ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", migrate.ErrBadParameters, err)
+	}
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(mock, WithTableName("table with space")); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := New(mock, WithSchema("schema.name")); err == nil {
+		t.Fatal("expect error")
+	}
+	db, err := New(mock, WithTableName("temp_version"), WithSchema("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `SELECT "id", "checksum" FROM "app"."temp_version" LIMIT 1`; db.Queries().VersionQuery != exp {
+		t.Fatalf("expect %q, got %q", exp, db.Queries().VersionQuery)
+	}
+	if db.Conn() != mock {
+		t.Fatal("unexpected connection")
+	}
+}
+
+func TestPgxMigrate(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+
+	s := NewSteps("test database")
+	s.Append("create table",
+		Tx(Cmd(`CREATE TABLE "test" ("id" SERIAL PRIMARY KEY, "msg" TEXT NOT NULL)`)),
+		Tx(Cmd(`DROP TABLE "test"`)),
+	)
+	s.Append("insert row",
+		TxF(func(ctx context.Context, tx pgx.Tx, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+			_, err := tx.Exec(ctx, `INSERT INTO "test" ("msg") VALUES ($1)`, info.Name())
+			return err
+		}),
+		NoTx(Cmd(`DELETE FROM "test"`)),
+	)
+	v0, _ := s.Version(0)
+	v1, _ := s.Version(1)
+	v2, _ := s.Version(2)
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBeginTx(readOnly)
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).WillReturnError(errors.New(`relation "migrate_version" does not exist`))
+	mock.ExpectRollback()
+	mock.ExpectBeginTx(serializable)
+	mock.ExpectExec(regexp.QuoteMeta(q.CreateTableQuery)).WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mock.ExpectExec(regexp.QuoteMeta(q.InitTableQuery)).WithArgs(0, v0.ChecksumString()).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersion := func(v migrate.Version) {
+		mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).
+			WillReturnRows(pgxmock.NewRows([]string{"id", "checksum"}).AddRow(v.ID, v.ChecksumString()))
+	}
+	expectSetVersion := func(from, to migrate.Version) {
+		mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+			WithArgs(to.ID, to.ChecksumString(), from.ID, from.ChecksumString()).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	}
+
+	mock.ExpectBeginTx(serializable)
+	expectVersion(v0)
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE "test"`)).WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	expectSetVersion(v0, v1)
+	mock.ExpectRollback()
+	if err := m.OneUpDryRun(); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBeginTx(serializable)
+	expectVersion(v0)
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE "test"`)).WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	expectSetVersion(v0, v1)
+	mock.ExpectCommit()
+	mock.ExpectBeginTx(serializable)
+	expectVersion(v1)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "test"`)).WithArgs("insert row").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	expectSetVersion(v1, v2)
+	mock.ExpectCommit()
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBeginTx(readOnly)
+	expectVersion(v2)
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "test"`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectBeginTx(serializable)
+	mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+		WithArgs(v1.ID, v1.ChecksumString(), v2.ID, v2.ChecksumString()).WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectRollback()
+	if err := m.OneDown(); !errors.Is(err, migrate.ErrBadVersion) {
+		t.Fatalf("expect %v, got %v", migrate.ErrBadVersion, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotPgxDB(t *testing.T) {
+	info := migrate.StepInfo(nil)
+	for _, f := range []migrate.StepFunc{Tx(), NoTx()} {
+		if err := f(context.Background(), migrate.NewSQLDB(nil, nil), info, false, migrate.NewNilLogger()); !errors.Is(err, ErrNotPgxDB) {
+			t.Fatalf("expect %v, got %v", ErrNotPgxDB, err)
+		}
+	}
+}
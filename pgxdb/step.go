@@ -0,0 +1,157 @@
+package pgxdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/chmike/migrate"
+	"github.com/jackc/pgx/v5"
+)
+
+// NewSteps instantiates a new migration step sequence. The name should not be
+// empty and ideally unique to the database as it is used to compute the root
+// checksum identifying the database.
+func NewSteps(name string) *migrate.Steps {
+	return migrate.NewSteps(name)
+}
+
+// NewMigrator returns a new migrator.
+func NewMigrator(db *DB, s migrate.Stepper, l migrate.Logger, options ...migrate.Option) (*migrate.Migrator, error) {
+	return migrate.New(db, s, l, options...)
+}
+
+// Cmd is a function simplifying the creation of a Command.
+func Cmd(cmd string, args ...any) migrate.SQLCommand {
+	return migrate.SQLCommand{Cmd: cmd, Args: args}
+}
+
+// Tx returns a migration step function that executes all the SQL commands in
+// sequence wrapped in a pgx transaction. The execution stops and rolls back as soon
+// as an error is returned by one of the commands. It is also rolled back when dryRun
+// is true.
+func Tx(cmds ...migrate.SQLCommand) migrate.StepFunc {
+	return TxF(func(ctx context.Context, tx pgx.Tx, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+		for _, cmd := range cmds {
+			if log.Level() >= migrate.LevelDebug {
+				log.Debug("tx sql command", migrate.F("cmd", cmd))
+			}
+			if _, err := tx.Exec(ctx, cmd.Cmd, cmd.Args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TxFunc is a user provided function that is called with a pgx transaction.
+type TxFunc func(ctx context.Context, tx pgx.Tx, info migrate.StepInfo, dryRun bool, log migrate.Logger) error
+
+// TxF returns a migration step function that executes all the user provided functions in
+// sequence wrapped in a pgx transaction. The execution stops and rolls back as soon
+// as an error is returned by one of the function and the step function returns the error.
+// The pseudo errors ErrAbort and ErrCancel are handled as with migrate.TxF.
+func TxF(fs ...TxFunc) migrate.StepFunc {
+	return migrate.RegisterStepKind(func(ctx context.Context, gdb migrate.Database, info migrate.StepInfo, dryRun bool, log migrate.Logger) (err error) {
+		db, ok := gdb.(*DB)
+		if !ok {
+			return fmt.Errorf("pgx txf: %w", ErrNotPgxDB)
+		}
+		defer func() {
+			if err != nil {
+				log.Error("tx sql command", migrate.F("name", info.Name()), migrate.F("from", info.From()), migrate.F("to", info.To()), migrate.F("error", err.Error()))
+			}
+		}()
+		defer func() {
+			if err != nil {
+				if errors.Is(err, migrate.ErrCancel) {
+					err = nil
+				} else if dryRun {
+					err = fmt.Errorf("pgx txf %v -> %v dry run: %w", info.From(), info.To(), err)
+				} else {
+					err = fmt.Errorf("pgx txf %v -> %v: %w", info.From(), info.To(), err)
+				}
+			}
+		}()
+
+		tx, err := db.StartTransaction(ctx, serializable)
+		if err != nil {
+			return err
+		}
+		defer FinalizeTransaction(ctx, tx, &err, dryRun)
+
+		dbv, err := db.VersionTx(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if err := migrate.CheckFrom(dbv, info); err != nil {
+			return err
+		}
+
+		var cancel bool
+		for _, f := range fs {
+			if err = f(ctx, tx, info, dryRun, log); err != nil {
+				if !errors.Is(err, migrate.ErrCancel) {
+					return err
+				}
+				cancel = true
+			}
+		}
+		if cancel {
+			return migrate.ErrCancel
+		}
+
+		if err := db.SetVersionTx(ctx, tx, info); err != nil {
+			return err
+		}
+		log.Info("migrate step", migrate.F("name", info.Name()), migrate.F("from", info.From()), migrate.F("to", info.To()), migrate.F("dryRun", dryRun))
+		return nil
+	}, migrate.StepTx)
+}
+
+// NoTx returns a migration step function that executes the SQL commands in sequence
+// without a wrapping transaction. It terminates as soon as a command returns an error.
+// It doesn't execute any cmds when dryRun is true, unless in a deep dry run where they
+// are executed like with Tx.
+func NoTx(cmds ...migrate.SQLCommand) migrate.StepFunc {
+	return migrate.RegisterStepKind(func(ctx context.Context, gdb migrate.Database, info migrate.StepInfo, dryRun bool, log migrate.Logger) (err error) {
+		db, ok := gdb.(*DB)
+		if !ok {
+			return fmt.Errorf("pgx sql: %w", ErrNotPgxDB)
+		}
+		if dryRun {
+			if migrate.IsDeepDryRun(ctx) {
+				return Tx(cmds...)(ctx, db, info, dryRun, log)
+			}
+			return nil
+		}
+		defer func() {
+			if err != nil {
+				log.Error("tx sql command", migrate.F("name", info.Name()), migrate.F("from", info.From()), migrate.F("to", info.To()), migrate.F("error", err.Error()))
+				err = fmt.Errorf("pgx sql %v -> %v: %w", info.From(), info.To(), err)
+			}
+		}()
+
+		dbv, err := db.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if err := migrate.CheckFrom(dbv, info); err != nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			if log.Level() >= migrate.LevelDebug {
+				log.Debug("no tx sql command", migrate.F("cmd", cmd))
+			}
+			if _, err = db.conn.Exec(ctx, cmd.Cmd, cmd.Args...); err != nil {
+				return err
+			}
+		}
+
+		if err := db.SetVersion(ctx, info, dryRun); err != nil {
+			return err
+		}
+		log.Info("migrate step", migrate.F("name", info.Name()), migrate.F("from", info.From()), migrate.F("to", info.To()), migrate.F("dryRun", dryRun))
+		return nil
+	}, migrate.StepNoTx)
+}
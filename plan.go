@@ -0,0 +1,217 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"sync"
+)
+
+// StepKind tells whether a step function executes in a transaction.
+type StepKind int
+
+const (
+	// StepOpaque is the kind of the user defined step functions whose use of a
+	// transaction is unknown.
+	StepOpaque StepKind = iota
+
+	// StepTx is the kind of the step functions executing in a transaction, like Tx,
+	// TxCounted, TxIf and TxF.
+	StepTx
+
+	// StepNoTx is the kind of the step functions executing without a transaction, like
+	// NoTx, NoTxF and Step.
+	StepNoTx
+)
+
+// stepKinds maps the code pointer of the registered step functions to their kind.
+var stepKinds sync.Map
+
+// RegisterStepKind records the kind of the step function f and returns f. The kind is
+// shared by all the step functions created by the same function literal as f. It allows
+// backends defining their own step functions to describe them.
+func RegisterStepKind(f StepFunc, kind StepKind) StepFunc {
+	stepKinds.Store(reflect.ValueOf(f).Pointer(), kind)
+	return f
+}
+
+// DescribeStep returns the kind of the step function f without calling it. A nil f only
+// changes the version and is a StepTx. The step functions wrapping another one, like
+// Isolation, and the user defined step functions are StepOpaque.
+func DescribeStep(f StepFunc) StepKind {
+	if f == nil {
+		return StepTx
+	}
+	if kind, ok := stepKinds.Load(reflect.ValueOf(f).Pointer()); ok {
+		return kind.(StepKind)
+	}
+	return StepOpaque
+}
+
+// DryRunReport accumulates the SQL commands that the Tx, TxCounted and NoTx step functions
+// would execute in a dry run.
+type DryRunReport struct {
+	Cmds     []SQLCommand // Cmds are the SQL commands that would be executed.
+	recorded bool         // recorded is true when a step function recorded its commands.
+}
+
+type dryRunReportKey struct{}
+
+// WithDryRunReport returns a context in which the Tx, TxCounted and NoTx step functions
+// executed with dryRun true append their SQL commands to the report and return without
+// accessing the database. The TxF and NoTxF step functions return without executing
+// their functions.
+func WithDryRunReport(ctx context.Context, report *DryRunReport) context.Context {
+	return context.WithValue(ctx, dryRunReportKey{}, report)
+}
+
+// skipDryRun returns true when the step function must return without accessing the
+// database because the context has a dry run report. The commands of the step function
+// are unknown.
+func skipDryRun(ctx context.Context, dryRun bool) bool {
+	report, _ := ctx.Value(dryRunReportKey{}).(*DryRunReport)
+	return report != nil && dryRun
+}
+
+// recordDryRun appends the commands to the dry run report in the context, if any, and
+// returns true when the step function must return without accessing the database.
+func recordDryRun(ctx context.Context, dryRun bool, cmds []SQLCommand) bool {
+	report, _ := ctx.Value(dryRunReportKey{}).(*DryRunReport)
+	if report == nil || !dryRun {
+		return false
+	}
+	report.Cmds = append(report.Cmds, cmds...)
+	report.recorded = true
+	return true
+}
+
+// probeStep calls the step function f in a dry run with a dry run report and a database
+// failing all the operations. The report holds the commands of f. A nil f only changes
+// the version.
+func probeStep(ctx context.Context, info StepInfo, f StepFunc) (report DryRunReport, err error) {
+	if f == nil {
+		return DryRunReport{recorded: true}, nil
+	}
+	err = f(WithDryRunReport(ctx, &report), planDB{}, info, true, NewNilLogger())
+	return report, err
+}
+
+// PlannedStep is a migration step that would be executed by AllUp.
+type PlannedStep struct {
+	Name string       `json:"name"`           // Name is the step name.
+	From Version      `json:"from"`           // From is the version before the step.
+	To   Version      `json:"to"`             // To is the version after the step.
+	Cmds []SQLCommand `json:"cmds,omitempty"` // Cmds are the SQL commands of the step.
+
+	// Opaque is true when the SQL commands of the step function are unknown, like with
+	// TxF, NoTxF or a user defined step function.
+	Opaque bool `json:"opaque,omitempty"`
+
+	// Transactional is true when the step function executes in a transaction, like with
+	// Tx or TxF. It is false for NoTx, NoTxF and the user defined step functions as
+	// reported by DescribeStep.
+	Transactional bool `json:"transactional"`
+
+	// Skipped is the reason why the step function is not executed and the step only
+	// changes the version, like SkipFilteredByTag with PlanUpTagged. It is empty when the
+	// step function is executed.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// planDB is the database given to the step functions by PlanUp. It fails all the
+// operations so that the step functions not recording their commands don't execute.
+type planDB struct{}
+
+func (planDB) InitVersion(ctx context.Context, v Version, dryRun bool) error {
+	return fmt.Errorf("plan: %w", ErrNotSQLDB)
+}
+
+func (planDB) Version(ctx context.Context) (Version, error) {
+	return badVersion, fmt.Errorf("plan: %w", ErrNotSQLDB)
+}
+
+func (planDB) DefaultStepFunc(ctx context.Context, info StepInfo, dryRun bool, log Logger) error {
+	return fmt.Errorf("plan: %w", ErrNotSQLDB)
+}
+
+// PlanUp returns the migration steps that AllUp would execute with their SQL commands,
+// without accessing the database.
+func (m *Migrator) PlanUp() ([]PlannedStep, error) {
+	return m.PlanUpCtx(context.Background())
+}
+
+// PlanUpCtx returns the migration steps that AllUp would execute from the cached database
+// version with their SQL commands, without accessing the database. The steps with a nil
+// function have no commands. The database version must have been obtained with Version
+// or Init.
+func (m *Migrator) PlanUpCtx(ctx context.Context) ([]PlannedStep, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.planUp(ctx)
+}
+
+// planUp returns the migration steps that AllUp would execute. It requires that the
+// migrator is locked.
+func (m *Migrator) planUp(ctx context.Context) ([]PlannedStep, error) {
+	var plan []PlannedStep
+	for v := m.cachedVersion; ; {
+		info, up, err := m.steps.Up(v)
+		if err != nil {
+			if errors.Is(err, ErrEndOfSteps) {
+				return plan, nil
+			}
+			return nil, fmt.Errorf("plan up: %w", err)
+		}
+		skipped := skipReason(m.steps, info.To().ID)
+		if skipped != "" {
+			up = m.defaultStep
+		}
+		report, err := probeStep(ctx, info, up)
+		plan = append(plan, PlannedStep{
+			Name:          info.Name(),
+			From:          info.From(),
+			To:            info.To(),
+			Cmds:          report.Cmds,
+			Opaque:        err != nil || !report.recorded,
+			Transactional: DescribeStep(up) == StepTx,
+			Skipped:       skipped,
+		})
+		v = info.To()
+	}
+}
+
+// PendingSteps returns an iterator over the migration steps up from the database version
+// to the last step.
+func (m *Migrator) PendingSteps() iter.Seq2[StepInfo, error] {
+	return m.PendingStepsCtx(context.Background())
+}
+
+// PendingStepsCtx returns an iterator over the migration steps up from the database
+// version to the last step, without executing them. The database version is read when
+// the iteration starts. An error reading it, or getting a step, is yielded with a nil
+// StepInfo and terminates the iteration.
+func (m *Migrator) PendingStepsCtx(ctx context.Context) iter.Seq2[StepInfo, error] {
+	return func(yield func(StepInfo, error) bool) {
+		v, err := m.VersionCtx(ctx)
+		if err != nil {
+			yield(nil, fmt.Errorf("pending steps: %w", err))
+			return
+		}
+		for {
+			info, _, err := m.steps.Up(v)
+			if errors.Is(err, ErrEndOfSteps) {
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("pending steps: %w", err))
+				return
+			}
+			if !yield(info, nil) {
+				return
+			}
+			v = info.To()
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMigratorPlanUp(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 0}}
+	s := NewSteps("test")
+	s.Append("create table", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER)`)), nil)
+	s.Append("nil step", nil, nil)
+	s.Append("insert", NoTx(Cmd(`INSERT INTO "test" ("id") VALUES (?)`, 1), Cmd(`ANALYZE`)), nil)
+	s.Append("txf", TxF(func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error {
+		t.Fatal("unexpected call")
+		return nil
+	}), nil)
+	s.Append("custom", func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		_, err := db.Version(ctx)
+		return err
+	}, nil)
+	v0, _ := s.Version(0)
+	db.version = v0
+	m, err := New(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := m.PlanUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 5 {
+		t.Fatalf("expect 5 planned steps, got %d", len(plan))
+	}
+	if p := plan[0]; p.Name != "create table" || p.From != v0 || p.To.ID != 1 || len(p.Cmds) != 1 || p.Opaque {
+		t.Fatalf("unexpected planned step %+v", p)
+	}
+	if p := plan[1]; len(p.Cmds) != 0 || p.Opaque {
+		t.Fatalf("unexpected planned step %+v", p)
+	}
+	if p := plan[2]; len(p.Cmds) != 2 || p.Cmds[0].Args[0] != 1 || p.Opaque {
+		t.Fatalf("unexpected planned step %+v", p)
+	}
+	if p := plan[3]; len(p.Cmds) != 0 || !p.Opaque {
+		t.Fatalf("unexpected planned step %+v", p)
+	}
+	if p := plan[4]; !p.Opaque {
+		t.Fatalf("unexpected planned step %+v", p)
+	}
+	for i, exp := range []bool{true, true, false, true, false} {
+		if plan[i].Transactional != exp {
+			t.Fatalf("expect step %d transactional %t, got %t", i+1, exp, plan[i].Transactional)
+		}
+	}
+	if db.version != v0 {
+		t.Fatalf("expect %v, got %v", v0, db.version)
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range []bool{false, true, true, false, true, false} {
+		if status[i].Transactional != exp {
+			t.Fatalf("expect step %d transactional %t, got %t", i, exp, status[i].Transactional)
+		}
+	}
+
+	data, err := json.Marshal(plan[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `"cmds":[{"cmd":"INSERT INTO \"test\" (\"id\") VALUES (?)","args":[1]},{"cmd":"ANALYZE"}]`; !strings.Contains(string(data), exp) {
+		t.Fatalf("expect %s in %s", exp, data)
+	}
+
+	m.cachedVersion, _ = s.Version(5)
+	if plan, err := m.PlanUp(); err != nil || len(plan) != 0 {
+		t.Fatalf("expect empty plan, got %v, %v", plan, err)
+	}
+}
+
+func TestMigratorPendingSteps(t *testing.T) {
+	db := &mockDatabase{version: Version{ID: 1}}
+	m, err := New(db, &mockStepper{[]StepFunc{nil, mockFunc, mockFunc, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for info, err := range m.PendingSteps() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, info.Name())
+	}
+	if exp := []string{"step 2", "step 3"}; !slices.Equal(names, exp) {
+		t.Fatalf("expect %v, got %v", exp, names)
+	}
+	if db.version.ID != 1 {
+		t.Fatalf("expect v1, got %v", db.version)
+	}
+
+	names = nil
+	for info := range m.PendingSteps() {
+		names = append(names, info.Name())
+		break
+	}
+	if len(names) != 1 {
+		t.Fatalf("expect 1 step, got %v", names)
+	}
+
+	db.versionErr = errMock
+	var count int
+	for info, err := range m.PendingSteps() {
+		count++
+		if info != nil || !errors.Is(err, errMock) {
+			t.Fatalf("expect %v, got %v %v", errMock, info, err)
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expect 1 error, got %d", count)
+	}
+}
+
+func TestDescribeStep(t *testing.T) {
+	txf := TxF(func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error { return nil })
+	noTxF := NoTxF(func(ctx context.Context, db SQLDB, info StepInfo, log Logger) error { return nil })
+	tests := []struct {
+		f   StepFunc
+		exp StepKind
+	}{
+		{nil, StepTx},
+		{Tx(Cmd(`SELECT 1`)), StepTx},
+		{TxCounted(nil, Cmd(`SELECT 1`)), StepTx},
+		{TxIf(func(tx SQLTx) (bool, error) { return true, nil }), StepTx},
+		{txf, StepTx},
+		{NoTx(Cmd(`SELECT 1`)), StepNoTx},
+		{noTxF, StepNoTx},
+		{Step(), StepNoTx},
+		{Isolation(0, txf), StepOpaque},
+		{mockFunc, StepOpaque},
+	}
+	for i, test := range tests {
+		if kind := DescribeStep(test.f); kind != test.exp {
+			t.Fatalf("%d: expect %v, got %v", i, test.exp, kind)
+		}
+	}
+}
+
+func TestMigratorStatusNoCall(t *testing.T) {
+	s := NewSteps("test")
+	s.Append("tx", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER)`)), nil)
+	s.Append("custom", func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		t.Fatal("unexpected call")
+		return nil
+	}, nil)
+	s.Append("notx", NoTx(Cmd(`ANALYZE`)), nil)
+	v0, _ := s.Version(0)
+	m, err := New(&mockDatabase{version: v0}, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range []bool{false, true, false, false} {
+		if status[i].Transactional != exp {
+			t.Fatalf("expect step %d transactional %t, got %t", i, exp, status[i].Transactional)
+		}
+	}
+}
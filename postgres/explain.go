@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chmike/migrate"
+)
+
+// ExplainedCmd is an SQL command of a migration step with the query plan estimated by
+// the PostgreSQL planner.
+type ExplainedCmd struct {
+	Cmd       migrate.SQLCommand // Cmd is the SQL command.
+	Explained bool               // Explained is false when the command can't be explained.
+	Plan      []string           // Plan are the lines of the query plan.
+	Cost      float64            // Cost is the estimated total cost of the command.
+}
+
+func (c ExplainedCmd) String() string {
+	if !c.Explained {
+		return fmt.Sprintf("%v: not explained", c.Cmd)
+	}
+	return fmt.Sprintf("%v: cost=%.2f", c.Cmd, c.Cost)
+}
+
+// explainable are the leading keywords of the statements accepted by EXPLAIN.
+var explainable = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "VALUES", "WITH", "TABLE", "EXECUTE"}
+
+// isExplainable returns true if the command is accepted by EXPLAIN.
+func isExplainable(cmd string) bool {
+	cmd = strings.TrimLeft(cmd, " \t\r\n(")
+	for _, keyword := range explainable {
+		if len(cmd) >= len(keyword) && strings.EqualFold(cmd[:len(keyword)], keyword) &&
+			(len(cmd) == len(keyword) || !isIdentChar(cmd[len(keyword)])) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// costRe matches the total cost in a query plan line.
+var costRe = regexp.MustCompile(`cost=[0-9.]+\.\.([0-9.]+)`)
+
+// explain returns the query plan of the command.
+func explain(tx migrate.SQLTx, cmd migrate.SQLCommand) (ExplainedCmd, error) {
+	e := ExplainedCmd{Cmd: cmd, Explained: true}
+	rows, err := tx.Tx().Query("EXPLAIN "+cmd.Cmd, cmd.Args...)
+	if err != nil {
+		return e, fmt.Errorf("explain: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return e, fmt.Errorf("explain: %w", err)
+		}
+		e.Plan = append(e.Plan, line)
+	}
+	if err := rows.Err(); err != nil {
+		return e, fmt.Errorf("explain: %w", err)
+	}
+	if len(e.Plan) > 0 {
+		if m := costRe.FindStringSubmatch(e.Plan[0]); m != nil {
+			e.Cost, _ = strconv.ParseFloat(m[1], 64)
+		}
+	}
+	return e, nil
+}
+
+// ExplainUp performs a dry run of the next migration step up in which the SQL commands
+// of the Tx and TxCounted step functions are prefixed with EXPLAIN, and returns their
+// query plan. The planner estimates the cost of the commands without executing them.
+//
+// Commands that EXPLAIN doesn't accept, like DDL, are executed so that the following
+// commands are planned against the modified schema. All changes are rolled back at the
+// end of the dry run. The commands of the other step functions are not explained.
+func ExplainUp(ctx context.Context, m *Migrator) ([]ExplainedCmd, error) {
+	var cmds []ExplainedCmd
+	ctx = migrate.WithCmdExecutor(ctx, func(tx migrate.SQLTx, cmd migrate.SQLCommand) error {
+		if !isExplainable(cmd.Cmd) {
+			cmds = append(cmds, ExplainedCmd{Cmd: cmd})
+			_, err := tx.Tx().Exec(cmd.Cmd, cmd.Args...)
+			return err
+		}
+		e, err := explain(tx, cmd)
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, e)
+		return nil
+	})
+	if err := m.OneUpDryRunCtx(ctx); err != nil {
+		return nil, fmt.Errorf("explain up: %w", err)
+	}
+	return cmds, nil
+}
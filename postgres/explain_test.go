@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIsExplainable(t *testing.T) {
+	tests := []struct {
+		cmd string
+		exp bool
+	}{
+		{`UPDATE "test" SET "msg" = 'a'`, true},
+		{` select 1`, true},
+		{`(SELECT 1)`, true},
+		{`WITH t AS (SELECT 1) DELETE FROM "test"`, true},
+		{`CREATE TABLE "test" ("id" INTEGER)`, false},
+		{`ALTER TABLE "test" ADD COLUMN "x" TEXT`, false},
+		{`UPDATEX`, false},
+		{``, false},
+	}
+	for _, test := range tests {
+		if got := isExplainable(test.cmd); got != test.exp {
+			t.Errorf("%q: expect %t, got %t", test.cmd, test.exp, got)
+		}
+	}
+}
+
+func TestExplainUp(t *testing.T) {
+	mock := newMock(t, "explain")
+	db, err := Open("explain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+
+	s := NewSteps("test database")
+	s.Append("backfill",
+		Tx(
+			Cmd(`ALTER TABLE "test" ADD COLUMN "flag" BOOLEAN`),
+			Cmd(`UPDATE "test" SET "flag" = $1`, true),
+		),
+		Tx(Cmd(`ALTER TABLE "test" DROP COLUMN "flag"`)),
+	)
+	v0, _ := s.Version(0)
+	v1, _ := s.Version(1)
+
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(0, v0.ChecksumString()))
+	mock.ExpectCommit()
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(0, v0.ChecksumString()))
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "test" ADD COLUMN "flag" BOOLEAN`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`EXPLAIN UPDATE "test" SET "flag" = $1`)).WithArgs(true).
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).
+			AddRow(`Update on test  (cost=0.00..22.70 rows=0 width=0)`).
+			AddRow(`  ->  Seq Scan on test  (cost=0.00..22.70 rows=1270 width=7)`))
+	mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+		WithArgs(1, v1.ChecksumString(), 0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	cmds, err := ExplainUp(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 2 {
+		t.Fatalf("expect 2 commands, got %d", len(cmds))
+	}
+	if cmds[0].Explained {
+		t.Fatalf("expect DDL not explained, got %v", cmds[0])
+	}
+	if !cmds[1].Explained || len(cmds[1].Plan) != 2 || cmds[1].Cost != 22.70 {
+		t.Fatalf("unexpected explained command %+v", cmds[1])
+	}
+	if exp := "`UPDATE \"test\" SET \"flag\" = $1` args:[true]: cost=22.70"; cmds[1].String() != exp {
+		t.Fatalf("expect %q, got %q", exp, cmds[1].String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/chmike/migrate"
+)
+
+// unlockTimeout is the maximum duration of the release of the advisory lock.
+var unlockTimeout = 5 * time.Second
+
+// locker is a migration locker using a PostgreSQL session level advisory lock.
+type locker struct {
+	mu   sync.Mutex
+	db   *sql.DB
+	key  int64
+	conn *sql.Conn
+}
+
+// NewLocker returns a migration locker using a PostgreSQL session level advisory lock
+// whose key is derived from name. The migrators sharing the same name exclude each other.
+// The lock is held by a dedicated connection and is released by PostgreSQL if the
+// connection is lost.
+func NewLocker(db *sql.DB, name string) migrate.Locker {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return &locker{db: db, key: int64(h.Sum64())}
+}
+
+// Lock acquires the advisory lock with pg_try_advisory_lock. It returns
+// migrate.ErrMigrationLocked if the lock is held by another session.
+func (l *locker) Lock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		return fmt.Errorf("%w: already locked", migrate.ErrMigrationLocked)
+	}
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&locked); err != nil {
+		conn.Close()
+		return fmt.Errorf("lock: %w", err)
+	}
+	if !locked {
+		conn.Close()
+		return fmt.Errorf("%w: advisory lock %d", migrate.ErrMigrationLocked, l.key)
+	}
+	l.conn = conn
+	return nil
+}
+
+// Unlock releases the advisory lock with pg_advisory_unlock. The lock is released even
+// when ctx is cancelled, like after a cancelled AllUp. When it can't be released, the
+// connection is discarded instead of being returned to the pool so that PostgreSQL
+// releases the lock when closing the session.
+func (l *locker) Unlock(ctx context.Context) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return fmt.Errorf("unlock: not locked")
+	}
+	defer func() {
+		if err != nil {
+			l.conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		l.conn.Close()
+		l.conn = nil
+	}()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unlockTimeout)
+	defer cancel()
+	var unlocked bool
+	if err := l.conn.QueryRowContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key).Scan(&unlocked); err != nil {
+		return fmt.Errorf("unlock: %w", err)
+	}
+	if !unlocked {
+		return fmt.Errorf("unlock: advisory lock %d was not held", l.key)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chmike/migrate"
+)
+
+func TestLocker(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	ctx := context.Background()
+
+	l := NewLocker(mockDB, "test")
+	key := l.(*locker).key
+	lockQuery := regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)
+	unlockQuery := regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)
+
+	mock.ExpectQuery(lockQuery).WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	if err := l.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Lock(ctx); !errors.Is(err, migrate.ErrMigrationLocked) {
+		t.Fatalf("expect %v, got %v", migrate.ErrMigrationLocked, err)
+	}
+	mock.ExpectQuery(unlockQuery).WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"unlocked"}).AddRow(true))
+	if err := l.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unlock(ctx); err == nil {
+		t.Fatal("expect error")
+	}
+
+	mock.ExpectQuery(lockQuery).WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	if err := l.Lock(ctx); !errors.Is(err, migrate.ErrMigrationLocked) {
+		t.Fatalf("expect %v, got %v", migrate.ErrMigrationLocked, err)
+	}
+
+	mock.ExpectQuery(lockQuery).WithArgs(key).WillReturnError(errors.New("query error"))
+	if err := l.Lock(ctx); err == nil || errors.Is(err, migrate.ErrMigrationLocked) {
+		t.Fatalf("expect query error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockerUnlockCancelled(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l := NewLocker(mockDB, "test")
+	key := l.(*locker).key
+	lockQuery := regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)
+	unlockQuery := regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)
+
+	// The lock is released with a cancelled context.
+	mock.ExpectQuery(lockQuery).WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	if err := l.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	mock.ExpectQuery(unlockQuery).WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"unlocked"}).AddRow(true))
+	if err := l.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection is discarded when the lock can't be released.
+	ctx = context.Background()
+	mock.ExpectQuery(lockQuery).WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	if err := l.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(unlockQuery).WithArgs(key).WillReturnError(errors.New("query error"))
+	mock.ExpectClose()
+	if err := l.Unlock(ctx); err == nil {
+		t.Fatal("expect error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
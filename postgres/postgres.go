@@ -0,0 +1,292 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chmike/migrate"
+
+	_ "github.com/lib/pq"
+)
+
+// NewSteps instantiates a new migration step sequence. The name should not be
+// empty and ideally unique to the database as it is used to compute the root
+// checksum identifying the database.
+func NewSteps(name string) *migrate.Steps {
+	return migrate.NewSteps(name)
+}
+
+// NewStepsWith instantiates a new migration step sequence using the checksum function
+// fn. Changing the checksum function invalidates the version stored in the database.
+func NewStepsWith(name string, fn migrate.ChecksumFunc) *migrate.Steps {
+	return migrate.NewStepsWith(name, fn)
+}
+
+func init() {
+	for _, scheme := range []string{"postgres", "postgresql"} {
+		migrate.Register(scheme, func(url string) (migrate.SQLDB, error) {
+			return Open(url)
+		})
+	}
+}
+
+type config struct {
+	tableName       string
+	schema          string
+	history         bool
+	comment         string
+	connectAttempts int
+	connectBackoff  time.Duration
+}
+
+// Option function.
+type Option func(*config)
+
+// WithTableName changes the default version table name.
+func WithTableName(tableName string) Option {
+	return func(c *config) {
+		c.tableName = tableName
+	}
+}
+
+// WithSchema sets the schema of the version table. The search path of the
+// connection is used by default.
+func WithSchema(schema string) Option {
+	return func(c *config) {
+		c.schema = schema
+	}
+}
+
+// WithHistory records each change of the version in a history table created by Init.
+// The history table is named after the version table with its _version suffix replaced
+// by _history, like migrate_history.
+func WithHistory() Option {
+	return func(c *config) {
+		c.history = true
+	}
+}
+
+// WithTableComment makes Init document the version table with a COMMENT ON TABLE
+// setting the given text, which helps DBAs discovering the table.
+func WithTableComment(text string) Option {
+	return func(c *config) {
+		c.comment = text
+	}
+}
+
+// WithConnectRetry makes Open try to connect to the database at most attempts times,
+// waiting backoff after the first failure and doubling the waiting time after each
+// following failure. It allows to wait for a database that is not yet ready.
+func WithConnectRetry(attempts int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.connectAttempts = attempts
+		c.connectBackoff = backoff
+	}
+}
+
+// validName matches a valid unquoted PostgreSQL identifier.
+var validName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,62}$`)
+
+// driverName is the name of the sql driver.
+var driverName = "postgres"
+
+// Open opens a PostgreSQL database with the given data source name.
+func Open(dsn string, options ...Option) (migrate.SQLDB, error) {
+	c := config{tableName: "migrate_version"}
+	for _, option := range options {
+		option(&c)
+	}
+	if !validName.MatchString(c.tableName) {
+		return nil, fmt.Errorf("new postgres: invalid table name '%s'", c.tableName)
+	}
+	if c.schema != "" && !validName.MatchString(c.schema) {
+		return nil, fmt.Errorf("new postgres: invalid schema name '%s'", c.schema)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate.ConnectRetry(c.connectAttempts, c.connectBackoff, db.Ping); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return migrate.NewSQLDB(db, queries(c)), nil
+}
+
+// queries returns the PostgreSQL queries for the configured version table.
+func queries(c config) *migrate.Queries {
+	table := `"` + c.tableName + `"`
+	history := `"` + strings.TrimSuffix(c.tableName, "_version") + `_history"`
+	if c.schema != "" {
+		table = `"` + c.schema + `".` + table
+		history = `"` + c.schema + `".` + history
+	}
+	q := &migrate.Queries{
+		CreateTableQuery: `CREATE TABLE IF NOT EXISTS ` + table + ` ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+		InitTableQuery:   `INSERT INTO ` + table + ` ("id", "checksum") VALUES ($1, $2)`,
+		VersionQuery:     `SELECT "id", "checksum" FROM ` + table + ` LIMIT 1`,
+		SetVersionQuery:  `UPDATE ` + table + ` SET "id" = $1, "checksum" = $2 WHERE "id" = $3 AND "checksum" = $4`,
+		TransactionalDDL: true,
+	}
+	if c.comment != "" {
+		q.CommentTableQuery = `COMMENT ON TABLE ` + table + ` IS '` + strings.ReplaceAll(c.comment, `'`, `''`) + `'`
+	}
+	if c.history {
+		q.CreateHistoryQuery = `CREATE TABLE IF NOT EXISTS ` + history + ` ("id" BIGSERIAL PRIMARY KEY, "from_id" INTEGER NOT NULL, "to_id" INTEGER NOT NULL, "name" TEXT NOT NULL, "applied_at" TIMESTAMPTZ NOT NULL, "dry_run" BOOLEAN NOT NULL)`
+		q.InsertHistoryQuery = `INSERT INTO ` + history + ` ("from_id", "to_id", "name", "applied_at", "dry_run") VALUES ($1, $2, $3, $4, $5)`
+		q.HistoryQuery = `SELECT "id", "from_id", "to_id", "name", "applied_at", "dry_run" FROM ` + history + ` ORDER BY "id"`
+	}
+	return q
+}
+
+// New returns a new migrator.
+func NewMigrator(db migrate.SQLDB, s migrate.Stepper, l migrate.Logger, options ...migrate.Option) (*Migrator, error) {
+	return migrate.New(db, s, l, options...)
+}
+
+// Cmd is a function simplifying the creation of a Command.
+func Cmd(cmd string, args ...any) migrate.SQLCommand {
+	return migrate.SQLCommand{Cmd: cmd, Args: args}
+}
+
+// Tx returns a migration step function that executes all the SQL commands in
+// sequence wrapped in a transaction. The execution stops and rolls back as soon
+// as an error is returned by one of the commands. It is also rolled back when dryRun
+// is true.
+func Tx(cmds ...migrate.SQLCommand) migrate.StepFunc {
+	return migrate.Tx(cmds...)
+}
+
+// TxCounted returns a migration step function like Tx that also counts the rows of the
+// given tables before and after executing the commands. The counts are performed in the
+// same transaction as the commands and the row count delta of each table is logged at
+// the info level.
+func TxCounted(tables []string, cmds ...migrate.SQLCommand) migrate.StepFunc {
+	return migrate.TxCounted(tables, cmds...)
+}
+
+// Isolation returns a migration step function calling f with a context in which the
+// transactions of the step functions use the given isolation level instead of
+// sql.LevelSerializable.
+func Isolation(level sql.IsolationLevel, f migrate.StepFunc) migrate.StepFunc {
+	return migrate.Isolation(level, f)
+}
+
+// NoTx returns a migration step function that executes the SQL commands in sequence
+// without a wrapping transaction. It terminates as soon as a command returns an error.
+// It doesn't execute any cmds when dryRun is true, unless in a deep dry run.
+func NoTx(cmds ...migrate.SQLCommand) StepFunc {
+	return migrate.NoTx(cmds...)
+}
+
+// TxIf returns a migration step function like Tx that executes the SQL commands only if
+// cond returns true. When it returns false, the commands are skipped and the version is
+// changed as if they were executed.
+func TxIf(cond func(tx SQLTx) (bool, error), cmds ...migrate.SQLCommand) StepFunc {
+	return migrate.TxIf(cond, cmds...)
+}
+
+// TxFunc is an migrate.TxFunc.
+type TxFunc = migrate.TxFunc
+
+// TxF returns a migration step function that executes all the user provided functions in
+// sequence wrapped in a transaction. The execution stops and rolls back as soon
+// as an error is returned by one of the function and the step function returns the error.
+//
+// A user function may return the ErrAbort pseudo error to force a termination of the
+// function execution and the AllUp or AllDown execution which will return the ErrAbort
+// error. To force a roll back of the transaction without terminating the execution of
+// subsequent functions and migration steps, it must return the ErrCancel pseudo error.
+// The migration step function will return nil as error.
+func TxF(fs ...TxFunc) StepFunc {
+	return migrate.TxF(fs...)
+}
+
+// NoTxFunc is an migrate.NoTxFunc.
+type NoTxFunc = migrate.NoTxFunc
+
+// NoTxF returns a migration step function that executes the user provided functions in sequence
+// without a wrapping transaction. It terminates as soon as a function returns an error.
+// It doesn't execute any function when dryRun is true. The pseudo error ErrCancel is
+// treated as ErrAbort as operations can't be cancelled and database version remains v1.
+// The pseudo error ErrSkip skips the remaining functions and still changes the version.
+//
+// Use with care as any error in the function may leave the database is an undefined state.
+func NoTxF(fs ...NoTxFunc) migrate.StepFunc {
+	return migrate.NoTxF(fs...)
+}
+
+// ExecTx executes the SQL commands in sequence in the transaction tx and logs them at the
+// debug level like Tx. It is intended to be called by a TxFunc.
+func ExecTx(tx SQLTx, log Logger, cmds ...migrate.SQLCommand) error {
+	return migrate.ExecTx(tx, log, cmds...)
+}
+
+// ExecNoTx executes the SQL commands in sequence without a transaction and logs them at
+// the debug level like NoTx. It is intended to be called by a NoTxFunc.
+func ExecNoTx(ctx context.Context, db SQLDB, log Logger, cmds ...migrate.SQLCommand) error {
+	return migrate.ExecNoTx(ctx, db, log, cmds...)
+}
+
+// Describe returns a TxFunc calling f after logging the description at the debug level.
+func Describe(description string, f TxFunc) TxFunc {
+	return migrate.Describe(description, f)
+}
+
+// DescribeNoTx returns a NoTxFunc calling f after logging the description at the debug
+// level.
+func DescribeNoTx(description string, f NoTxFunc) NoTxFunc {
+	return migrate.DescribeNoTx(description, f)
+}
+
+// FindVersionTables returns the schema qualified names of the tables having the shape of
+// a version table, which is an "id" integer column, a "checksum" text or bytea column, any
+// other extra columns, and a single row. It helps finding orphaned version tables when WithTableName or WithSchema were used
+// inconsistently.
+func FindVersionTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`SELECT "table_schema", "table_name" FROM "information_schema"."columns"
+		WHERE "table_schema" NOT IN ('pg_catalog', 'information_schema')
+		GROUP BY "table_schema", "table_name"
+		HAVING COUNT(*) FILTER (WHERE "column_name" = 'id' AND "data_type" = 'integer') = 1
+			AND COUNT(*) FILTER (WHERE "column_name" = 'checksum' AND "data_type" IN ('text', 'bytea')) = 1
+		ORDER BY "table_schema", "table_name"`)
+	if err != nil {
+		return nil, fmt.Errorf("find version tables: %w", err)
+	}
+	var candidates [][2]string
+	for rows.Next() {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("find version tables: %w", err)
+		}
+		candidates = append(candidates, [2]string{schema, name})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("find version tables: %w", err)
+	}
+
+	var tables []string
+	for _, c := range candidates {
+		var count int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s.%s`, quote(c[0]), quote(c[1]))
+		if err := db.QueryRow(query).Scan(&count); err != nil {
+			return nil, fmt.Errorf("find version tables: %w", err)
+		}
+		if count == 1 {
+			tables = append(tables, c[0]+"."+c[1])
+		}
+	}
+	return tables, nil
+}
+
+// quote returns the quoted identifier.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
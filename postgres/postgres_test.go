@@ -0,0 +1,221 @@
+package postgres
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chmike/migrate"
+)
+
+func init() {
+	driverName = "sqlmock"
+}
+
+// newMock returns a mocked database registered with the given data source name.
+func newMock(t *testing.T, dsn string) sqlmock.Sqlmock {
+	mockDB, mock, err := sqlmock.NewWithDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	return mock
+}
+
+func TestPostgresOpenErrors(t *testing.T) {
+	if _, err := Open("dsn", WithTableName("table with space")); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("dsn", WithSchema("schema.name")); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("unknown dsn"); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open("unknown dsn", WithConnectRetry(3, time.Millisecond)); err == nil || !strings.Contains(err.Error(), "3 times") {
+		t.Fatalf("expect connect error, got %v", err)
+	}
+}
+
+func TestConnectRetry(t *testing.T) {
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		if mockDB, _, err := sqlmock.NewWithDSN("late"); err == nil {
+			t.Cleanup(func() { mockDB.Close() })
+		}
+	}()
+	if _, err := Open("late", WithConnectRetry(10, time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresQueries(t *testing.T) {
+	newMock(t, "queries")
+
+	db, err := Open("queries", WithTableName("temp_version"), WithSchema("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := migrate.Queries{
+		CreateTableQuery: `CREATE TABLE IF NOT EXISTS "app"."temp_version" ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+		InitTableQuery:   `INSERT INTO "app"."temp_version" ("id", "checksum") VALUES ($1, $2)`,
+		VersionQuery:     `SELECT "id", "checksum" FROM "app"."temp_version" LIMIT 1`,
+		SetVersionQuery:  `UPDATE "app"."temp_version" SET "id" = $1, "checksum" = $2 WHERE "id" = $3 AND "checksum" = $4`,
+		TransactionalDDL: true,
+	}
+	if *db.Queries() != exp {
+		t.Fatalf("expect %+v, got %+v", exp, *db.Queries())
+	}
+}
+
+func TestPostgresHistoryQueries(t *testing.T) {
+	newMock(t, "history")
+
+	db, err := Open("history", WithHistory(), WithTableName("temp_version"), WithSchema("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+	if exp := `INSERT INTO "app"."temp_history" ("from_id", "to_id", "name", "applied_at", "dry_run") VALUES ($1, $2, $3, $4, $5)`; q.InsertHistoryQuery != exp {
+		t.Fatalf("expect %q, got %q", exp, q.InsertHistoryQuery)
+	}
+	if exp := `SELECT "id", "from_id", "to_id", "name", "applied_at", "dry_run" FROM "app"."temp_history" ORDER BY "id"`; q.HistoryQuery != exp {
+		t.Fatalf("expect %q, got %q", exp, q.HistoryQuery)
+	}
+	if !strings.HasPrefix(q.CreateHistoryQuery, `CREATE TABLE IF NOT EXISTS "app"."temp_history" (`) {
+		t.Fatalf("unexpected create history query %q", q.CreateHistoryQuery)
+	}
+}
+
+func TestPostgresMigrate(t *testing.T) {
+	mock := newMock(t, "migrate")
+
+	db, err := Open("migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+
+	s := NewSteps("test database")
+	s.Append("create table",
+		Tx(Cmd(`CREATE TABLE "test" ("id" SERIAL PRIMARY KEY, "msg" TEXT NOT NULL)`)),
+		Tx(Cmd(`DROP TABLE "test"`)),
+	)
+	v0, _ := s.Version(0)
+	v1, _ := s.Version(1)
+
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).WillReturnError(errors.New(`relation "migrate_version" does not exist`))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(q.CreateTableQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(q.InitTableQuery)).WithArgs(0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(0, v0.ChecksumString()))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE "test"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(q.SetVersionQuery)).
+		WithArgs(1, v1.ChecksumString(), 0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresTableComment(t *testing.T) {
+	mock := newMock(t, "comment")
+
+	db, err := Open("comment", WithTableComment("Version of the schema, managed by the app's migrator"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := db.Queries()
+	if exp := `COMMENT ON TABLE "migrate_version" IS 'Version of the schema, managed by the app''s migrator'`; q.CommentTableQuery != exp {
+		t.Fatalf("expect %q, got %q", exp, q.CommentTableQuery)
+	}
+
+	s := NewSteps("test database")
+	v0, _ := s.Version(0)
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).WillReturnError(errors.New(`relation "migrate_version" does not exist`))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(q.CreateTableQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(q.CommentTableQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(q.InitTableQuery)).WithArgs(0, v0.ChecksumString()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindVersionTables(t *testing.T) {
+	mock := newMock(t, "find")
+	db, err := Open("find")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`(?s)SELECT "table_schema", "table_name" FROM "information_schema"."columns".*IN \('text', 'bytea'\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name"}).
+			AddRow("public", "migrate_version").
+			AddRow("public", "empty_version"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM "public"."migrate_version"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM "public"."empty_version"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	tables, err := FindVersionTables(db.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"public.migrate_version"}; !slices.Equal(tables, exp) {
+		t.Fatalf("expect %v, got %v", exp, tables)
+	}
+
+	mock.ExpectQuery(`SELECT "table_schema", "table_name"`).WillReturnError(errors.New("query error"))
+	if _, err := FindVersionTables(db.DB()); err == nil {
+		t.Fatal("expect error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	for _, url := range []string{"postgres://user@host/db", "postgresql://user@host/db"} {
+		newMock(t, url)
+		db, err := migrate.OpenURL(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := `SELECT "id", "checksum" FROM "migrate_version" LIMIT 1`; db.Queries().VersionQuery != exp {
+			t.Fatalf("expect %q, got %q", exp, db.Queries().VersionQuery)
+		}
+	}
+}
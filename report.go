@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StepDuration is the duration of an applied migration step.
+type StepDuration struct {
+	StepID   int           // StepID is the ID of the step.
+	Name     string        // Name is the step name.
+	Duration time.Duration // Duration is the duration of the step execution.
+}
+
+// RunReport is the report of the migration steps applied by AllUpReport.
+type RunReport struct {
+	Steps []StepDuration // Steps are the applied steps in execution order.
+	Total time.Duration  // Total is the elapsed time of the whole run.
+}
+
+func (r RunReport) String() string {
+	return fmt.Sprintf("%d migration steps applied in %v", len(r.Steps), r.Total)
+}
+
+// AllUpReport executes all migration steps up like AllUp and returns the duration of
+// the applied steps.
+func (m *Migrator) AllUpReport() (RunReport, error) {
+	return m.AllUpReportCtx(context.Background())
+}
+
+// AllUpReportCtx executes all migration steps up like AllUpCtx and returns the duration
+// of the applied steps. When a step fails, the report holds the steps applied before it.
+func (m *Migrator) AllUpReportCtx(ctx context.Context) (RunReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var r RunReport
+	start := time.Now()
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return r, m.setLastError(fmt.Errorf("all up: %w", err))
+	}
+	m.report = &r
+	err = unlock(m.allUp(ctx))
+	m.report = nil
+	r.Total = time.Since(start)
+	return r, m.setLastError(err)
+}
+
+// reportStep appends the step to the run report, if any.
+func (m *Migrator) reportStep(info StepInfo, dryRun bool, err error, d time.Duration) {
+	if m.report == nil || dryRun || err != nil {
+		return
+	}
+	m.report.Steps = append(m.report.Steps, StepDuration{StepID: info.To().ID, Name: info.Name(), Duration: d})
+}
@@ -0,0 +1,49 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMigratorAllUpReport(t *testing.T) {
+	failFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		return errMock
+	}
+	db := &mockDatabase{version: Version{ID: 0}}
+	m, err := New(db, &mockStepper{[]StepFunc{nil, mockFunc, nil, failFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := m.AllUpReport()
+	if !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if len(r.Steps) != 2 {
+		t.Fatalf("expect 2 steps, got %v", r.Steps)
+	}
+	var sum int64
+	for i, step := range r.Steps {
+		if step.StepID != i+1 || step.Name != fmt.Sprintf("step %d", i+1) {
+			t.Fatalf("unexpected step %+v", step)
+		}
+		sum += int64(step.Duration)
+	}
+	if int64(r.Total) < sum {
+		t.Fatalf("expect total %v to be at least %v", r.Total, sum)
+	}
+	if exp := "2 migration steps applied in " + r.Total.String(); r.String() != exp {
+		t.Fatalf("expect %q, got %q", exp, r.String())
+	}
+
+	if err := m.OneUpDryRun(); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if m.report != nil {
+		t.Fatal("expect no report after AllUpReport")
+	}
+}
@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// StepResult is the result of a migration step written as a JSON line in the result file.
+type StepResult struct {
+	Name     string  `json:"name"`            // Name is the step name.
+	From     string  `json:"from"`            // From is the version before the step.
+	To       string  `json:"to"`              // To is the version after the step.
+	Duration float64 `json:"duration"`        // Duration is the step duration in seconds.
+	DryRun   bool    `json:"dryRun"`          // DryRun is true for a dry run.
+	Error    string  `json:"error,omitempty"` // Error is the step error.
+}
+
+// WithResultFile appends the result of every executed migration step to the file at path
+// as a JSON object per line. The file is created if needed, opened by New and closed by
+// Close.
+func WithResultFile(path string) Option {
+	return func(m *Migrator) {
+		m.resultPath = path
+	}
+}
+
+// openResultFile opens the result file, if any.
+func (m *Migrator) openResultFile() error {
+	if m.resultPath == "" {
+		return nil
+	}
+	f, err := os.OpenFile(m.resultPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("result file: %w", err)
+	}
+	m.resultFile = f
+	return nil
+}
+
+// writeResult writes the result of a migration step in the result file, if any. A write
+// error is logged as it is not a migration error.
+func (m *Migrator) writeResult(info StepInfo, dryRun bool, err error, d time.Duration) {
+	if m.resultFile == nil {
+		return
+	}
+	r := StepResult{
+		Name:     info.Name(),
+		From:     info.From().String(),
+		To:       info.To().String(),
+		Duration: d.Seconds(),
+		DryRun:   dryRun,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := json.NewEncoder(m.resultFile).Encode(r); err != nil {
+		m.logger.Warn("result file", F("error", err.Error()))
+	}
+}
+
+// closeResultFile closes the result file, if any.
+func (m *Migrator) closeResultFile() error {
+	if m.resultFile == nil {
+		return nil
+	}
+	err := m.resultFile.Close()
+	m.resultFile = nil
+	return err
+}
@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigratorResultFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.ndjson")
+	db := &mockDatabase{version: Version{ID: 0}}
+	failFunc := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		return errMock
+	}
+	steps := &mockStepper{[]StepFunc{nil, mockFunc, mockFunc, failFunc}}
+	m, err := New(db, steps, nil, WithResultFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUpDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err == nil {
+		t.Fatal("expect error")
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var results []StepResult
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r StepResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		results = append(results, r)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expect 4 results, got %d", len(results))
+	}
+	if r := results[0]; r.Name != "step 1" || !r.DryRun || r.Error != "" {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if r := results[2]; r.Name != "step 2" || r.DryRun || r.From != (Version{ID: 1}).String() || r.To != (Version{ID: 2}).String() {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if r := results[3]; r.Name != "step 3" || r.Error != errMock.Error() {
+		t.Fatalf("unexpected result %+v", r)
+	}
+
+	if _, err := New(db, steps, nil, WithResultFile(filepath.Join(path, "invalid"))); err == nil {
+		t.Fatal("expect error")
+	}
+}
@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// StepSnapshot is the serialized form of a migration step.
+type StepSnapshot struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Checksum string `json:"checksum"`
+}
+
+// DiffKind is the kind of difference between two step snapshots.
+type DiffKind string
+
+const (
+	// DiffAdded is a step present only in the new snapshot.
+	DiffAdded DiffKind = "added"
+
+	// DiffRemoved is a step present only in the old snapshot.
+	DiffRemoved DiffKind = "removed"
+
+	// DiffRenamed is a step whose name differs between the snapshots.
+	DiffRenamed DiffKind = "renamed"
+)
+
+// StepDiff is a difference between two step snapshots.
+type StepDiff struct {
+	ID      int      `json:"id"`
+	Kind    DiffKind `json:"kind"`
+	OldName string   `json:"oldName,omitempty"`
+	NewName string   `json:"newName,omitempty"`
+}
+
+func (d StepDiff) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("%d added '%s'", d.ID, d.NewName)
+	case DiffRemoved:
+		return fmt.Sprintf("%d removed '%s'", d.ID, d.OldName)
+	default:
+		return fmt.Sprintf("%d renamed '%s' -> '%s'", d.ID, d.OldName, d.NewName)
+	}
+}
+
+// Snapshot returns the JSON encoded list of steps with their ID, name and checksum. It
+// may be committed as a golden file and compared with DiffSnapshots.
+func (s *Steps) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	snapshot := make([]StepSnapshot, len(s.steps))
+	for i := range s.steps {
+		snapshot[i] = StepSnapshot{
+			ID:       s.steps[i].version.ID,
+			Name:     s.steps[i].name,
+			Checksum: s.steps[i].version.ChecksumString(),
+		}
+	}
+	s.mu.RUnlock()
+	return json.MarshalIndent(snapshot, "", "  ")
+}
+
+// parseSnapshot decodes a snapshot and checks that the step IDs are in sequence.
+func parseSnapshot(data []byte) ([]StepSnapshot, error) {
+	var snapshot []StepSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadParameters, err)
+	}
+	for i := range snapshot {
+		if snapshot[i].ID != i {
+			return nil, fmt.Errorf("%w: expect step id %d, got %d", ErrBadParameters, i, snapshot[i].ID)
+		}
+	}
+	return snapshot, nil
+}
+
+// DiffSnapshots returns the steps added, removed or renamed in the new snapshot relative
+// to the old snapshot, ordered by ID. The snapshots are those returned by Steps.Snapshot.
+func DiffSnapshots(old, new []byte) ([]StepDiff, error) {
+	oldSteps, err := parseSnapshot(old)
+	if err != nil {
+		return nil, fmt.Errorf("diff snapshots: old: %w", err)
+	}
+	newSteps, err := parseSnapshot(new)
+	if err != nil {
+		return nil, fmt.Errorf("diff snapshots: new: %w", err)
+	}
+	var diffs []StepDiff
+	for ID := range max(len(oldSteps), len(newSteps)) {
+		switch {
+		case ID >= len(oldSteps):
+			diffs = append(diffs, StepDiff{ID: ID, Kind: DiffAdded, NewName: newSteps[ID].Name})
+		case ID >= len(newSteps):
+			diffs = append(diffs, StepDiff{ID: ID, Kind: DiffRemoved, OldName: oldSteps[ID].Name})
+		case oldSteps[ID].Name != newSteps[ID].Name:
+			diffs = append(diffs, StepDiff{ID: ID, Kind: DiffRenamed, OldName: oldSteps[ID].Name, NewName: newSteps[ID].Name})
+		}
+	}
+	return diffs, nil
+}
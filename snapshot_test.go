@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	oldSteps := NewSteps("test-db")
+	_ = oldSteps.Append("step1", nil, nil)
+	_ = oldSteps.Append("step2", nil, nil)
+	old, err := oldSteps.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSteps := NewSteps("test-db")
+	_ = newSteps.Append("step1", nil, nil)
+	_ = newSteps.Append("step2 renamed", nil, nil)
+	_ = newSteps.Append("step3", nil, nil)
+	new, err := newSteps.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := DiffSnapshots(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []StepDiff{
+		{ID: 2, Kind: DiffRenamed, OldName: "step2", NewName: "step2 renamed"},
+		{ID: 3, Kind: DiffAdded, NewName: "step3"},
+	}
+	if !slices.Equal(diffs, exp) {
+		t.Fatalf("expect %v, got %v", exp, diffs)
+	}
+	if exp := "2 renamed 'step2' -> 'step2 renamed'"; diffs[0].String() != exp {
+		t.Fatalf("expect %q, got %q", exp, diffs[0].String())
+	}
+	if exp := "3 added 'step3'"; diffs[1].String() != exp {
+		t.Fatalf("expect %q, got %q", exp, diffs[1].String())
+	}
+
+	diffs, err = DiffSnapshots(new, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "3 removed 'step3'"; len(diffs) != 2 || diffs[1].String() != exp {
+		t.Fatalf("expect %q, got %v", exp, diffs)
+	}
+
+	diffs, err = DiffSnapshots(old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("expect no diff, got %v", diffs)
+	}
+
+	if _, err := DiffSnapshots([]byte("not json"), new); !errors.Is(err, ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", ErrBadParameters, err)
+	}
+	if _, err := DiffSnapshots(old, []byte(`[{"id":1,"name":"x"}]`)); !errors.Is(err, ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", ErrBadParameters, err)
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Replace replaces all occurrences of defaultTableName with newTableName in the queries.
@@ -15,6 +19,108 @@ func (q *Queries) Replace(defaultTableName, newTableName string) {
 	q.InitTableQuery = strings.ReplaceAll(q.InitTableQuery, defaultTableName, newTableName)
 	q.VersionQuery = strings.ReplaceAll(q.VersionQuery, defaultTableName, newTableName)
 	q.SetVersionQuery = strings.ReplaceAll(q.SetVersionQuery, defaultTableName, newTableName)
+	q.CommentTableQuery = strings.ReplaceAll(q.CommentTableQuery, defaultTableName, newTableName)
+	q.CreateHistoryQuery = strings.ReplaceAll(q.CreateHistoryQuery, defaultTableName, newTableName)
+	q.InsertHistoryQuery = strings.ReplaceAll(q.InsertHistoryQuery, defaultTableName, newTableName)
+	q.HistoryQuery = strings.ReplaceAll(q.HistoryQuery, defaultTableName, newTableName)
+}
+
+// Args returns the query arguments args preceded by the values of the extra columns.
+func (q *Queries) Args(args ...any) []any {
+	if q.Extra == nil || q.Extra.Args == nil {
+		return args
+	}
+	return slices.Concat(q.Extra.Args(), args)
+}
+
+// ChecksumArg returns the query argument of the checksum of v. It is the hexadecimal
+// string of the checksum, or its bytes when BinaryChecksum is true, truncated to
+// ChecksumSize bytes.
+func (q *Queries) ChecksumArg(v Version) any {
+	checksum := v.Checksum[:q.checksumSize()]
+	if q.BinaryChecksum {
+		return checksum
+	}
+	return hex.EncodeToString(checksum)
+}
+
+// ScanVersion scans the version of a row returned by VersionQuery.
+func (q *Queries) ScanVersion(row interface{ Scan(dest ...any) error }) (Version, error) {
+	var id int
+	var checksum []byte
+	if q.BinaryChecksum {
+		if err := row.Scan(&id, &checksum); err != nil {
+			return Version{}, fmt.Errorf("%w: %w", ErrNotInitialized, err)
+		}
+	} else {
+		var str string
+		if err := row.Scan(&id, &str); err != nil {
+			return Version{}, fmt.Errorf("%w: %w", ErrNotInitialized, err)
+		}
+		var err error
+		if checksum, err = hex.DecodeString(str); err != nil {
+			return badVersion, fmt.Errorf("%w: %w", ErrBadVersionChecksum, err)
+		}
+	}
+	if len(checksum) != q.checksumSize() {
+		return badVersion, fmt.Errorf("%w: invalid length", ErrBadVersionChecksum)
+	}
+	var full [32]byte
+	copy(full[:], checksum)
+	return MakeVersionBytes(id, full[:])
+}
+
+// checksumSize returns the number of bytes of the checksum stored in the database.
+func (q *Queries) checksumSize() int {
+	if q.ChecksumSize <= 0 || q.ChecksumSize > len(Version{}.Checksum) {
+		return len(Version{}.Checksum)
+	}
+	return q.ChecksumSize
+}
+
+// PlaceholderStyle is the style of the query parameter placeholders of a database.
+type PlaceholderStyle int
+
+const (
+	// QuestionMark placeholders are ?, like with SQLite and MySQL.
+	QuestionMark PlaceholderStyle = iota
+
+	// DollarNumbered placeholders are $1, $2, ..., like with PostgreSQL.
+	DollarNumbered
+
+	// AtNamed placeholders are @p1, @p2, ..., like with SQL Server.
+	AtNamed
+)
+
+// Placeholder returns the placeholder of the nth query parameter starting at 1.
+func (s PlaceholderStyle) Placeholder(n int) string {
+	switch s {
+	case DollarNumbered:
+		return "$" + strconv.Itoa(n)
+	case AtNamed:
+		return "@p" + strconv.Itoa(n)
+	default:
+		return "?"
+	}
+}
+
+// BuildQueries returns the queries of the version table with the placeholders of the
+// given style. The table name is used as is in the queries and must thus be quoted and
+// qualified according to the conventions of the database. The column names id and
+// checksum are not reserved words and are not quoted. The queries only use standard SQL
+// so that they are accepted by most databases. They are intended for new backends and
+// don't support the history table, the binary checksum or the extra columns. The
+// backends of this module don't use them as they create the tables only if they don't
+// exist and read the version with the database specific LIMIT or TOP clause.
+func BuildQueries(table string, style PlaceholderStyle) *Queries {
+	p := style.Placeholder
+	return &Queries{
+		CreateTableQuery: "CREATE TABLE " + table + " (id INTEGER NOT NULL, checksum VARCHAR(64) NOT NULL)",
+		InitTableQuery:   "INSERT INTO " + table + " (id, checksum) VALUES (" + p(1) + ", " + p(2) + ")",
+		VersionQuery:     "SELECT id, checksum FROM " + table,
+		SetVersionQuery: "UPDATE " + table + " SET id = " + p(1) + ", checksum = " + p(2) +
+			" WHERE id = " + p(3) + " AND checksum = " + p(4),
+	}
 }
 
 // NewSQLDB returns an SQLDB
@@ -23,7 +129,95 @@ func NewSQLDB(db *sql.DB, q *Queries) *sqlDB {
 }
 
 type sqlTx struct {
-	tx *sql.Tx
+	tx       *sql.Tx
+	observer TxObserver
+	clock    Clock
+}
+
+// TxOutcome is the outcome of a transaction finalized by FinalizeTransaction.
+type TxOutcome struct {
+	Committed bool  // Committed is true when the transaction was committed.
+	DryRun    bool  // DryRun is true when the transaction was rolled back for a dry run.
+	Err       error // Err is the error causing the roll back or the commit failure.
+}
+
+func (o TxOutcome) String() string {
+	switch {
+	case o.Committed:
+		return "committed"
+	case o.Err != nil:
+		return fmt.Sprintf("rolledback, dryRun=%t, error=%v", o.DryRun, o.Err)
+	default:
+		return fmt.Sprintf("rolledback, dryRun=%t", o.DryRun)
+	}
+}
+
+// TxObserver is called with the outcome of a finalized transaction.
+type TxObserver func(TxOutcome)
+
+type txObserverKey struct{}
+
+// WithTxObserver returns a context in which the transactions started by StartTransaction
+// call the observer with their outcome when they are finalized.
+func WithTxObserver(ctx context.Context, observer TxObserver) context.Context {
+	return context.WithValue(ctx, txObserverKey{}, observer)
+}
+
+// CmdExecutor executes an SQL command of a Tx or TxCounted step function in the
+// transaction of the step.
+type CmdExecutor func(tx SQLTx, cmd SQLCommand) error
+
+type cmdExecutorKey struct{}
+
+// WithCmdExecutor returns a context in which the Tx and TxCounted step functions call the
+// executor with their SQL commands instead of executing them. It may be used to inspect
+// the commands, for instance with a dry run.
+func WithCmdExecutor(ctx context.Context, executor CmdExecutor) context.Context {
+	return context.WithValue(ctx, cmdExecutorKey{}, executor)
+}
+
+type isolationKey struct{}
+
+// Isolation returns a migration step function calling f with a context in which the
+// transactions started by the Tx, TxCounted and TxF step functions, and by SetVersion,
+// use the given isolation level instead of sql.LevelSerializable. It allows to lower the
+// isolation level of an expensive data migration step. The level must be supported by
+// the database driver.
+func Isolation(level sql.IsolationLevel, f StepFunc) StepFunc {
+	return func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		ctx = context.WithValue(ctx, isolationKey{}, level)
+		if f == nil {
+			return db.DefaultStepFunc(ctx, info, dryRun, log)
+		}
+		return f(ctx, db, info, dryRun, log)
+	}
+}
+
+type txOptionsKey struct{}
+
+// WithTxOptions returns a context in which the transactions started by the Tx, TxCounted,
+// TxF and TxIf step functions use the given options instead of a serializable read-write
+// transaction. The isolation level set with Isolation takes precedence.
+//
+// When ReadOnly is true, the database version is changed in a separate read-write
+// transaction committed after the read-only transaction of the step. It allows, for
+// instance, a validation step to only read the database.
+func WithTxOptions(ctx context.Context, opts *sql.TxOptions) context.Context {
+	return context.WithValue(ctx, txOptionsKey{}, opts)
+}
+
+// txOptions returns the options of the transactions of the step functions. They are the
+// options set with WithTxOptions, or a serializable read-write transaction. The isolation
+// level is changed by Isolation.
+func txOptions(ctx context.Context) *sql.TxOptions {
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	if o, ok := ctx.Value(txOptionsKey{}).(*sql.TxOptions); ok && o != nil {
+		*opts = *o
+	}
+	if level, ok := ctx.Value(isolationKey{}).(sql.IsolationLevel); ok {
+		opts.Isolation = level
+	}
+	return opts
 }
 
 func (s sqlTx) Tx() *sql.Tx {
@@ -46,12 +240,44 @@ func (db *sqlDB) StartTransaction(ctx context.Context, opts *sql.TxOptions) (SQL
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrBeginTx, err)
 	}
-	return &sqlTx{tx: tx}, nil
+	return NewSQLTx(ctx, tx), nil
+}
+
+// NewSQLTx returns the SQLTx of the transaction tx. It is intended for the SQLDB
+// implementations starting their transactions with another sql package. The transaction
+// observer of the context, if any, is called when the transaction is finalized.
+func NewSQLTx(ctx context.Context, tx *sql.Tx) SQLTx {
+	observer, _ := ctx.Value(txObserverKey{}).(TxObserver)
+	clock, _ := ctx.Value(clockKey{}).(Clock)
+	return &sqlTx{tx: tx, observer: observer, clock: clock}
+}
+
+// now returns the time of the clock of the migrator, or time.Now when it has none.
+func (tx *sqlTx) now() time.Time {
+	if tx.clock == nil {
+		return time.Now()
+	}
+	return tx.clock.Now()
+}
+
+// txNow returns the current time of the transaction tx. It is the time of the clock set
+// with WithClock for the transactions started by StartTransaction, or time.Now.
+func txNow(tx SQLTx) time.Time {
+	if t, ok := tx.(interface{ now() time.Time }); ok {
+		return t.now()
+	}
+	return time.Now()
 }
 
 // FinalizeTransaction is intended to be called as deferred function after a successful call
-// to StartTransaction.
+// to StartTransaction. The transaction observer, if any, is called with the outcome.
 func (tx *sqlTx) FinalizeTransaction(err *error, dryRun bool) {
+	committed := false
+	if tx.observer != nil {
+		defer func() {
+			tx.observer(TxOutcome{Committed: committed, DryRun: dryRun && !committed, Err: *err})
+		}()
+	}
 	if *err != nil || dryRun {
 		if rollbackErr := tx.Tx().Rollback(); rollbackErr != nil {
 			if *err != nil {
@@ -63,12 +289,65 @@ func (tx *sqlTx) FinalizeTransaction(err *error, dryRun bool) {
 	} else {
 		if commitErr := tx.Tx().Commit(); commitErr != nil {
 			*err = fmt.Errorf("%w: %w", ErrCommitTx, commitErr)
+		} else {
+			committed = true
 		}
 	}
 }
 
+// finalizeTimeout is the maximum duration of the roll back of a transaction whose
+// context is done.
+var finalizeTimeout = 5 * time.Second
+
+// ctxFinalizer is an SQLTx whose finalization may be bounded by a context.
+type ctxFinalizer interface {
+	FinalizeTransactionCtx(ctx context.Context, err *error, dryRun bool)
+}
+
+// FinalizeTransactionCtx finalizes the transaction tx like its FinalizeTransaction
+// method, but it doesn't wait for longer than a short timeout for the roll back when ctx
+// is done. It calls the FinalizeTransactionCtx method of tx when it has one, and its
+// FinalizeTransaction method otherwise.
+func FinalizeTransactionCtx(ctx context.Context, tx SQLTx, err *error, dryRun bool) {
+	if f, ok := tx.(ctxFinalizer); ok {
+		f.FinalizeTransactionCtx(ctx, err, dryRun)
+		return
+	}
+	tx.FinalizeTransaction(err, dryRun)
+}
+
+// FinalizeTransactionCtx finalizes the transaction like FinalizeTransaction. When ctx is
+// done, the transaction is rolled back and the error of the context is returned if err
+// is nil. The roll back may then block on a lost connection, so it is abandoned after a
+// short timeout and the observer, if any, is called when it completes.
+func (tx *sqlTx) FinalizeTransactionCtx(ctx context.Context, err *error, dryRun bool) {
+	if ctx.Err() == nil {
+		tx.FinalizeTransaction(err, dryRun)
+		return
+	}
+	if *err == nil {
+		*err = ctx.Err()
+	}
+	e := *err
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tx.FinalizeTransaction(&e, dryRun)
+	}()
+	select {
+	case <-done:
+		// The transaction is already rolled back by database/sql when its context is done.
+		if !errors.Is(e, sql.ErrTxDone) {
+			*err = e
+		}
+	case <-time.After(finalizeTimeout):
+		*err = fmt.Errorf("%w; %w: timeout", *err, ErrRollbackTx)
+	}
+}
+
 // InitVersion initialize the version information. Returns ErrAlreadyInitialized
-// if the database is already initialized. The ID of the given version MUST be 0.
+// if the database is already initialized. The ID of the given version is 0, except
+// for Baseline.
 func (db *sqlDB) InitVersion(ctx context.Context, v Version, dryRun bool) (err error) {
 	defer func() {
 		if err != nil {
@@ -79,14 +358,26 @@ func (db *sqlDB) InitVersion(ctx context.Context, v Version, dryRun bool) (err e
 	if err != nil {
 		return
 	}
-	defer tx.FinalizeTransaction(&err, dryRun)
+	defer FinalizeTransactionCtx(ctx, tx, &err, dryRun)
 
 	_, err = tx.Tx().Exec(db.q.CreateTableQuery)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Tx().Exec(db.q.InitTableQuery, v.ID, hex.EncodeToString(v.Checksum[:]))
+	if db.q.CommentTableQuery != "" {
+		if _, err = tx.Tx().Exec(db.q.CommentTableQuery); err != nil {
+			return err
+		}
+	}
+
+	if db.q.CreateHistoryQuery != "" {
+		if _, err = tx.Tx().Exec(db.q.CreateHistoryQuery); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Tx().Exec(db.q.InitTableQuery, db.q.Args(v.ID, db.q.ChecksumArg(v))...)
 	if err != nil {
 		return err
 	}
@@ -104,20 +395,14 @@ func (db *sqlDB) Version(ctx context.Context) (v Version, err error) {
 	if err != nil {
 		return badVersion, err
 	}
-	defer tx.FinalizeTransaction(&err, false)
+	defer FinalizeTransactionCtx(ctx, tx, &err, false)
 	return db.VersionTx(tx)
 }
 
 // Version returns the current database version. Returns ErrNotInitialized if
 // the database is not initialized.
 func (db *sqlDB) VersionTx(tx SQLTx) (Version, error) {
-	var id int
-	var checksum string
-	err := tx.Tx().QueryRow(db.q.VersionQuery).Scan(&id, &checksum)
-	if err != nil {
-		return Version{}, fmt.Errorf("%w: %w", ErrNotInitialized, err)
-	}
-	return MakeVersion(id, checksum)
+	return db.q.ScanVersion(tx.Tx().QueryRow(db.q.VersionQuery))
 }
 
 // DefaultStepFunc is called when the step function is nil. It sets the version to info.To()
@@ -132,22 +417,25 @@ func (db *sqlDB) DefaultStepFunc(ctx context.Context, info StepInfo, dryRun bool
 // SetVersion is called when the step function is nil. It sets the version to info.To()
 // when the database version is info.From() and dryRun is false, otherwise it returns ErrBadVersion.
 func (db *sqlDB) SetVersion(ctx context.Context, info StepInfo, dryRun bool, log Logger) (err error) {
-	tx, err := db.StartTransaction(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	opts := txOptions(ctx)
+	opts.ReadOnly = false
+	tx, err := db.StartTransaction(ctx, opts)
 	if err != nil {
 		return err
 	}
-	defer tx.FinalizeTransaction(&err, dryRun)
+	defer FinalizeTransactionCtx(ctx, tx, &err, dryRun)
 
 	return db.SetVersionTx(tx, info, dryRun, log)
 }
 
 // SetVersionTx in a transaction to set the version to info.To() if it is
-// info.From() otherwise, returns an error.
+// info.From() otherwise, returns an error. It also inserts the change in the history
+// table when the history is enabled.
 func (db *sqlDB) SetVersionTx(tx SQLTx, info StepInfo, dryRun bool, log Logger) error {
-	result, err := tx.Tx().Exec(db.q.SetVersionQuery,
-		info.To().ID, info.To().ChecksumString(),
-		info.From().ID, info.From().ChecksumString(),
-	)
+	result, err := tx.Tx().Exec(db.q.SetVersionQuery, db.q.Args(
+		info.To().ID, db.q.ChecksumArg(info.To()),
+		info.From().ID, db.q.ChecksumArg(info.From()),
+	)...)
 	if err != nil {
 		return err
 	}
@@ -155,13 +443,16 @@ func (db *sqlDB) SetVersionTx(tx SQLTx, info StepInfo, dryRun bool, log Logger)
 	if err == nil && rowsAffected != 1 {
 		err = ErrBadVersion
 	}
+	if err == nil && db.q.InsertHistoryQuery != "" {
+		_, err = tx.Tx().Exec(db.q.InsertHistoryQuery, info.From().ID, info.To().ID, info.Name(), txNow(tx).UTC(), dryRun)
+	}
 	return err
 }
 
 // SQLCommand is an SQL query instruction with arguments.
 type SQLCommand struct {
-	Cmd  string
-	Args []any
+	Cmd  string `json:"cmd"`
+	Args []any  `json:"args,omitempty"`
 }
 
 func (c SQLCommand) String() string {
@@ -194,7 +485,36 @@ func Cmd(cmd string, args ...any) SQLCommand {
 // as an error is returned by one of the commands. It is also rolled back when dryRun
 // is true.
 func Tx(cmds ...SQLCommand) StepFunc {
-	return func(ctx context.Context, gdb Database, info StepInfo, dryRun bool, log Logger) (err error) {
+	return txCounted(nil, cmds)
+}
+
+// TxCounted returns a migration step function like Tx that also counts the rows of the
+// given tables before and after executing the commands. The counts are performed in the
+// same transaction as the commands and the row count delta of each table is logged at
+// the info level. The rows are not counted when the logger level is above LevelInfo.
+func TxCounted(tables []string, cmds ...SQLCommand) StepFunc {
+	return txCounted(tables, cmds)
+}
+
+// validTableName matches an optionally schema qualified table name.
+var validTableName = regexp.MustCompile(`^[a-zA-Z0-9_]+(\.[a-zA-Z0-9_]+)?$`)
+
+// countRows returns the number of rows in each table.
+func countRows(tx SQLTx, tables []string) ([]int64, error) {
+	counts := make([]int64, len(tables))
+	for i, table := range tables {
+		if err := tx.Tx().QueryRow("SELECT COUNT(*) FROM " + table).Scan(&counts[i]); err != nil {
+			return nil, fmt.Errorf("count rows of %s: %w", table, err)
+		}
+	}
+	return counts, nil
+}
+
+func txCounted(tables []string, cmds []SQLCommand) StepFunc {
+	return RegisterStepKind(func(ctx context.Context, gdb Database, info StepInfo, dryRun bool, log Logger) (err error) {
+		if recordDryRun(ctx, dryRun, cmds) {
+			return nil
+		}
 		db, ok := gdb.(SQLDB)
 		if !ok {
 			return fmt.Errorf("tx: %w", ErrNotSQLDB)
@@ -213,49 +533,124 @@ func Tx(cmds ...SQLCommand) StepFunc {
 				}
 			}
 		}()
+		for _, table := range tables {
+			if !validTableName.MatchString(table) {
+				return fmt.Errorf("%w: invalid table name '%s'", ErrBadParameters, table)
+			}
+		}
 
-		tx, err := db.StartTransaction(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		opts := txOptions(ctx)
+		if opts.ReadOnly {
+			defer setVersionAfter(ctx, db, info, dryRun, log, &err)
+		}
+		tx, err := db.StartTransaction(ctx, opts)
 		if err != nil {
 			return err
 		}
-		defer tx.FinalizeTransaction(&err, dryRun)
+		defer FinalizeTransactionCtx(ctx, tx, &err, dryRun)
 
 		dbv, err := db.VersionTx(tx)
 		if err != nil {
 			return err
 		}
-		if dbv != info.From() {
-			return fmt.Errorf("db is %v", dbv)
+		if err := CheckFrom(dbv, info); err != nil {
+			return err
+		}
+
+		counted := len(tables) > 0 && log.Level() <= LevelInfo
+		var before []int64
+		if counted {
+			if before, err = countRows(tx, tables); err != nil {
+				return err
+			}
 		}
 
+		executor, _ := ctx.Value(cmdExecutorKey{}).(CmdExecutor)
 		for _, cmd := range cmds {
 			if log.Level() >= LevelDebug {
 				log.Debug("tx sql command", F("cmd", cmd))
 			}
-			if _, err = tx.Tx().Exec(cmd.Cmd, cmd.Args...); err != nil {
+			if executor != nil {
+				err = executor(tx, cmd)
+			} else {
+				_, err = tx.Tx().ExecContext(ctx, cmd.Cmd, cmd.Args...)
+			}
+			if err != nil {
 				return err
 			}
 		}
 
-		if err := db.SetVersionTx(tx, info, dryRun, log); err != nil {
-			return err
+		if counted {
+			after, err := countRows(tx, tables)
+			if err != nil {
+				return err
+			}
+			for i, table := range tables {
+				log.Info("row count", F("name", info.Name()), F("table", table),
+					F("before", before[i]), F("after", after[i]), F("delta", after[i]-before[i]))
+			}
+		}
+
+		if !opts.ReadOnly {
+			if err := db.SetVersionTx(tx, info, dryRun, log); err != nil {
+				return err
+			}
 		}
 		log.Info("migrate step", F("name", info.Name()), F("from", info.From()), F("to", info.To()), F("dryRun", dryRun))
 		return nil
+	}, StepTx)
+}
+
+// setVersionAfter changes the database version with SetVersion when *err is nil. It is
+// deferred before starting the read-only transaction of a step so that it is called
+// after the transaction is finalized.
+func setVersionAfter(ctx context.Context, db SQLDB, info StepInfo, dryRun bool, log Logger, err *error) {
+	if *err == nil {
+		*err = db.SetVersion(ctx, info, dryRun, log)
 	}
 }
 
+type deepDryRunKey struct{}
+
+// WithDeepDryRun returns a context in which the NoTx step functions executed with dryRun
+// true execute their SQL commands in a transaction that is rolled back, like Tx, when the
+// database supports transactional DDL. It allows a dry run to detect the errors of the
+// SQL commands. The commands are skipped with a warning when the database doesn't
+// support it, like MySQL.
+func WithDeepDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deepDryRunKey{}, true)
+}
+
+// IsDeepDryRun returns true when the context was returned by WithDeepDryRun.
+func IsDeepDryRun(ctx context.Context) bool {
+	deep, _ := ctx.Value(deepDryRunKey{}).(bool)
+	return deep
+}
+
 // NoTx returns a migration step function that executes the SQL commands in sequence
 // without a wrapping transaction. It terminates as soon as a command returns an error.
-// It doesn't execute any cmds when dryRun is true.
+// It doesn't execute any cmds when dryRun is true, unless in a deep dry run.
 func NoTx(cmds ...SQLCommand) StepFunc {
-	return func(ctx context.Context, gdb Database, info StepInfo, dryRun bool, log Logger) (err error) {
+	return RegisterStepKind(func(ctx context.Context, gdb Database, info StepInfo, dryRun bool, log Logger) (err error) {
+		if recordDryRun(ctx, dryRun, cmds) {
+			return nil
+		}
 		db, ok := gdb.(SQLDB)
 		if !ok {
 			return fmt.Errorf("sql: %w", ErrNotSQLDB)
 		}
+		if _, ok := gdb.(*batchDB); ok {
+			return fmt.Errorf("sql: %w", ErrNoTxInBatch)
+		}
 		if dryRun {
-			return nil
+			if !IsDeepDryRun(ctx) {
+				return nil
+			}
+			if !db.Queries().TransactionalDDL {
+				log.Warn("deep dry run not supported", F("name", info.Name()), F("from", info.From()), F("to", info.To()))
+				return nil
+			}
+			return Tx(cmds...)(ctx, db, info, dryRun, log)
 		}
 		defer func() {
 			if err != nil {
@@ -272,8 +667,8 @@ func NoTx(cmds ...SQLCommand) StepFunc {
 		if err != nil {
 			return err
 		}
-		if dbv != info.From() {
-			return fmt.Errorf("db is %v", dbv)
+		if err := CheckFrom(dbv, info); err != nil {
+			return err
 		}
 		for _, cmd := range cmds {
 			if log.Level() >= LevelDebug {
@@ -289,7 +684,7 @@ func NoTx(cmds ...SQLCommand) StepFunc {
 		}
 		log.Info("migrate step", F("name", info.Name()), F("from", info.From()), F("to", info.To()), F("dryRun", dryRun))
 		return nil
-	}
+	}, StepNoTx)
 }
 
 // TxFunc is a user provided function that is called wrapped in a transaction.
@@ -305,7 +700,10 @@ type TxFunc func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error
 // subsequent functions and migration steps, it must return the ErrCancel pseudo error.
 // The migration step function will return nil as error.
 func TxF(fs ...TxFunc) StepFunc {
-	return func(ctx context.Context, gdb Database, info StepInfo, dryRun bool, log Logger) (err error) {
+	return RegisterStepKind(func(ctx context.Context, gdb Database, info StepInfo, dryRun bool, log Logger) (err error) {
+		if skipDryRun(ctx, dryRun) {
+			return nil
+		}
 		db, ok := gdb.(SQLDB)
 		if !ok {
 			return fmt.Errorf("txf: %w", ErrNotSQLDB)
@@ -327,18 +725,22 @@ func TxF(fs ...TxFunc) StepFunc {
 			}
 		}()
 
-		tx, err := db.StartTransaction(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		opts := txOptions(ctx)
+		if opts.ReadOnly {
+			defer setVersionAfter(ctx, db, info, dryRun, log, &err)
+		}
+		tx, err := db.StartTransaction(ctx, opts)
 		if err != nil {
 			return err
 		}
-		defer tx.FinalizeTransaction(&err, dryRun)
+		defer FinalizeTransactionCtx(ctx, tx, &err, dryRun)
 
 		dbv, err := db.VersionTx(tx)
 		if err != nil {
 			return err
 		}
-		if dbv != info.From() {
-			return fmt.Errorf("db is %v", dbv)
+		if err := CheckFrom(dbv, info); err != nil {
+			return err
 		}
 
 		if log.Level() >= LevelDebug {
@@ -357,11 +759,57 @@ func TxF(fs ...TxFunc) StepFunc {
 			return ErrCancel
 		}
 
-		if err := db.SetVersionTx(tx, info, dryRun, log); err != nil {
-			return err
+		if !opts.ReadOnly {
+			if err := db.SetVersionTx(tx, info, dryRun, log); err != nil {
+				return err
+			}
 		}
 		log.Info("migrate step", F("name", info.Name()), F("from", info.From()), F("to", info.To()), F("dryRun", dryRun))
 		return nil
+	}, StepTx)
+}
+
+// TxIf returns a migration step function like Tx that executes the SQL commands only if
+// cond returns true. The condition is evaluated in the transaction before the commands.
+// When it returns false, the commands are skipped and the version is changed as if they
+// were executed, which allows idempotent steps like creating an index only if it doesn't
+// exist. The condition may return ErrCancel or ErrAbort like a TxFunc.
+func TxIf(cond func(tx SQLTx) (bool, error), cmds ...SQLCommand) StepFunc {
+	return TxF(func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error {
+		ok, err := cond(tx)
+		if err != nil {
+			return fmt.Errorf("tx if condition: %w", err)
+		}
+		if !ok {
+			log.Info("skipped sql commands", F("name", info.Name()), F("count", len(cmds)))
+			return nil
+		}
+		return ExecTx(tx, log, cmds...)
+	})
+}
+
+// ExecTx executes the SQL commands in sequence in the transaction tx and logs them at the
+// debug level like Tx. It is intended to be called by a TxFunc. It stops as soon as a
+// command returns an error.
+func ExecTx(tx SQLTx, log Logger, cmds ...SQLCommand) error {
+	for _, cmd := range cmds {
+		if log.Level() >= LevelDebug {
+			log.Debug("tx sql command", F("cmd", cmd))
+		}
+		if _, err := tx.Tx().Exec(cmd.Cmd, cmd.Args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Describe returns a TxFunc calling f after logging the description at the debug level.
+func Describe(description string, f TxFunc) TxFunc {
+	return func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error {
+		if log.Level() >= LevelDebug {
+			log.Debug("tx func", F("name", info.Name()), F("description", description))
+		}
+		return f(tx, info, dryRun, log)
 	}
 }
 
@@ -371,17 +819,29 @@ type NoTxFunc func(ctx context.Context, db SQLDB, info StepInfo, log Logger) err
 
 // NoTxF returns a migration step function that executes the user provided functions in sequence
 // without a wrapping transaction. It terminates as soon as a function returns an error.
-// It doesn't execute any function when dryRun is true. The pseudo error ErrCancel is
+// It doesn't execute any function when dryRun is true, even in a deep dry run as the
+// functions access the database without a transaction. The pseudo error ErrCancel is
 // treated as ErrAbort as operations can't be cancelled and database version remains info.From().
+// A function may return the pseudo error ErrSkip to skip the remaining functions and still
+// change the database version, like when the changes are already in the database.
 //
 // Use with care as any error in the function may leave the database is an undefined state.
 func NoTxF(fs ...NoTxFunc) StepFunc {
-	return func(ctx context.Context, gdb Database, info StepInfo, dryRun bool, log Logger) (err error) {
+	return RegisterStepKind(func(ctx context.Context, gdb Database, info StepInfo, dryRun bool, log Logger) (err error) {
+		if skipDryRun(ctx, dryRun) {
+			return nil
+		}
 		db, ok := gdb.(SQLDB)
 		if !ok {
 			return fmt.Errorf("f: %w", ErrNotSQLDB)
 		}
+		if _, ok := gdb.(*batchDB); ok {
+			return fmt.Errorf("f: %w", ErrNoTxInBatch)
+		}
 		if dryRun {
+			if IsDeepDryRun(ctx) {
+				log.Warn("deep dry run not supported", F("name", info.Name()), F("from", info.From()), F("to", info.To()))
+			}
 			return nil
 		}
 		defer func() {
@@ -399,13 +859,20 @@ func NoTxF(fs ...NoTxFunc) StepFunc {
 		if err != nil {
 			return err
 		}
-		if dbv != info.From() {
-			return fmt.Errorf("db is %v", dbv)
+		if err := CheckFrom(dbv, info); err != nil {
+			return err
 		}
 
 		for _, f := range fs {
 			if err = f(ctx, db, info, log); err != nil {
-				return err
+				if !errors.Is(err, ErrSkip) {
+					return err
+				}
+				if log.Level() >= LevelDebug {
+					log.Debug("skip step functions", F("name", info.Name()), F("from", info.From()), F("to", info.To()))
+				}
+				err = nil
+				break
 			}
 		}
 
@@ -414,5 +881,31 @@ func NoTxF(fs ...NoTxFunc) StepFunc {
 		}
 		log.Info("migrate step", F("name", info.Name()), F("from", info.From()), F("to", info.To()), F("dryRun", dryRun))
 		return nil
+	}, StepNoTx)
+}
+
+// ExecNoTx executes the SQL commands in sequence without a transaction and logs them at
+// the debug level like NoTx. It is intended to be called by a NoTxFunc. It stops as soon
+// as a command returns an error.
+func ExecNoTx(ctx context.Context, db SQLDB, log Logger, cmds ...SQLCommand) error {
+	for _, cmd := range cmds {
+		if log.Level() >= LevelDebug {
+			log.Debug("no tx sql command", F("cmd", cmd))
+		}
+		if _, err := db.DB().ExecContext(ctx, cmd.Cmd, cmd.Args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DescribeNoTx returns a NoTxFunc calling f after logging the description at the debug
+// level.
+func DescribeNoTx(description string, f NoTxFunc) NoTxFunc {
+	return func(ctx context.Context, db SQLDB, info StepInfo, log Logger) error {
+		if log.Level() >= LevelDebug {
+			log.Debug("no tx func", F("name", info.Name()), F("description", description))
+		}
+		return f(ctx, db, info, log)
 	}
 }
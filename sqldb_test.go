@@ -1,10 +1,14 @@
 package migrate
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
 	"encoding/hex"
 	"errors"
+	"log"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 
@@ -259,6 +263,91 @@ func TestFinalizeTransaction(t *testing.T) {
 			t.Fatal(err)
 		}
 	})
+
+	t.Run("Observer", func(t *testing.T) {
+		var outcomes []string
+		ctx := WithTxObserver(context.Background(), func(o TxOutcome) {
+			outcomes = append(outcomes, o.String())
+		})
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		tx, err := db.StartTransaction(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.FinalizeTransaction(&err, true)
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+		tx, err = db.StartTransaction(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.FinalizeTransaction(&err, false)
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		tx, err = db.StartTransaction(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = errMock
+		tx.FinalizeTransaction(&err, false)
+
+		exp := []string{"rolledback, dryRun=true", "committed", "rolledback, dryRun=false, error=mock error"}
+		if !slices.Equal(outcomes, exp) {
+			t.Fatalf("expect %q, got %q", exp, outcomes)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestFinalizeTransactionCtx(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := NewSQLDB(mockDB, mockQ)
+
+	// The context isn't done.
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	tx, err := db.StartTransaction(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	FinalizeTransactionCtx(context.Background(), tx, &err, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The transaction of a cancelled context is rolled back and the error of the context
+	// is returned, even when the roll back was done by database/sql.
+	ctx, cancel := context.WithCancel(context.Background())
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	tx, err = db.StartTransaction(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	FinalizeTransactionCtx(ctx, tx, &err, false)
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrRollbackTx) {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	}
+
+	// A transaction without a FinalizeTransactionCtx method is finalized with its
+	// FinalizeTransaction method.
+	batch := &batchDB{}
+	err = errMock
+	FinalizeTransactionCtx(ctx, batchTx{db: batch}, &err, false)
+	if batch.err != errMock {
+		t.Fatalf("expect %v, got %v", errMock, batch.err)
+	}
 }
 
 func TestInitVersion(t *testing.T) {
@@ -803,6 +892,218 @@ func TestTx(t *testing.T) {
 	}
 }
 
+func TestTxCmdExecutor(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := NewSQLDB(mockDB, mockQ)
+
+	v1 := Version{ID: 100, Checksum: [32]byte{1, 2, 3, 4}}
+	v2 := Version{ID: 123, Checksum: [32]byte{5, 6, 7, 8}}
+	query := `UPDATE "test" SET "msg" = ?`
+
+	var cmds []SQLCommand
+	ctx := WithCmdExecutor(context.Background(), func(tx SQLTx, cmd SQLCommand) error {
+		cmds = append(cmds, cmd)
+		return nil
+	})
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"id", "checksum"}).AddRow(v1.ID, hex.EncodeToString(v1.Checksum[:]))
+	mock.ExpectQuery(regexp.QuoteMeta(mockQ.VersionQuery)).WillReturnRows(rows)
+	mock.ExpectExec(regexp.QuoteMeta(mockQ.SetVersionQuery)).
+		WithArgs(v2.ID, hex.EncodeToString(v2.Checksum[:]), v1.ID, hex.EncodeToString(v1.Checksum[:])).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	f := Tx(Cmd(query, "hello"))
+	if err := f(ctx, db, &stepInfo{"executor", v1, v2}, true, NewNilLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].Cmd != query {
+		t.Fatalf("expect command %q, got %v", query, cmds)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx = WithCmdExecutor(context.Background(), func(tx SQLTx, cmd SQLCommand) error {
+		return errMock
+	})
+	mock.ExpectBegin()
+	rows = sqlmock.NewRows([]string{"id", "checksum"}).AddRow(v1.ID, hex.EncodeToString(v1.Checksum[:]))
+	mock.ExpectQuery(regexp.QuoteMeta(mockQ.VersionQuery)).WillReturnRows(rows)
+	mock.ExpectRollback()
+	if err := f(ctx, db, &stepInfo{"executor", v1, v2}, true, NewNilLogger()); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	if opts := txOptions(context.Background()); opts.Isolation != sql.LevelSerializable {
+		t.Fatalf("expect %v, got %v", sql.LevelSerializable, opts.Isolation)
+	}
+
+	var level sql.IsolationLevel
+	f := Isolation(sql.LevelReadCommitted, func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		level = txOptions(ctx).Isolation
+		return nil
+	})
+	if err := f(context.Background(), nil, nil, false, NewNilLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if level != sql.LevelReadCommitted {
+		t.Fatalf("expect %v, got %v", sql.LevelReadCommitted, level)
+	}
+
+	db := &mockDatabase{version: Version{ID: 1}}
+	f = Isolation(sql.LevelReadCommitted, nil)
+	if err := f(context.Background(), db, &stepInfo{"nil", Version{ID: 1}, Version{ID: 2}}, false, NewNilLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if db.version.ID != 2 {
+		t.Fatalf("expect v2, got %v", db.version)
+	}
+}
+
+func TestBuildQueries(t *testing.T) {
+	tests := []struct {
+		style PlaceholderStyle
+		exp   Queries
+	}{
+		{QuestionMark, Queries{
+			CreateTableQuery: `CREATE TABLE "v" (id INTEGER NOT NULL, checksum VARCHAR(64) NOT NULL)`,
+			InitTableQuery:   `INSERT INTO "v" (id, checksum) VALUES (?, ?)`,
+			VersionQuery:     `SELECT id, checksum FROM "v"`,
+			SetVersionQuery:  `UPDATE "v" SET id = ?, checksum = ? WHERE id = ? AND checksum = ?`,
+		}},
+		{DollarNumbered, Queries{
+			CreateTableQuery: `CREATE TABLE "v" (id INTEGER NOT NULL, checksum VARCHAR(64) NOT NULL)`,
+			InitTableQuery:   `INSERT INTO "v" (id, checksum) VALUES ($1, $2)`,
+			VersionQuery:     `SELECT id, checksum FROM "v"`,
+			SetVersionQuery:  `UPDATE "v" SET id = $1, checksum = $2 WHERE id = $3 AND checksum = $4`,
+		}},
+		{AtNamed, Queries{
+			CreateTableQuery: `CREATE TABLE "v" (id INTEGER NOT NULL, checksum VARCHAR(64) NOT NULL)`,
+			InitTableQuery:   `INSERT INTO "v" (id, checksum) VALUES (@p1, @p2)`,
+			VersionQuery:     `SELECT id, checksum FROM "v"`,
+			SetVersionQuery:  `UPDATE "v" SET id = @p1, checksum = @p2 WHERE id = @p3 AND checksum = @p4`,
+		}},
+	}
+	for _, test := range tests {
+		if q := BuildQueries(`"v"`, test.style); *q != test.exp {
+			t.Fatalf("style %d: expect %+v, got %+v", test.style, test.exp, *q)
+		}
+	}
+}
+
+func TestChecksumArg(t *testing.T) {
+	v := Version{ID: 1, Checksum: [32]byte{1, 2, 3}}
+	q := &Queries{}
+	if arg, ok := q.ChecksumArg(v).(string); !ok || arg != hex.EncodeToString(v.Checksum[:]) {
+		t.Fatalf("expect hex checksum, got %v", q.ChecksumArg(v))
+	}
+	q.BinaryChecksum = true
+	if arg, ok := q.ChecksumArg(v).([]byte); !ok || !bytes.Equal(arg, v.Checksum[:]) {
+		t.Fatalf("expect binary checksum, got %v", q.ChecksumArg(v))
+	}
+	q.ChecksumSize = 16
+	if arg, ok := q.ChecksumArg(v).([]byte); !ok || !bytes.Equal(arg, v.Checksum[:16]) {
+		t.Fatalf("expect 16 bytes checksum, got %v", q.ChecksumArg(v))
+	}
+	q.BinaryChecksum = false
+	if arg, ok := q.ChecksumArg(v).(string); !ok || arg != hex.EncodeToString(v.Checksum[:16]) {
+		t.Fatalf("expect 16 bytes hex checksum, got %v", q.ChecksumArg(v))
+	}
+}
+
+func TestScanVersionChecksumSize(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	q := &Queries{ChecksumSize: 16}
+	exp := Version{ID: 3, Checksum: [32]byte{1, 2, 3}}
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(3, hex.EncodeToString(exp.Checksum[:16])))
+	if v, err := q.ScanVersion(mockDB.QueryRow("SELECT")); err != nil || v != exp {
+		t.Fatalf("expect %v, got %v %v", exp, v, err)
+	}
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(3, hex.EncodeToString(exp.Checksum[:])))
+	if _, err := q.ScanVersion(mockDB.QueryRow("SELECT")); !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionChecksum, err)
+	}
+}
+
+func TestWithTxOptions(t *testing.T) {
+	ctx := WithTxOptions(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if opts := txOptions(ctx); opts.Isolation != sql.LevelRepeatableRead || !opts.ReadOnly {
+		t.Fatalf("unexpected options %+v", *opts)
+	}
+	var opts *sql.TxOptions
+	f := Isolation(sql.LevelReadCommitted, func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		opts = txOptions(ctx)
+		return nil
+	})
+	if err := f(ctx, nil, nil, false, NewNilLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Isolation != sql.LevelReadCommitted || !opts.ReadOnly {
+		t.Fatalf("unexpected options %+v", *opts)
+	}
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := NewSQLDB(mockDB, mockQ)
+	v1 := Version{ID: 1, Checksum: [32]byte{1}}
+	v2 := Version{ID: 2, Checksum: [32]byte{2}}
+	info := &stepInfo{"read only", v1, v2}
+
+	// The version is changed in a transaction following the read-only transaction.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(mockQ.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(v1.ID, v1.ChecksumString()))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(mockQ.SetVersionQuery)).
+		WithArgs(v2.ID, v2.ChecksumString(), v1.ID, v1.ChecksumString()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	var called bool
+	step := TxF(func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error {
+		called = true
+		return nil
+	})
+	if err := step(ctx, db, info, false, NewNilLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("expect function called")
+	}
+
+	// The version is not changed when the step fails.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(mockQ.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(v1.ID, v1.ChecksumString()))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT 1`)).WillReturnError(errMock)
+	mock.ExpectRollback()
+	if err := Tx(Cmd(`SELECT 1`))(ctx, db, info, false, NewNilLogger()); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestNotSQLDB(t *testing.T) {
 	query := `CREATE TABLE "test_table" ("id" INTEGER NOT NULL AUTOINCREMENT)`
 	v1 := Version{
@@ -1162,6 +1463,56 @@ func TestTxF(t *testing.T) {
 	}
 }
 
+func TestNoTxDeepDryRun(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	q := *mockQ
+	db := NewSQLDB(mockDB, &q)
+	info := &stepInfo{name: "step", from: Version{ID: 1, Checksum: [32]byte{1}}, to: Version{ID: 2, Checksum: [32]byte{2}}}
+	query := `CREATE TABLE "test_table" ("id" INTEGER NOT NULL)`
+	ctx := WithDeepDryRun(context.Background())
+	var buf bytes.Buffer
+	logger := NewLogLoggerWith(log.New(&buf, "", 0), LevelInfo)
+
+	if err := NoTx(Cmd(query))(ctx, db, info, true, logger); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "deep dry run not supported") {
+		t.Fatalf("expect warning, got %q", buf.String())
+	}
+
+	q.TransactionalDDL = true
+	rows := sqlmock.NewRows([]string{"id", "checksum"}).AddRow(info.from.ID, info.from.ChecksumString())
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(q.VersionQuery)).WillReturnRows(rows)
+	mock.ExpectExec(regexp.QuoteMeta(query)).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	if err := NoTx(Cmd(query))(ctx, db, info, true, logger); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Fatalf("expect syntax error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NoTx(Cmd(query))(context.Background(), db, info, true, logger); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	noTxF := NoTxF(func(ctx context.Context, db SQLDB, info StepInfo, log Logger) error {
+		t.Fatal("unexpected call")
+		return nil
+	})
+	if err := noTxF(ctx, db, info, true, logger); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "deep dry run not supported") {
+		t.Fatalf("expect warning, got %q", buf.String())
+	}
+}
+
 func TestNoTxF(t *testing.T) {
 	mockDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -1304,6 +1655,24 @@ func TestNoTxF(t *testing.T) {
 			funcExecuted: true,
 			funcError:    ErrCancel,
 		},
+		{
+			name: "function skip",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "checksum"}).AddRow(v1.ID, hex.EncodeToString(v1.Checksum[:]))
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(mockQ.VersionQuery)).WillReturnRows(rows)
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(mockQ.SetVersionQuery)).
+					WithArgs(v2.ID, hex.EncodeToString(v2.Checksum[:]), v1.ID, hex.EncodeToString(v1.Checksum[:])).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			dryRun:       false,
+			expectErr:    false,
+			funcExecuted: true,
+			funcError:    ErrSkip,
+		},
 	}
 
 	for _, test := range tests {
@@ -1333,3 +1702,57 @@ func TestNoTxF(t *testing.T) {
 		})
 	}
 }
+
+func TestExecAndDescribe(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	db := NewSQLDB(mockDB, mockQ)
+
+	v1 := Version{ID: 100, Checksum: [32]byte{1, 2, 3, 4}}
+	v2 := Version{ID: 123, Checksum: [32]byte{5, 6, 7, 8}}
+	var buf bytes.Buffer
+	logger := NewLogLoggerWith(log.New(&buf, "", 0), LevelDebug)
+	query := `INSERT INTO "test" ("msg") VALUES (?)`
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(mockQ.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(v1.ID, hex.EncodeToString(v1.Checksum[:])))
+	mock.ExpectExec(regexp.QuoteMeta(query)).WithArgs("hello").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(mockQ.SetVersionQuery)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	f := TxF(Describe("insert greeting", func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error {
+		return ExecTx(tx, log, Cmd(query, "hello"))
+	}))
+	if err := f(context.Background(), db, &stepInfo{"describe", v1, v2}, false, logger); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "[DEBUG] tx func | name='describe' description='insert greeting'") ||
+		!strings.Contains(output, "[DEBUG] tx sql command | cmd='`"+query+"` args:[hello]'") {
+		t.Fatalf("unexpected log %s", output)
+	}
+
+	buf.Reset()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(mockQ.VersionQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "checksum"}).AddRow(v1.ID, hex.EncodeToString(v1.Checksum[:])))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(query)).WithArgs("hello").WillReturnError(errMock)
+	f = NoTxF(DescribeNoTx("insert greeting", func(ctx context.Context, db SQLDB, info StepInfo, log Logger) error {
+		return ExecNoTx(ctx, db, log, Cmd(query, "hello"), Cmd(query, "not executed"))
+	}))
+	if err := f(context.Background(), db, &stepInfo{"describe", v1, v2}, false, logger); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	output = buf.String()
+	if !strings.Contains(output, "[DEBUG] no tx func | name='describe' description='insert greeting'") ||
+		!strings.Contains(output, "[DEBUG] no tx sql command") || strings.Contains(output, "not executed") {
+		t.Fatalf("unexpected log %s", output)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
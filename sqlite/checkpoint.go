@@ -0,0 +1,30 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Checkpoint transfers the content of the write-ahead log into the database file
+// with a `PRAGMA wal_checkpoint(<mode>)`. The mode is one of PASSIVE, FULL, RESTART
+// or TRUNCATE, and TRUNCATE also truncates the -wal file to zero bytes. It returns
+// an error if a FULL, RESTART or TRUNCATE checkpoint couldn't complete because the
+// database is busy. It is intended to be called after AllUp to keep the database
+// files compact in WAL mode.
+func Checkpoint(db *sql.DB, mode string) error {
+	mode = strings.ToUpper(mode)
+	switch mode {
+	case "PASSIVE", "FULL", "RESTART", "TRUNCATE":
+	default:
+		return fmt.Errorf("checkpoint: invalid mode '%s'", mode)
+	}
+	var busy, log, checkpointed int
+	if err := db.QueryRow("PRAGMA wal_checkpoint("+mode+")").Scan(&busy, &log, &checkpointed); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("checkpoint: database busy, %d of %d frames checkpointed", checkpointed, log)
+	}
+	return nil
+}
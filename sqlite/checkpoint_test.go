@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sqlite_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	fileName := filepath.Join(tempDir, "data.db")
+	db, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	s := NewSteps("test database")
+	s.Append("set WAL mode", NoTx(Cmd("PRAGMA journal_mode=WAL")), nil)
+	s.Append("create table", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "msg" TEXT NOT NULL);`)), nil)
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	walFile := fileName + "-wal"
+	stat, err := os.Stat(walFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() == 0 {
+		t.Fatal("expect non-empty wal file")
+	}
+
+	if err := Checkpoint(db.DB(), "full"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Checkpoint(db.DB(), "TRUNCATE"); err != nil {
+		t.Fatal(err)
+	}
+	stat, err = os.Stat(walFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() != 0 {
+		t.Fatalf("expect empty wal file, got %d bytes", stat.Size())
+	}
+
+	if err := Checkpoint(db.DB(), "NOW); DROP TABLE test; --"); err == nil {
+		t.Fatal("expect error")
+	}
+	db.DB().Close()
+	if err := Checkpoint(db.DB(), "PASSIVE"); err == nil {
+		t.Fatal("expect error")
+	}
+}
@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chmike/migrate"
+)
+
+// locker is a migration locker using a lock file.
+type locker struct {
+	path string
+}
+
+// NewLocker returns a migration locker using a lock file created with the given path,
+// typically the database file path with the .lock extension. The lock file is removed
+// by Unlock. A lock file left behind by a crashed process must be removed manually.
+func NewLocker(path string) migrate.Locker {
+	return &locker{path: path}
+}
+
+// Lock creates the lock file. It returns migrate.ErrMigrationLocked if the file exists.
+func (l *locker) Lock(ctx context.Context) error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: lock file %s exists", migrate.ErrMigrationLocked, l.path)
+		}
+		return fmt.Errorf("lock: %w", err)
+	}
+	_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(l.path)
+		return fmt.Errorf("lock: %w", err)
+	}
+	return nil
+}
+
+// Unlock removes the lock file.
+func (l *locker) Unlock(ctx context.Context) error {
+	if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("unlock: %w", err)
+	}
+	return nil
+}
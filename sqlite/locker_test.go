@@ -0,0 +1,74 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chmike/migrate"
+)
+
+func TestLocker(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sqlite_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	ctx := context.Background()
+
+	lockFile := filepath.Join(tempDir, "data.db.lock")
+	l1 := NewLocker(lockFile)
+	l2 := NewLocker(lockFile)
+	if err := l1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Lock(ctx); !errors.Is(err, migrate.ErrMigrationLocked) {
+		t.Fatalf("expect %v, got %v", migrate.ErrMigrationLocked, err)
+	}
+	if err := l1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Unlock(ctx); err == nil {
+		t.Fatal("expect error")
+	}
+
+	if err := NewLocker(filepath.Join(tempDir, "missing", "data.db.lock")).Lock(ctx); err == nil {
+		t.Fatal("expect error")
+	}
+
+	db, err := Open(filepath.Join(tempDir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	m, err := NewMigrator(db, createSteps(), nil, migrate.WithLocker(l1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); !errors.Is(err, migrate.ErrMigrationLocked) {
+		t.Fatalf("expect %v, got %v", migrate.ErrMigrationLocked, err)
+	}
+	if err := l2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lockFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expect lock file removed, got %v", err)
+	}
+}
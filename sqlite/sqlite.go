@@ -1,16 +1,23 @@
 package sqlite
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chmike/migrate"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // NewSteps instantiates a new migration step sequence. The name should not be
@@ -20,34 +27,219 @@ func NewSteps(name string) *migrate.Steps {
 	return migrate.NewSteps(name)
 }
 
+// NewStepsWith instantiates a new migration step sequence using the checksum function
+// fn. Changing the checksum function invalidates the version stored in the database.
+func NewStepsWith(name string, fn migrate.ChecksumFunc) *migrate.Steps {
+	return migrate.NewStepsWith(name, fn)
+}
+
+func init() {
+	migrate.Register("sqlite", func(url string) (migrate.SQLDB, error) {
+		return Open(strings.TrimPrefix(url, "sqlite://"))
+	})
+}
+
 type config struct {
-	tableName string
+	tableName       string
+	schema          string
+	schemaFile      string
+	busyTimeout     time.Duration
+	pragmas         map[string]string
+	foreignKeys     string
+	binaryChecksum  bool
+	checksumSize    int
+	history         bool
+	connectAttempts int
+	connectBackoff  time.Duration
 }
 
 // Option function.
 type Option func(*config)
 
-// WithTableName changes the default version table name.
+// WithTableName changes the default version table name. The name may be qualified
+// with the schema of an attached database, like aux.migrate_version.
 func WithTableName(tableName string) Option {
 	return func(c *config) {
 		c.tableName = tableName
 	}
 }
 
+// WithSchema sets the schema of the version and history tables. It is the name of an
+// attached database, like aux, which allows to keep the migration tables in another
+// file than the application data. The database must be attached to every connection of
+// the pool, which is best done with WithAttachedSchema.
+func WithSchema(schema string) Option {
+	return func(c *config) {
+		c.schema = schema
+	}
+}
+
+// WithAttachedSchema attaches the database file with the schema name on every connection
+// of the pool, and sets it as the schema of the version and history tables like
+// WithSchema. The file is created by SQLite when it doesn't exist.
+func WithAttachedSchema(schema, file string) Option {
+	return func(c *config) {
+		c.schema = schema
+		c.schemaFile = file
+	}
+}
+
+// WithHistory records each change of the version in a history table created by Init.
+// The history table is named after the version table with its _version suffix replaced
+// by _history, like migrate_history.
+func WithHistory() Option {
+	return func(c *config) {
+		c.history = true
+	}
+}
+
+// WithConnectRetry makes Open try to open the database at most attempts times, waiting
+// backoff after the first failure and doubling the waiting time after each following
+// failure. It allows to wait, for instance, for the volume holding the database file.
+func WithConnectRetry(attempts int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.connectAttempts = attempts
+		c.connectBackoff = backoff
+	}
+}
+
+// WithBusyTimeout sets the time a connection waits for a lock held by another connection
+// before failing with "database is locked".
+func WithBusyTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.busyTimeout = d
+	}
+}
+
+// WithPragmas sets pragmas, like journal_mode or synchronous, applied to every connection
+// of the database. They are passed as parameters of the connection string and must be
+// supported by the driver.
+func WithPragmas(pragmas map[string]string) Option {
+	return func(c *config) {
+		c.pragmas = pragmas
+	}
+}
+
+// WithBinaryChecksum stores the 32 bytes of the version checksum in a BLOB column instead
+// of its 64 characters hexadecimal string. It must be used for all the accesses to the
+// database as the version table is created by Init with the BLOB column.
+func WithBinaryChecksum() Option {
+	return func(c *config) {
+		c.binaryChecksum = true
+	}
+}
+
+// WithChecksumSize stores only the first size bytes of the version checksum, like 16 for
+// the MD5 digests of a version table created by another tool. The steps must be given
+// the same size with their SetChecksumSize method. The size must be in the range 1 to 32.
+func WithChecksumSize(size int) Option {
+	return func(c *config) {
+		c.checksumSize = size
+	}
+}
+
+// WithForeignKeys enables or disables the enforcement of the foreign key constraints on
+// every connection of the database. The go-sqlite3 driver doesn't enforce them by
+// default, so that ON DELETE CASCADE clauses, for instance, are ignored.
+func WithForeignKeys(enabled bool) Option {
+	return func(c *config) {
+		c.foreignKeys = "off"
+		if enabled {
+			c.foreignKeys = "on"
+		}
+	}
+}
+
+var (
+	// validPragmaName matches a valid pragma name.
+	validPragmaName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// validPragmaValue matches a valid pragma value.
+	validPragmaValue = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+)
+
+// dsnParams returns the connection string parameters of the busy timeout and pragmas.
+func (c *config) dsnParams() (string, error) {
+	params := url.Values{}
+	if c.busyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(c.busyTimeout.Milliseconds(), 10))
+	}
+	for name, value := range c.pragmas {
+		if !validPragmaName.MatchString(name) {
+			return "", fmt.Errorf("invalid pragma name '%s'", name)
+		}
+		if !validPragmaValue.MatchString(value) {
+			return "", fmt.Errorf("invalid pragma value '%s'", value)
+		}
+		params.Set("_"+strings.TrimPrefix(name, "_"), value)
+	}
+	if c.foreignKeys != "" {
+		params.Set("_foreign_keys", c.foreignKeys)
+	}
+	return params.Encode(), nil
+}
+
+// connectHook returns the function attaching the schema file to a new connection, or nil
+// when there is no schema file.
+func (c *config) connectHook() connectHook {
+	if c.schemaFile == "" {
+		return nil
+	}
+	query := `ATTACH DATABASE ? AS "` + c.schema + `"`
+	file := c.schemaFile
+	return func(conn *sqlite3.SQLiteConn) error {
+		if _, err := conn.Exec(query, []driver.Value{file}); err != nil {
+			return fmt.Errorf("attach schema file: %w", err)
+		}
+		return nil
+	}
+}
+
 // Open opens or create an SQLite database.
+//
+// An in-memory database, like ":memory:" or "file:name?mode=memory", is opened with a
+// connection pool limited to one connection that is never closed for being idle or too
+// old. Every connection to an in-memory database opens a new empty database, so that the
+// schema would otherwise be lost between the pooled connections. The *sql.DB returned by
+// DB must thus not be reconfigured with SetMaxOpenConns or SetConnMaxLifetime.
 func Open(sourceName string, options ...Option) (migrate.SQLDB, error) {
 	var c config
 	for _, option := range options {
 		option(&c)
 	}
-	if c.tableName != "" {
-		validName := regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
-		if !validName.MatchString(c.tableName) {
-			return nil, fmt.Errorf("new sqlite: invalid table name '%s'", c.tableName)
+	validName := regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	if schema, table, ok := strings.Cut(c.tableName, "."); ok {
+		if c.schema != "" {
+			return nil, fmt.Errorf("new sqlite: schema set twice in table name '%s'", c.tableName)
+		}
+		c.schema, c.tableName = schema, table
+	}
+	if c.tableName != "" && !validName.MatchString(c.tableName) {
+		return nil, fmt.Errorf("new sqlite: invalid table name '%s'", c.tableName)
+	}
+	if c.schema != "" && !validName.MatchString(c.schema) {
+		return nil, fmt.Errorf("new sqlite: invalid schema name '%s'", c.schema)
+	}
+	if c.checksumSize < 0 || c.checksumSize > 32 {
+		return nil, fmt.Errorf("new sqlite: %w: checksum size %d", migrate.ErrBadParameters, c.checksumSize)
+	}
+	params, err := c.dsnParams()
+	if err != nil {
+		return nil, fmt.Errorf("new sqlite: %w", err)
+	}
+	if params != "" {
+		if strings.Contains(sourceName, "?") {
+			sourceName += "&" + params
+		} else {
+			sourceName += "?" + params
 		}
 	}
 
-	db, err := fixedBrokenSqliteOpen(sourceName, createOrOpen)
+	var db *sql.DB
+	err = migrate.ConnectRetry(c.connectAttempts, c.connectBackoff, func() (err error) {
+		db, err = fixedBrokenSqliteOpen(sourceName, createOrOpen, c.connectHook())
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -57,17 +249,35 @@ func Open(sourceName string, options ...Option) (migrate.SQLDB, error) {
 		InitTableQuery:   `INSERT INTO "migrate_version" ("id", "checksum") VALUES (?, ?)`,
 		VersionQuery:     `SELECT "id", "checksum" FROM "migrate_version" LIMIT 1`,
 		SetVersionQuery:  `UPDATE "migrate_version" SET "id" = ?, "checksum" = ? WHERE "id" = ? AND "checksum" = ?`,
+		TransactionalDDL: true,
+		ChecksumSize:     c.checksumSize,
 	}
 
+	if c.binaryChecksum {
+		q.CreateTableQuery = `CREATE TABLE "migrate_version" ("id" INTEGER NOT NULL, "checksum" BLOB NOT NULL)`
+		q.BinaryChecksum = true
+	}
+	if c.history {
+		q.CreateHistoryQuery = `CREATE TABLE IF NOT EXISTS "migrate_history" ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "from_id" INTEGER NOT NULL, "to_id" INTEGER NOT NULL, "name" TEXT NOT NULL, "applied_at" TIMESTAMP NOT NULL, "dry_run" BOOLEAN NOT NULL)`
+		q.InsertHistoryQuery = `INSERT INTO "migrate_history" ("from_id", "to_id", "name", "applied_at", "dry_run") VALUES (?, ?, ?, ?, ?)`
+		q.HistoryQuery = `SELECT "id", "from_id", "to_id", "name", "applied_at", "dry_run" FROM "migrate_history" ORDER BY "id"`
+	}
 	if c.tableName != "" {
+		q.Replace("migrate_history", strings.TrimSuffix(c.tableName, "_version")+"_history")
 		q.Replace("migrate_version", c.tableName)
 	}
+	if c.schema != "" {
+		table := cmp.Or(c.tableName, "migrate_version")
+		history := strings.TrimSuffix(table, "_version") + "_history"
+		q.Replace(`"`+history+`"`, `"`+c.schema+`"."`+history+`"`)
+		q.Replace(`"`+table+`"`, `"`+c.schema+`"."`+table+`"`)
+	}
 	return migrate.NewSQLDB(db, q), nil
 }
 
 // New returns a new migrator.
-func NewMigrator(db migrate.SQLDB, s migrate.Stepper, l migrate.Logger) (*Migrator, error) {
-	return migrate.New(db, s, l)
+func NewMigrator(db migrate.SQLDB, s migrate.Stepper, l migrate.Logger, options ...migrate.Option) (*Migrator, error) {
+	return migrate.New(db, s, l, options...)
 }
 
 // Cmd is a function simplifying the creation of a Command.
@@ -83,13 +293,35 @@ func Tx(cmds ...migrate.SQLCommand) migrate.StepFunc {
 	return migrate.Tx(cmds...)
 }
 
+// TxCounted returns a migration step function like Tx that also counts the rows of the
+// given tables before and after executing the commands. The counts are performed in the
+// same transaction as the commands and the row count delta of each table is logged at
+// the info level.
+func TxCounted(tables []string, cmds ...migrate.SQLCommand) migrate.StepFunc {
+	return migrate.TxCounted(tables, cmds...)
+}
+
+// Isolation returns a migration step function calling f with a context in which the
+// transactions of the step functions use the given isolation level instead of
+// sql.LevelSerializable.
+func Isolation(level sql.IsolationLevel, f migrate.StepFunc) migrate.StepFunc {
+	return migrate.Isolation(level, f)
+}
+
 // NoTx returns a migration step function that executes the SQL commands in sequence
 // without a wrapping transaction. It terminates as soon as a command returns an error.
-// It doesn't execute any cmds when dryRun is true.
+// It doesn't execute any cmds when dryRun is true, unless in a deep dry run.
 func NoTx(cmds ...migrate.SQLCommand) StepFunc {
 	return migrate.NoTx(cmds...)
 }
 
+// TxIf returns a migration step function like Tx that executes the SQL commands only if
+// cond returns true. When it returns false, the commands are skipped and the version is
+// changed as if they were executed.
+func TxIf(cond func(tx SQLTx) (bool, error), cmds ...migrate.SQLCommand) StepFunc {
+	return migrate.TxIf(cond, cmds...)
+}
+
 // TxFunc is an migrate.TxFunc.
 type TxFunc = migrate.TxFunc
 
@@ -113,12 +345,119 @@ type NoTxFunc = migrate.NoTxFunc
 // without a wrapping transaction. It terminates as soon as a function returns an error.
 // It doesn't execute any function when dryRun is true. The pseudo error ErrCancel is
 // treated as ErrAbort as operations can't be cancelled and database version remains v1.
+// The pseudo error ErrSkip skips the remaining functions and still changes the version.
 //
 // Use with care as any error in the function may leave the database is an undefined state.
 func NoTxF(fs ...NoTxFunc) migrate.StepFunc {
 	return migrate.NoTxF(fs...)
 }
 
+// ExecTx executes the SQL commands in sequence in the transaction tx and logs them at the
+// debug level like Tx. It is intended to be called by a TxFunc.
+func ExecTx(tx SQLTx, log Logger, cmds ...migrate.SQLCommand) error {
+	return migrate.ExecTx(tx, log, cmds...)
+}
+
+// ExecNoTx executes the SQL commands in sequence without a transaction and logs them at
+// the debug level like NoTx. It is intended to be called by a NoTxFunc.
+func ExecNoTx(ctx context.Context, db SQLDB, log Logger, cmds ...migrate.SQLCommand) error {
+	return migrate.ExecNoTx(ctx, db, log, cmds...)
+}
+
+// Describe returns a TxFunc calling f after logging the description at the debug level.
+func Describe(description string, f TxFunc) TxFunc {
+	return migrate.Describe(description, f)
+}
+
+// DescribeNoTx returns a NoTxFunc calling f after logging the description at the debug
+// level.
+func DescribeNoTx(description string, f NoTxFunc) NoTxFunc {
+	return migrate.DescribeNoTx(description, f)
+}
+
+// FindVersionTables returns the names of the tables having the shape of a version table,
+// which is an "id" INTEGER column, a "checksum" TEXT or BLOB column, any other extra
+// columns, and a single row. The tables of the attached databases are qualified with
+// their schema, like aux.migrate_version. It helps finding orphaned version tables when
+// WithTableName or WithSchema were used inconsistently.
+func FindVersionTables(db *sql.DB) ([]string, error) {
+	schemas, err := queryNames(db, `SELECT "name" FROM pragma_database_list WHERE "name" != 'temp' ORDER BY "seq"`)
+	if err != nil {
+		return nil, fmt.Errorf("find version tables: %w", err)
+	}
+	var tables []string
+	for _, schema := range schemas {
+		names, err := queryNames(db, `SELECT "name" FROM `+quote(schema)+`."sqlite_master" WHERE "type" = 'table' AND "name" NOT LIKE 'sqlite_%' ORDER BY "name"`)
+		if err != nil {
+			return nil, fmt.Errorf("find version tables: %w", err)
+		}
+		for _, name := range names {
+			ok, err := isVersionTable(db, schema, name)
+			if err != nil {
+				return nil, fmt.Errorf("find version tables: %w", err)
+			}
+			if ok && schema == "main" {
+				tables = append(tables, name)
+			} else if ok {
+				tables = append(tables, schema+"."+name)
+			}
+		}
+	}
+	return tables, nil
+}
+
+// queryNames returns the names returned by the query.
+func queryNames(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// isVersionTable returns true when the table of the schema has the shape of a version
+// table.
+func isVersionTable(db *sql.DB, schema, name string) (bool, error) {
+	rows, err := db.Query(`SELECT "name", "type" FROM pragma_table_info(?, ?)`, name, schema)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	columns := make(map[string]string)
+	for rows.Next() {
+		var column, columnType string
+		if err := rows.Scan(&column, &columnType); err != nil {
+			return false, err
+		}
+		columns[column] = strings.ToUpper(columnType)
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if columns["id"] != "INTEGER" || (columns["checksum"] != "TEXT" && columns["checksum"] != "BLOB") {
+		return false, nil
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ` + quote(schema) + `.` + quote(name)).Scan(&count); err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+// quote returns the quoted identifier.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
 type sqliteOpenOp int
 
 const (
@@ -132,8 +471,13 @@ var forceSqlOpenError error
 // fixedBrokenSqliteOpen opens the sqlite3 database. File creation are allowed when create
 // only if (1) the file exist, it is a file,
 // it has the sqlite3 database file signature, and is writable, or (2) the file doesn't exist
-// and it can be created unless create is true.
-func fixedBrokenSqliteOpen(path string, op sqliteOpenOp) (*sql.DB, error) {
+// and it can be created unless create is true. The connection string parameters following
+// the path, if any, are passed to the driver.
+func fixedBrokenSqliteOpen(dsn string, op sqliteOpenOp, hook connectHook) (*sql.DB, error) {
+	if isMemory(dsn) {
+		return openMemory(dsn, hook)
+	}
+	path, _, _ := strings.Cut(dsn, "?")
 	stat, err := os.Stat(path)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) || op == openOnly {
@@ -159,7 +503,7 @@ func fixedBrokenSqliteOpen(path string, op sqliteOpenOp) (*sql.DB, error) {
 			return nil, fmt.Errorf("invalid SQLite file: %w", err)
 		}
 	}
-	db, err := sql.Open("sqlite3", path)
+	db, err := sqlOpen(dsn, hook)
 	if forceSqlOpenError != nil {
 		err = forceSqlOpenError
 	}
@@ -175,6 +519,64 @@ func fixedBrokenSqliteOpen(path string, op sqliteOpenOp) (*sql.DB, error) {
 	return db, nil
 }
 
+// isMemory returns true if the connection string designates an in-memory database.
+func isMemory(dsn string) bool {
+	path, query, _ := strings.Cut(dsn, "?")
+	if path == ":memory:" || path == "file::memory:" {
+		return true
+	}
+	params, err := url.ParseQuery(query)
+	return err == nil && params.Get("mode") == "memory"
+}
+
+// openMemory opens an in-memory database. The connection pool is limited to one
+// connection because every connection to an in-memory database opens a new database,
+// unless the cache is shared in which case concurrent connections would fail with
+// locked tables.
+func openMemory(dsn string, hook connectHook) (*sql.DB, error) {
+	db, err := sqlOpen(dsn, hook)
+	if forceSqlOpenError != nil {
+		err = forceSqlOpenError
+	}
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%w: %v", err, dsn)
+	}
+	return db, nil
+}
+
+// connectHook is called with every new connection of the pool.
+type connectHook func(*sqlite3.SQLiteConn) error
+
+// sqlOpen opens the database with the sqlite3 driver, calling hook with every new
+// connection when it is not nil.
+func sqlOpen(dsn string, hook connectHook) (*sql.DB, error) {
+	if hook == nil {
+		return sql.Open("sqlite3", dsn)
+	}
+	return sql.OpenDB(&connector{driver: &sqlite3.SQLiteDriver{ConnectHook: hook}, dsn: dsn}), nil
+}
+
+// connector opens the connections of the pool with its driver.
+type connector struct {
+	driver *sqlite3.SQLiteDriver
+	dsn    string
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
 var forceReadError error
 
 func checkSQLiteHeader(path string) error {
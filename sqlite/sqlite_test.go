@@ -3,13 +3,18 @@ package sqlite
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/chmike/migrate"
 )
@@ -287,19 +292,686 @@ func TestSqliteOpenTable(t *testing.T) {
 	}
 }
 
-// func TestSqliteOpenErrors(t *testing.T) {
-// 	_, err := Open("broken.db")
-// 	if err == nil {
-// 		t.Fatal("expect error")
-// 	}
+func TestSqliteOpenSchema(t *testing.T) {
+	dir := t.TempDir()
+	auxFile := filepath.Join(dir, "aux.db")
+	for i, opts := range [][]Option{
+		{WithAttachedSchema("aux", auxFile), WithHistory()},
+		{WithAttachedSchema("aux", auxFile), WithTableName("app_version"), WithHistory()},
+	} {
+		db, err := Open(filepath.Join(dir, fmt.Sprintf("data%d.db", i)), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.DB().Close()
+		if q := db.Queries(); !strings.Contains(q.VersionQuery, `FROM "aux".`) || !strings.Contains(q.HistoryQuery, `FROM "aux".`) {
+			t.Fatalf("expect aux schema in %q and %q", q.VersionQuery, q.HistoryQuery)
+		}
+		m, err := NewMigrator(db, createSteps(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.AllUp(); err != nil {
+			t.Fatal(err)
+		}
+		if entries, err := m.History(); err != nil || len(entries) != 2 {
+			t.Fatalf("expect 2 history entries, got %v %v", entries, err)
+		}
+		if tables, err := getSQLiteTables(db.DB()); err != nil || slices.ContainsFunc(tables, func(name string) bool {
+			return strings.HasSuffix(name, "_version")
+		}) {
+			t.Fatalf("expect no version table in main database, got %v %v", tables, err)
+		}
+
+		// every connection of the pool has the schema attached
+		var conns []*sql.Conn
+		for range 3 {
+			conn, err := db.DB().Conn(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			var id int
+			if err := conn.QueryRowContext(context.Background(), db.Queries().VersionQuery).Scan(&id, new(string)); err != nil || id != 2 {
+				t.Fatalf("expect version 2, got %d %v", id, err)
+			}
+		}
+	}
+
+	db, err := Open(filepath.Join(dir, "data.db"), WithTableName("aux.app_version"), WithHistory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	if q := db.Queries(); !strings.Contains(q.VersionQuery, `FROM "aux"."app_version"`) || !strings.Contains(q.HistoryQuery, `FROM "aux"."app_history"`) {
+		t.Fatalf("expect aux schema in %q and %q", q.VersionQuery, q.HistoryQuery)
+	}
+
+	aux, err := Open(auxFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aux.DB().Close()
+	tables, err := getSQLiteTables(aux.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"migrate_version", "migrate_history", "app_version", "app_history"} {
+		if !slices.Contains(tables, table) {
+			t.Fatalf("expect %v in %v", table, tables)
+		}
+	}
+
+	for _, opts := range [][]Option{
+		{WithSchema("a-b")},
+		{WithTableName("a.b.c")},
+		{WithSchema("aux"), WithTableName("aux.app_version")},
+		{WithAttachedSchema("a-b", auxFile)},
+	} {
+		if _, err := Open(filepath.Join(dir, "bad.db"), opts...); err == nil {
+			t.Fatal("expect error")
+		}
+	}
+}
+
+func TestTxCounted(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sqlite_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	db, err := Open(filepath.Join(tempDir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	s := NewSteps("test database")
+	s.Append("create table", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "msg" TEXT NOT NULL);`)), nil)
+	s.Append("insert rows", TxCounted([]string{"test"},
+		Cmd(`INSERT INTO "test" ("msg") VALUES (?);`, "a"),
+		Cmd(`INSERT INTO "test" ("msg") VALUES (?);`, "b"),
+		Cmd(`INSERT INTO "test" ("msg") VALUES (?);`, "c"),
+	), nil)
+
+	var buf bytes.Buffer
+	logger := migrate.NewLogLoggerWith(log.New(&buf, "", 0), migrate.LevelInfo)
+	m, err := NewMigrator(db, s, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "[INFO] row count | name='insert rows' table='test' before='0' after='3' delta='3'"; !strings.Contains(buf.String(), exp) {
+		t.Fatalf("expect %q in %q", exp, buf.String())
+	}
+
+	buf.Reset()
+	logger.SetLevel(migrate.LevelWarn)
+	if err := m.OneDown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "row count") {
+		t.Fatalf("unexpected row count log in %q", buf.String())
+	}
+
+	if err := m.OneDown(); err != nil {
+		t.Fatal(err)
+	}
+	s = NewSteps("test database")
+	s.Append("create table", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "msg" TEXT NOT NULL);`)), nil)
+	s.Append("insert rows", TxCounted([]string{"test; DROP TABLE test"}, Cmd(`INSERT INTO "test" ("msg") VALUES ('a');`)), nil)
+	m, err = NewMigrator(db, s, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); !errors.Is(err, migrate.ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", migrate.ErrBadParameters, err)
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	s := NewSteps("test database")
+	s.Append("runaway step", Tx(
+		Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "msg" TEXT NOT NULL);`),
+		Cmd(`WITH RECURSIVE "c"("x") AS (SELECT 1 UNION ALL SELECT "x"+1 FROM "c") INSERT INTO "test" ("msg") SELECT "x" FROM "c";`),
+	), nil)
+	m, err := NewMigrator(db, s, nil, migrate.WithStepTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, got %v", context.DeadlineExceeded, err)
+	}
+	if v, err := m.Version(); err != nil || v.ID != 0 {
+		t.Fatalf("expect v0, got %v %v", v, err)
+	}
+	var count int
+	if err := db.DB().QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'test'`).Scan(&count); err != nil || count != 0 {
+		t.Fatalf("expect rolled back table, got %d %v", count, err)
+	}
+}
+
+func TestExtraColumns(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	q := db.Queries()
+	q.CreateTableQuery = `CREATE TABLE "migrate_version" ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL, "applied_at" TIMESTAMP NOT NULL, "applied_by" TEXT NOT NULL)`
+	q.InitTableQuery = `INSERT INTO "migrate_version" ("applied_at", "applied_by", "id", "checksum") VALUES (?, ?, ?, ?)`
+	q.SetVersionQuery = `UPDATE "migrate_version" SET "applied_at" = ?, "applied_by" = ?, "id" = ?, "checksum" = ? WHERE "id" = ? AND "checksum" = ?`
+	user := "init"
+	appliedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	q.Extra = &migrate.ExtraColumns{Args: func() []any { return []any{appliedAt, user} }}
+
+	m, err := NewMigrator(db, createSteps(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	user, appliedAt = "admin", appliedAt.Add(time.Hour)
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Version(); err != nil || v.ID != 1 {
+		t.Fatalf("expect v1, got %v %v", v, err)
+	}
+	var by string
+	var at time.Time
+	if err := db.DB().QueryRow(`SELECT "applied_by", "applied_at" FROM "migrate_version"`).Scan(&by, &at); err != nil {
+		t.Fatal(err)
+	}
+	if by != user || !at.Equal(appliedAt) {
+		t.Fatalf("expect %s %v, got %s %v", user, appliedAt, by, at)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"), WithHistory(), WithTableName("app_version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	m, err := NewMigrator(db, createSteps(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Second)
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneDownDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneDown(); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.DB().QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'app_history'`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expect app_history table, got %d %v", count, err)
+	}
+	entries, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []migrate.HistoryEntry{
+		{ID: 1, From: 0, To: 1, Name: "create table"},
+		{ID: 2, From: 1, To: 2, Name: "insert row"},
+		{ID: 3, From: 2, To: 1, Name: "insert row"},
+	}
+	if len(entries) != len(exp) {
+		t.Fatalf("expect %d entries, got %+v", len(exp), entries)
+	}
+	for i := range exp {
+		if entries[i].AppliedAt.Before(start) || entries[i].AppliedAt.After(time.Now()) {
+			t.Fatalf("unexpected applied at time %v", entries[i].AppliedAt)
+		}
+		entries[i].AppliedAt = time.Time{}
+		if entries[i] != exp[i] {
+			t.Fatalf("expect %+v, got %+v", exp[i], entries[i])
+		}
+	}
+
+	db2, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.DB().Close()
+	m, err = NewMigrator(db2, createSteps(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.History(); !errors.Is(err, migrate.ErrNoHistory) {
+		t.Fatalf("expect %v, got %v", migrate.ErrNoHistory, err)
+	}
+}
+
+// stepClock is a clock advancing by one second at each call.
+type stepClock struct {
+	t time.Time
+}
+
+func (c *stepClock) Now() time.Time {
+	c.t = c.t.Add(time.Second)
+	return c.t
+}
+
+func TestHistoryClock(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"), WithHistory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, err := NewMigrator(db, createSteps(), nil, migrate.WithClock(&stepClock{t: start}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpN(1); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries, got %+v", entries)
+	}
+	for i, entry := range entries {
+		if exp := start.Add(time.Duration(i+1) * time.Second); !entry.AppliedAt.Equal(exp) {
+			t.Fatalf("expect applied at %v, got %v", exp, entry.AppliedAt)
+		}
+	}
+}
+
+func TestTxIf(t *testing.T) {
+	indexCount := func(db *sql.DB) (count int, err error) {
+		err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'test_msg'`).Scan(&count)
+		return
+	}
+	s := NewSteps("test database")
+	s.Append("create table", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "msg" TEXT NOT NULL);`)), nil)
+	s.Append("create index", TxIf(func(tx SQLTx) (bool, error) {
+		var count int
+		err := tx.Tx().QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'test_msg'`).Scan(&count)
+		return count == 0, err
+	}, Cmd(`CREATE INDEX "test_msg" ON "test" ("msg");`)), nil)
+
+	for _, preCreated := range []bool{false, true} {
+		db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.DB().Close()
+		m, err := NewMigrator(db, s, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.OneUp(); err != nil {
+			t.Fatal(err)
+		}
+		if preCreated {
+			if _, err := db.DB().Exec(`CREATE INDEX "test_msg" ON "test" ("msg");`); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := m.OneUp(); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := m.Version(); err != nil || v.ID != 2 {
+			t.Fatalf("expect v2, got %v %v", v, err)
+		}
+		if count, err := indexCount(db.DB()); err != nil || count != 1 {
+			t.Fatalf("expect index, got %d %v", count, err)
+		}
+	}
+
+	s = NewSteps("test database")
+	s.Append("failed condition", TxIf(func(tx SQLTx) (bool, error) {
+		return false, errors.New("condition error")
+	}), nil)
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUp(); err == nil || !strings.Contains(err.Error(), "tx if condition: condition error") {
+		t.Fatalf("expect condition error, got %v", err)
+	}
+}
+
+func TestUpN(t *testing.T) {
+	tableCount := func(db *sql.DB) (count int, err error) {
+		err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name LIKE 'test%'`).Scan(&count)
+		return
+	}
+	s := NewSteps("test database")
+	s.Append("create table 1", Tx(Cmd(`CREATE TABLE "test1" ("id" INTEGER PRIMARY KEY);`)), nil)
+	s.Append("create table 2", Tx(Cmd(`CREATE TABLE "test2" ("id" INTEGER PRIMARY KEY);`)), nil)
+	s.Append("nil step", nil, nil)
+	s.Append("failing step", Tx(Cmd(`CREATE TABLE "test1" ("id" INTEGER PRIMARY KEY);`)), nil)
+
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.UpN(4); err == nil {
+		t.Fatal("expect error")
+	}
+	if v, err := m.Version(); err != nil || v.ID != 0 {
+		t.Fatalf("expect v0, got %v %v", v, err)
+	}
+	if count, err := tableCount(db.DB()); err != nil || count != 0 {
+		t.Fatalf("expect no table, got %d %v", count, err)
+	}
+
+	if err := m.UpN(3); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Version(); err != nil || v.ID != 3 {
+		t.Fatalf("expect v3, got %v %v", v, err)
+	}
+	if count, err := tableCount(db.DB()); err != nil || count != 2 {
+		t.Fatalf("expect 2 tables, got %d %v", count, err)
+	}
+
+	if err := m.UpN(2); err == nil {
+		t.Fatal("expect error")
+	}
+	if v, err := m.Version(); err != nil || v.ID != 3 {
+		t.Fatalf("expect v3, got %v %v", v, err)
+	}
+	if err := m.UpN(0); !errors.Is(err, migrate.ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", migrate.ErrBadParameters, err)
+	}
+}
+
+func TestUpNNoTx(t *testing.T) {
+	noTxF := NoTxF(func(ctx context.Context, db SQLDB, info StepInfo, log Logger) error {
+		return ExecNoTx(ctx, db, log, Cmd(`CREATE TABLE "test3" ("id" INTEGER PRIMARY KEY);`))
+	})
+	for i, step := range []StepFunc{NoTx(Cmd(`CREATE TABLE "test2" ("id" INTEGER PRIMARY KEY);`)), noTxF} {
+		s := NewSteps("test database")
+		s.Append("create table 1", Tx(Cmd(`CREATE TABLE "test1" ("id" INTEGER PRIMARY KEY);`)), nil)
+		s.Append("no tx", step, nil)
+
+		db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.DB().Close()
+		m, err := NewMigrator(db, s, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.UpN(2); !errors.Is(err, migrate.ErrNoTxInBatch) {
+			t.Fatalf("%d: expect %v, got %v", i, migrate.ErrNoTxInBatch, err)
+		}
+		if v, err := m.Version(); err != nil || v.ID != 0 {
+			t.Fatalf("%d: expect v0, got %v %v", i, v, err)
+		}
+		var count int
+		if err := db.DB().QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name LIKE 'test%'`).Scan(&count); err != nil || count != 0 {
+			t.Fatalf("%d: expect no table, got %d %v", i, count, err)
+		}
+	}
+}
+
+func TestBadVersionChecksum(t *testing.T) {
+	s := NewSteps("test database")
+	s.Append("tx", Tx(Cmd(`CREATE TABLE "test1" ("id" INTEGER PRIMARY KEY);`)), nil)
+	s.Append("txf", TxF(func(tx SQLTx, info StepInfo, dryRun bool, log Logger) error { return nil }), nil)
+	s.Append("notx", NoTx(Cmd(`CREATE TABLE "test2" ("id" INTEGER PRIMARY KEY);`)), nil)
+
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for ID := 1; ID <= 3; ID++ {
+		// change the checksum of the database version behind the migrator
+		if _, err := db.DB().Exec(`UPDATE "migrate_version" SET "checksum" = ?`, strings.Repeat("0", 64)); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.OneUp(); !errors.Is(err, migrate.ErrBadVersionChecksum) {
+			t.Fatalf("step %d: expect %v, got %v", ID, migrate.ErrBadVersionChecksum, err)
+		}
+		v, _ := s.Version(ID - 1)
+		if _, err := db.DB().Exec(`UPDATE "migrate_version" SET "checksum" = ?`, v.ChecksumString()); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.OneUp(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCASRetry(t *testing.T) {
+	s := NewSteps("test database")
+	s.Append("t1", Tx(Cmd(`CREATE TABLE "test1" ("id" INTEGER PRIMARY KEY);`)), nil)
+	s.Append("t2", Tx(Cmd(`CREATE TABLE "test2" ("id" INTEGER PRIMARY KEY);`)), nil)
+
+	fileName := filepath.Join(t.TempDir(), "data.db")
+	db1, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db1.DB().Close()
+	m1, err := NewMigrator(db1, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m1.Init(); err != nil {
+		t.Fatal(err)
+	}
+	db2, err := Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.DB().Close()
+	m2, err := NewMigrator(db2, s, nil, migrate.WithCASRetry(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m2.Version(); err != nil || v.ID != 0 {
+		t.Fatalf("expect v0, got %v %v", v, err)
+	}
+
+	// m1 applies the first step behind m2
+	if err := m1.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m1.Version(); err != nil || v.ID != 2 {
+		t.Fatalf("expect v2, got %v %v", v, err)
+	}
+}
+
+func TestFindVersionTables(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sqlite_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	fileName := filepath.Join(tempDir, "data.db")
+	auxFile := filepath.Join(tempDir, "aux.db")
+	for i, options := range [][]Option{
+		{},
+		{WithTableName("temp_version")},
+		{WithTableName("bin_version"), WithBinaryChecksum()},
+		{WithAttachedSchema("aux", auxFile)},
+	} {
+		db, err := Open(fileName, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := NewMigrator(db, createSteps(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if err := m.AllUp(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db.DB().Close()
+	}
+
+	db, err := Open(fileName, WithAttachedSchema("aux", auxFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	for _, query := range []string{
+		`CREATE TABLE "other" ("id" INTEGER NOT NULL, "name" TEXT NOT NULL)`,
+		`CREATE TABLE "empty_version" ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+		`CREATE TABLE "extra_version" ("applied_at" TIMESTAMP NOT NULL, "id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+		`INSERT INTO "extra_version" VALUES (CURRENT_TIMESTAMP, 0, '')`,
+	} {
+		if _, err := db.DB().Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tables, err := FindVersionTables(db.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"bin_version", "extra_version", "migrate_version", "temp_version", "aux.migrate_version"}; !slices.Equal(tables, exp) {
+		t.Fatalf("expect %v, got %v", exp, tables)
+	}
+
+	db.DB().Close()
+	if _, err := FindVersionTables(db.DB()); err == nil {
+		t.Fatal("expect error")
+	}
+}
+
+func TestSqliteOpenErrors(t *testing.T) {
+	_, err := Open(filepath.Join("no", "such", "dir", "broken.db"))
+	if err == nil {
+		t.Fatal("expect error")
+	}
+
+	_, err = Open(":memory:", WithTableName("space not allowed"))
+	if err == nil {
+		t.Fatal("expect error")
+	}
 
-// 	_, err = Open(":memory:", WithTableName("space not allowed"))
-// 	if err == nil {
-// 		t.Fatal("expect error")
-// 	}
+	_, err = Open(filepath.Join("no", "such", "dir", "broken.db"), WithConnectRetry(3, time.Millisecond))
+	if err == nil || !strings.Contains(err.Error(), "3 times") {
+		t.Fatalf("expect connect error, got %v", err)
+	}
+}
 
-// 	// defer db.DB().Close()
-// }
+func TestSqliteOpenMemory(t *testing.T) {
+	for _, dsn := range []string{":memory:", "file:memtest?mode=memory&cache=shared", ":memory:?_foreign_keys=on"} {
+		if !isMemory(dsn) {
+			t.Fatalf("expect %q in memory", dsn)
+		}
+		db, err := Open(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := db.DB().Stats().MaxOpenConnections; n != 1 {
+			t.Fatalf("expect 1 max open connection, got %d", n)
+		}
+		m, err := NewMigrator(db, createSteps(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.AllUp(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.AllDown(); err != nil {
+			t.Fatal(err)
+		}
+		db.DB().Close()
+	}
+	if isMemory("data.db?mode=rw") {
+		t.Fatal("unexpected in memory database")
+	}
+}
 
 func TestFixedBrokenSqliteOpen(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "sqlite_test")
@@ -310,7 +982,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 
 	t.Run("CreateOnly_Success", func(t *testing.T) {
 		dbPath := filepath.Join(tempDir, "test_create_only.db")
-		db, err := fixedBrokenSqliteOpen(dbPath, createOnly)
+		db, err := fixedBrokenSqliteOpen(dbPath, createOnly, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -326,7 +998,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 
 		createValidSqliteFile(t, dbPath)
 
-		_, err := fixedBrokenSqliteOpen(dbPath, createOnly)
+		_, err := fixedBrokenSqliteOpen(dbPath, createOnly, nil)
 		if !errors.Is(errors.Unwrap(err), os.ErrExist) {
 			t.Fatalf("Expected os.ErrExist, got: %v", err)
 		}
@@ -337,7 +1009,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 
 		createValidSqliteFile(t, dbPath)
 
-		db, err := fixedBrokenSqliteOpen(dbPath, openOnly)
+		db, err := fixedBrokenSqliteOpen(dbPath, openOnly, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -346,7 +1018,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 
 	t.Run("OpenOnly_FileNotExists", func(t *testing.T) {
 		dbPath := filepath.Join(tempDir, "nonexistent.db")
-		_, err := fixedBrokenSqliteOpen(dbPath, openOnly)
+		_, err := fixedBrokenSqliteOpen(dbPath, openOnly, nil)
 		if !errors.Is(errors.Unwrap(err), os.ErrNotExist) {
 			t.Fatalf("Expected os.ErrNotExist, got: %v", err)
 		}
@@ -357,7 +1029,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 
 		createValidSqliteFile(t, dbPath)
 
-		db, err := fixedBrokenSqliteOpen(dbPath, createOrOpen)
+		db, err := fixedBrokenSqliteOpen(dbPath, createOrOpen, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -366,7 +1038,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 
 	t.Run("CreateOrOpen_New", func(t *testing.T) {
 		dbPath := filepath.Join(tempDir, "test_create_or_open_new.db")
-		db, err := fixedBrokenSqliteOpen(dbPath, createOrOpen)
+		db, err := fixedBrokenSqliteOpen(dbPath, createOrOpen, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -384,7 +1056,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		_, err = fixedBrokenSqliteOpen(dirPath, openOnly)
+		_, err = fixedBrokenSqliteOpen(dirPath, openOnly, nil)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -401,7 +1073,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		_, err = fixedBrokenSqliteOpen(invalidFilePath, openOnly)
+		_, err = fixedBrokenSqliteOpen(invalidFilePath, openOnly, nil)
 		if err == nil {
 			t.Fatal("unexpected error")
 		}
@@ -416,7 +1088,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 			}
 
 			dbPath := filepath.Join(readOnlyDir, "test.db")
-			_, err = fixedBrokenSqliteOpen(dbPath, createOrOpen)
+			_, err = fixedBrokenSqliteOpen(dbPath, createOrOpen, nil)
 			if err == nil {
 				t.Fatal("expected error")
 			}
@@ -428,7 +1100,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 		createValidSqliteFile(t, mockDbPath)
 
 		forceSqlOpenError = errors.New("force sql open error")
-		db, err := fixedBrokenSqliteOpen(mockDbPath, openOnly)
+		db, err := fixedBrokenSqliteOpen(mockDbPath, openOnly, nil)
 		if err == nil {
 			db.Close()
 			t.Fatal("expect error")
@@ -454,7 +1126,7 @@ func TestFixedBrokenSqliteOpen(t *testing.T) {
 		if err != nil {
 			t.Fatalf("failed to corrupt file: %v", err)
 		}
-		db, err := fixedBrokenSqliteOpen(mockDbPath, openOnly)
+		db, err := fixedBrokenSqliteOpen(mockDbPath, openOnly, nil)
 		if err == nil {
 			db.Close()
 			t.Fatal("expect error")
@@ -543,3 +1215,234 @@ func createValidSqliteFile(t *testing.T, path string) {
 		t.Fatal(err)
 	}
 }
+
+func TestOpenURL(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sqlite_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	db, err := migrate.OpenURL("sqlite://" + filepath.Join(tempDir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	if exp := `SELECT "id", "checksum" FROM "migrate_version" LIMIT 1`; db.Queries().VersionQuery != exp {
+		t.Fatalf("expect %q, got %q", exp, db.Queries().VersionQuery)
+	}
+}
+
+func TestOpenPragmas(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sqlite_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	db, err := Open(filepath.Join(tempDir, "data.db"), WithBusyTimeout(3*time.Second),
+		WithPragmas(map[string]string{"journal_mode": "WAL", "foreign_keys": "on"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	var timeout int
+	if err := db.DB().QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 3000 {
+		t.Fatalf("expect 3000, got %d", timeout)
+	}
+	var mode string
+	if err := db.DB().QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expect wal, got %s", mode)
+	}
+	var foreignKeys int
+	if err := db.DB().QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		t.Fatal(err)
+	}
+	if foreignKeys != 1 {
+		t.Fatalf("expect 1, got %d", foreignKeys)
+	}
+
+	if _, err := Open(filepath.Join(tempDir, "data.db"), WithPragmas(map[string]string{"journal_mode;": "WAL"})); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := Open(filepath.Join(tempDir, "data.db"), WithPragmas(map[string]string{"journal_mode": "WAL&x=1"})); err == nil {
+		t.Fatal("expect error")
+	}
+}
+
+func TestOpenForeignKeys(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		db, err := Open(filepath.Join(t.TempDir(), "data.db"), WithForeignKeys(enabled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.DB().Close()
+		_, err = db.DB().Exec(`CREATE TABLE "parent" ("id" INTEGER PRIMARY KEY);
+			CREATE TABLE "child" ("id" INTEGER PRIMARY KEY, "parent_id" INTEGER REFERENCES "parent" ("id") ON DELETE CASCADE);
+			INSERT INTO "parent" ("id") VALUES (1);
+			INSERT INTO "child" ("id", "parent_id") VALUES (1, 1);
+			DELETE FROM "parent";`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		if err := db.DB().QueryRow(`SELECT COUNT(*) FROM "child"`).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if exp := map[bool]int{true: 0, false: 1}[enabled]; count != exp {
+			t.Fatalf("foreign keys %t: expect %d child rows, got %d", enabled, exp, count)
+		}
+	}
+}
+
+func TestBuildQueries(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+	*db.Queries() = *migrate.BuildQueries(`"built_version"`, migrate.QuestionMark)
+
+	s := NewSteps("test database")
+	s.Append("create table", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY);`)), nil)
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Version(); err != nil || v.ID != 1 {
+		t.Fatalf("expect v1, got %v %v", v, err)
+	}
+}
+
+func TestBinaryChecksum(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data.db")
+	db, err := Open(fileName, WithBinaryChecksum(), WithTableName("bin_version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	s := NewSteps("test database")
+	s.Append("create table", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY);`)), nil)
+	s.Append("nil step", nil, nil)
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	v2, _ := s.Version(2)
+	var checksum []byte
+	if err := db.DB().QueryRow(`SELECT "checksum" FROM "bin_version"`).Scan(&checksum); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(checksum, v2.Checksum[:]) {
+		t.Fatalf("expect checksum %x, got %x", v2.Checksum, checksum)
+	}
+	if v, err := m.Version(); err != nil || v != v2 {
+		t.Fatalf("expect %v, got %v %v", v2, v, err)
+	}
+	if err := m.AllDown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChecksumSize(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "bad.db"), WithChecksumSize(33)); !errors.Is(err, migrate.ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", migrate.ErrBadParameters, err)
+	}
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"), WithChecksumSize(md5.Size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	md5Checksum := func(prev [32]byte, ID int, name string, content []byte) (checksum [32]byte) {
+		sum := md5.Sum(fmt.Appendf(nil, "%x %d %s %s", prev[:md5.Size], ID, name, content))
+		copy(checksum[:], sum[:])
+		return checksum
+	}
+	s := NewStepsWith("test database", md5Checksum)
+	s.SetChecksumSize(md5.Size)
+	s.Append("create table", Tx(Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY);`)), nil)
+	s.Append("nil step", nil, nil)
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	v2, _ := s.Version(2)
+	var checksum string
+	if err := db.DB().QueryRow(`SELECT "checksum" FROM "migrate_version"`).Scan(&checksum); err != nil {
+		t.Fatal(err)
+	}
+	if exp := hex.EncodeToString(v2.Checksum[:md5.Size]); checksum != exp {
+		t.Fatalf("expect checksum %s, got %s", exp, checksum)
+	}
+	if v, err := m.Version(); err != nil || v != v2 {
+		t.Fatalf("expect %v, got %v %v", v2, v, err)
+	}
+	if err := m.AllDown(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeepDryRun(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB().Close()
+
+	s := NewSteps("test database")
+	s.Append("create table", NoTx(Cmd(`CREATE TABLE "test" ("id" INTEGER PRIMARY KEY, "msg" TEXT);`)), nil)
+	s.Append("create index", NoTx(Cmd(`CREATE INDEX test_msg ON test (mgs);`)), nil)
+	m, err := NewMigrator(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := migrate.WithDeepDryRun(context.Background())
+	if err := m.OneUpDryRunCtx(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.DB().QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'test'`).Scan(&count); err != nil || count != 0 {
+		t.Fatalf("expect no table, got %d %v", count, err)
+	}
+	if err := m.OneUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUpDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.OneUpDryRunCtx(ctx); err == nil || !strings.Contains(err.Error(), "mgs") {
+		t.Fatalf("expect column error, got %v", err)
+	}
+	if v, err := m.Version(); err != nil || v.ID != 1 {
+		t.Fatalf("expect v1, got %v %v", v, err)
+	}
+}
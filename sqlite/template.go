@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/chmike/migrate"
+)
+
+// Template creates a template database in the directory dir migrated with all the steps
+// up and returns a function opening a fresh copy of the template. Copying the template
+// file is much faster than executing the migration steps for each database and is
+// intended to speed up test suites. The copies are created in dir which, as the template,
+// should be removed by the caller when done, e.g. by using t.TempDir() as dir.
+func Template(dir string, steps migrate.Stepper, options ...Option) (func() (migrate.SQLDB, error), error) {
+	path := filepath.Join(dir, "template.sqlite")
+	db, err := Open(path, options...)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	m, err := NewMigrator(db, steps, nil)
+	if err == nil {
+		err = m.Init()
+	}
+	if err == nil {
+		err = m.AllUp()
+	}
+	if closeErr := db.DB().Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+
+	var count atomic.Int64
+	return func() (migrate.SQLDB, error) {
+		copyPath := filepath.Join(dir, fmt.Sprintf("copy-%d.sqlite", count.Add(1)))
+		if err := copyFile(copyPath, path); err != nil {
+			return nil, fmt.Errorf("template copy: %w", err)
+		}
+		return Open(copyPath, options...)
+	}, nil
+}
+
+// copyFile copies the file src into the new file dst.
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	dir := t.TempDir()
+	s := createSteps()
+	newDB, err := Template(dir, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, _ := s.Version(s.Len() - 1)
+
+	db1, err := newDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db1.DB().Close()
+	db2, err := newDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.DB().Close()
+
+	for _, db := range []SQLDB{db1, db2} {
+		m, err := NewMigrator(db, s, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := m.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != last {
+			t.Fatalf("expect %v, got %v", last, v)
+		}
+	}
+
+	if _, err := db1.DB().Exec(`INSERT INTO "test" ("msg") VALUES ('copy 1')`); err != nil {
+		t.Fatal(err)
+	}
+	var n1, n2 int
+	if err := db1.DB().QueryRow(`SELECT COUNT(*) FROM "test"`).Scan(&n1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db2.DB().QueryRow(`SELECT COUNT(*) FROM "test"`).Scan(&n2); err != nil {
+		t.Fatal(err)
+	}
+	if n1 != n2+1 {
+		t.Fatalf("expect independent copies, got %d and %d rows", n1, n2)
+	}
+
+	if _, err := Template(dir, s); err == nil {
+		t.Fatal("expect error for an existing template")
+	}
+}
@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dollarQuoteTag matches the opening tag of a PostgreSQL dollar quoted string.
+var dollarQuoteTag = regexp.MustCompile(`^\$([a-zA-Z_][a-zA-Z0-9_]*)?\$`)
+
+// CmdsFromSQL splits an SQL script into its statements separated by semicolons and
+// returns them as SQL commands without arguments, usable with Tx(cmds...). Semicolons
+// in string literals, quoted identifiers, dollar quoted strings, comments and in the
+// BEGIN...END body of CREATE TRIGGER statements are not statement separators. Empty
+// statements and statements containing only comments are dropped. An unterminated
+// string literal, quoted identifier or comment is an error.
+func CmdsFromSQL(script string) ([]SQLCommand, error) {
+	var cmds []SQLCommand
+	start := 0       // start of the current statement
+	hasCode := false // the current statement has some non comment content
+	first := ""      // first word of the current statement
+	trigger := false // the current statement creates a trigger
+	depth := 0       // BEGIN...END nesting depth in a trigger body
+	emit := func(end int) {
+		if hasCode {
+			cmds = append(cmds, Cmd(strings.TrimSpace(script[start:end])))
+		}
+		start, hasCode, first, trigger, depth = end+1, false, "", false, 0
+	}
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quoteEnd(script, i)
+			if end < 0 {
+				return nil, fmt.Errorf("cmds from sql: %w: unterminated %c quote at offset %d", ErrBadParameters, c, i)
+			}
+			hasCode = true
+			i = end
+		case strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("cmds from sql: %w: unterminated comment at offset %d", ErrBadParameters, i)
+			}
+			i += end + 4
+		case c == '$' && dollarQuoteTag.MatchString(script[i:]):
+			tag := dollarQuoteTag.FindString(script[i:])
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("cmds from sql: %w: unterminated %s quote at offset %d", ErrBadParameters, tag, i)
+			}
+			hasCode = true
+			i += len(tag) + end + len(tag)
+		case isWordByte(c):
+			end := i + 1
+			for end < len(script) && isWordByte(script[end]) {
+				end++
+			}
+			word := strings.ToUpper(script[i:end])
+			if first == "" {
+				first = word
+			}
+			switch {
+			case word == "TRIGGER" && first == "CREATE":
+				trigger = true
+			case trigger && (word == "BEGIN" || word == "CASE"):
+				depth++
+			case trigger && word == "END" && depth > 0:
+				depth--
+			}
+			hasCode = true
+			i = end
+		case c == ';' && depth == 0:
+			emit(i)
+			i++
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasCode = true
+			}
+			i++
+		}
+	}
+	emit(len(script))
+	return cmds, nil
+}
+
+// quoteEnd returns the offset following the closing quote of the quoted string starting
+// at offset i, or -1 if it is not terminated. A doubled quote is an escaped quote.
+func quoteEnd(s string, i int) int {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == q {
+			if j+1 < len(s) && s[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// isWordByte returns true if c may be part of an SQL keyword or identifier.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCmdsFromSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		exp    []string
+	}{
+		{
+			name:   "simple",
+			script: "CREATE TABLE a (id INTEGER);\nINSERT INTO a VALUES (1);",
+			exp:    []string{"CREATE TABLE a (id INTEGER)", "INSERT INTO a VALUES (1)"},
+		},
+		{
+			name:   "trailing whitespace",
+			script: "SELECT 1;  \n\t\n",
+			exp:    []string{"SELECT 1"},
+		},
+		{
+			name:   "no final semicolon",
+			script: "SELECT 1; SELECT 2",
+			exp:    []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "string literal",
+			script: `INSERT INTO a VALUES ('x;y', 'it''s;');SELECT "a;b" FROM ` + "`c;d`;",
+			exp:    []string{`INSERT INTO a VALUES ('x;y', 'it''s;')`, `SELECT "a;b" FROM ` + "`c;d`"},
+		},
+		{
+			name:   "comments",
+			script: "-- first; comment\nSELECT 1; /* block; comment */ SELECT 2;\n-- only a comment;\n/* another */;",
+			exp:    []string{"-- first; comment\nSELECT 1", "/* block; comment */ SELECT 2"},
+		},
+		{
+			name: "trigger",
+			script: `CREATE TRIGGER t AFTER INSERT ON a BEGIN
+	UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;
+	DELETE FROM c;
+END;
+BEGIN;
+SELECT 1;`,
+			exp: []string{`CREATE TRIGGER t AFTER INSERT ON a BEGIN
+	UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;
+	DELETE FROM c;
+END`, "BEGIN", "SELECT 1"},
+		},
+		{
+			name:   "dollar quote",
+			script: "CREATE FUNCTION f() RETURNS INTEGER AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql; SELECT $1;",
+			exp:    []string{"CREATE FUNCTION f() RETURNS INTEGER AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql", "SELECT $1"},
+		},
+		{
+			name:   "empty",
+			script: " ;; \n",
+			exp:    nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmds, err := CmdsFromSQL(test.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, cmd := range cmds {
+				if len(cmd.Args) != 0 {
+					t.Fatalf("unexpected args %v", cmd.Args)
+				}
+				got = append(got, cmd.Cmd)
+			}
+			if !slices.Equal(got, test.exp) {
+				t.Fatalf("expect %q, got %q", test.exp, got)
+			}
+		})
+	}
+
+	for _, script := range []string{"SELECT 'abc;", `SELECT "abc`, "SELECT 1 /* comment", "SELECT $$ abc;"} {
+		if _, err := CmdsFromSQL(script); !errors.Is(err, ErrBadParameters) {
+			t.Fatalf("expect %v for %q, got %v", ErrBadParameters, script, err)
+		}
+	}
+}
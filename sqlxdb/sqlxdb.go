@@ -0,0 +1,60 @@
+// Package sqlxdb adapts an sqlx database to a migrate SQLDB so that the step functions
+// may use the sqlx extensions, like named parameter queries.
+package sqlxdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/chmike/migrate"
+	"github.com/jmoiron/sqlx"
+)
+
+// sqlxDB is an SQLDB starting its transactions with sqlx.
+type sqlxDB struct {
+	migrate.SQLDB
+	xdb *sqlx.DB
+}
+
+// sqlxTx is an SQLTx holding the sqlx transaction.
+type sqlxTx struct {
+	migrate.SQLTx
+	xtx *sqlx.Tx
+}
+
+// New returns an SQLDB using the sqlx database xdb and the database specific queries q.
+// The version table is managed by the standard SQLDB operations.
+func New(xdb *sqlx.DB, q *migrate.Queries) migrate.SQLDB {
+	return &sqlxDB{SQLDB: migrate.NewSQLDB(xdb.DB, q), xdb: xdb}
+}
+
+// StartTransaction starts an sqlx transaction. It must be followed by a defer
+// FinalizeTransaction.
+func (db *sqlxDB) StartTransaction(ctx context.Context, opts *sql.TxOptions) (migrate.SQLTx, error) {
+	xtx, err := db.xdb.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", migrate.ErrBeginTx, err)
+	}
+	return &sqlxTx{SQLTx: migrate.NewSQLTx(ctx, xtx.Tx), xtx: xtx}, nil
+}
+
+// TxFunc is a user provided function called with the sqlx transaction of the migration
+// step.
+type TxFunc func(tx *sqlx.Tx, info migrate.StepInfo, dryRun bool, log migrate.Logger) error
+
+// TxF returns a migration step function like migrate.TxF that calls the user functions
+// with the sqlx transaction of the migration step. The database must be created with New.
+func TxF(fs ...TxFunc) migrate.StepFunc {
+	txfs := make([]migrate.TxFunc, len(fs))
+	for i, f := range fs {
+		txfs[i] = func(tx migrate.SQLTx, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+			xtx, ok := tx.(*sqlxTx)
+			if !ok {
+				return fmt.Errorf("sqlx txf: %w", migrate.ErrNotSQLDB)
+			}
+			return f(xtx.xtx, info, dryRun, log)
+		}
+	}
+	return migrate.TxF(txfs...)
+}
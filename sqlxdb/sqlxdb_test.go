@@ -0,0 +1,88 @@
+package sqlxdb
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/chmike/migrate"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var queries = migrate.Queries{
+	CreateTableQuery: `CREATE TABLE "migrate_version" ("id" INTEGER NOT NULL, "checksum" TEXT NOT NULL)`,
+	InitTableQuery:   `INSERT INTO "migrate_version" ("id", "checksum") VALUES (?, ?)`,
+	VersionQuery:     `SELECT "id", "checksum" FROM "migrate_version" LIMIT 1`,
+	SetVersionQuery:  `UPDATE "migrate_version" SET "id" = ?, "checksum" = ? WHERE "id" = ? AND "checksum" = ?`,
+}
+
+type book struct {
+	Title string `db:"title"`
+}
+
+func TestSqlxDB(t *testing.T) {
+	xdb, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xdb.Close()
+	q := queries
+	db := New(xdb, &q)
+
+	s := migrate.NewSteps("books")
+	s.Append("create books",
+		migrate.Tx(migrate.Cmd(`CREATE TABLE "book" ("title" TEXT NOT NULL)`)),
+		migrate.Tx(migrate.Cmd(`DROP TABLE "book"`)),
+	)
+	s.Append("insert books",
+		TxF(func(tx *sqlx.Tx, info migrate.StepInfo, dryRun bool, log migrate.Logger) error {
+			_, err := tx.NamedExec(`INSERT INTO "book" ("title") VALUES (:title)`, []book{{"Go"}, {"SQL"}})
+			return err
+		}),
+		migrate.Tx(migrate.Cmd(`DELETE FROM "book"`)),
+	)
+	m, err := migrate.New(db, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUp(); err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	if err := xdb.Select(&titles, `SELECT "title" FROM "book" ORDER BY "title"`); err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 2 || titles[0] != "Go" || titles[1] != "SQL" {
+		t.Fatalf("unexpected titles %q", titles)
+	}
+
+	if err := m.OneDownDryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllDown(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Version(); err != nil || v.ID != 0 {
+		t.Fatalf("expect v0, got %v, %v", v, err)
+	}
+
+	f := TxF(func(tx *sqlx.Tx, info migrate.StepInfo, dryRun bool, log migrate.Logger) error { return nil })
+	v0, _ := s.Version(0)
+	v1, _ := s.Version(1)
+	other := migrate.NewSQLDB(xdb.DB, &q)
+	err = f(t.Context(), other, &stepInfo{v0, v1}, false, migrate.NewNilLogger())
+	if !errors.Is(err, migrate.ErrNotSQLDB) {
+		t.Fatalf("expect %v, got %v", migrate.ErrNotSQLDB, err)
+	}
+}
+
+type stepInfo struct{ from, to migrate.Version }
+
+func (s *stepInfo) Name() string          { return "test" }
+func (s *stepInfo) From() migrate.Version { return s.from }
+func (s *stepInfo) To() migrate.Version   { return s.to }
+func (s *stepInfo) String() string        { return "test" }
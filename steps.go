@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
 )
@@ -23,21 +24,61 @@ func (s *stepInfo) String() string { return fmt.Sprintf("'%s' %v -> %v", s.name,
 // Step is a migration step with its Up and Down operations.
 type step struct {
 	name    string   // name is the step name.
+	content []byte   // content is the step content folded in the checksum.
 	up      StepFunc // up is executed to migrate on step up to this version.
 	down    StepFunc // down is executed to to migrate one step down to the version below.
 	version Version  // version is version of this migration step.
+	tags    []string // tags are the labels of the step given with Tag.
 }
 
 // Steps is a read only sequence of migration steps.
 type Steps struct {
-	mu    sync.RWMutex
-	steps []step
+	mu       sync.RWMutex
+	steps    []step
+	checksum ChecksumFunc
+	unique   bool // unique is true when the step names must be unique.
+	size     int  // size is the number of significant bytes of the checksums.
+}
+
+// ChecksumFunc computes the checksum of the step ID from the checksum of the previous
+// step, the step name and the step content given to AppendWithContent.
+type ChecksumFunc func(prev [32]byte, ID int, name string, content []byte) [32]byte
+
+// DefaultChecksum is the default checksum function. It is the SHA-256 of the previous
+// checksum, the ID as a little endian uint64 and the name. The content is ignored.
+func DefaultChecksum(prev [32]byte, ID int, name string, content []byte) [32]byte {
+	var b []byte
+	b = append(b, prev[:]...)
+	b = binary.LittleEndian.AppendUint64(b, uint64(ID))
+	b = append(b, name...)
+	return sha256.Sum256(b)
+}
+
+// ContentChecksum is a checksum function like DefaultChecksum that also folds the step
+// content in the checksum so that a change of the content is detected.
+func ContentChecksum(prev [32]byte, ID int, name string, content []byte) [32]byte {
+	var b []byte
+	b = append(b, prev[:]...)
+	b = binary.LittleEndian.AppendUint64(b, uint64(ID))
+	b = append(b, name...)
+	b = append(b, content...)
+	return sha256.Sum256(b)
 }
 
 // NewSteps instantiates a new migration step sequence. The name should not be
 // empty and ideally unique to the database as it is used to compute the root
 // checksum identifying the database.
 func NewSteps(name string) *Steps {
+	return NewStepsWith(name, DefaultChecksum)
+}
+
+// NewStepsWith instantiates a new migration step sequence using the checksum function
+// fn, or DefaultChecksum if nil. Changing the checksum function of the migration steps
+// of a database changes the checksums and invalidates the version stored in the database.
+func NewStepsWith(name string, fn ChecksumFunc) *Steps {
+	if fn == nil {
+		fn = DefaultChecksum
+	}
 	return &Steps{
 		steps: []step{
 			{
@@ -47,31 +88,152 @@ func NewSteps(name string) *Steps {
 				},
 			},
 		},
+		checksum: fn,
+	}
+}
+
+// SetUniqueNames sets whether Append and AppendWithContent return ErrDuplicateName when
+// the name of the appended step is already used by another step. Step names are not
+// required to be unique by default.
+func (s *Steps) SetUniqueNames(unique bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unique = unique
+}
+
+// SetChecksumSize keeps only the first size bytes of the checksums of the steps and sets
+// the others to zero, so that they match the checksums stored in a version table with a
+// Queries.ChecksumSize of size bytes, like 16 for the MD5 digests of another tool. The
+// checksums of the steps already appended are recomputed. The size is 32 when out of the
+// range 1 to 32.
+func (s *Steps) SetChecksumSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = size
+	s.steps[0].version.Checksum = s.rootChecksum()
+	for ID := 1; ID < len(s.steps); ID++ {
+		st := &s.steps[ID]
+		st.version.Checksum = s.stepChecksum(s.steps[ID-1].version.Checksum, ID, st.name, st.content)
+	}
+}
+
+// rootChecksum returns the checksum of the root step with ID 0.
+func (s *Steps) rootChecksum() [32]byte {
+	return s.truncateChecksum(sha256.Sum256([]byte(s.steps[0].name)))
+}
+
+// stepChecksum returns the checksum of the step ID computed with the checksum function.
+func (s *Steps) stepChecksum(prev [32]byte, ID int, name string, content []byte) [32]byte {
+	return s.truncateChecksum(s.checksum(prev, ID, name, content))
+}
+
+// truncateChecksum sets to zero the bytes of checksum beyond the checksum size.
+func (s *Steps) truncateChecksum(checksum [32]byte) [32]byte {
+	if s.size > 0 && s.size < len(checksum) {
+		clear(checksum[s.size:])
 	}
+	return checksum
 }
 
 // Append appends a new migration step to the list. Name must not be empty as it
-// is used to compute a checksum. The functions up or down may be nil.
-func (s *Steps) Append(name string, up StepFunc, down StepFunc) error {
+// is used to compute a checksum. The functions up or down may be nil. The options,
+// like Tag, set optional properties of the step.
+func (s *Steps) Append(name string, up StepFunc, down StepFunc, opts ...StepOption) error {
+	return s.AppendWithContent(name, nil, up, down, opts...)
+}
+
+// AppendWithContent appends a new migration step to the list like Append. The content,
+// typically the SQL commands of the step, is given to the checksum function.
+func (s *Steps) AppendWithContent(name string, content []byte, up StepFunc, down StepFunc, opts ...StepOption) error {
+	return s.appendStep(name, content, up, down, nil, opts)
+}
+
+// AppendRaw appends a new migration step to the list like Append after verifying that
+// its version is the given version. It returns an error wrapping ErrBadVersionID or
+// ErrBadVersionChecksum, and doesn't append the step, when they differ. It allows to
+// verify that the steps imported from another system match their recorded versions.
+func (s *Steps) AppendRaw(name string, up StepFunc, down StepFunc, version Version) error {
+	return s.appendStep(name, nil, up, down, &version, nil)
+}
+
+// appendStep appends a new migration step to the list. When expect is not nil, the step is
+// appended only if its version is expect.
+func (s *Steps) appendStep(name string, content []byte, up StepFunc, down StepFunc, expect *Version, opts []StepOption) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if name == "" {
 		return fmt.Errorf("append step: name is empty")
 	}
+	if s.unique {
+		for ID, st := range s.steps[1:] {
+			if st.name == name {
+				return fmt.Errorf("append step: %w: '%s' used by step %d", ErrDuplicateName, name, ID+1)
+			}
+		}
+	}
 	ID := len(s.steps)
-	var b []byte
-	b = append(b, s.steps[ID-1].version.Checksum[:]...)
-	b = binary.LittleEndian.AppendUint64(b, uint64(ID))
-	b = append(b, name...)
-	s.steps = append(s.steps, step{
+	st := step{
 		name:    name,
+		content: content,
 		up:      up,
 		down:    down,
-		version: Version{ID: ID, Checksum: sha256.Sum256(b)},
-	})
+		version: Version{ID: ID, Checksum: s.stepChecksum(s.steps[ID-1].version.Checksum, ID, name, content)},
+	}
+	if expect != nil {
+		switch {
+		case expect.ID != ID:
+			return fmt.Errorf("append step: %w: '%s' is step %d, not %d", ErrBadVersionID, name, ID, expect.ID)
+		case expect.Checksum != st.version.Checksum:
+			return fmt.Errorf("append step: %w: '%s' is %v, not %v", ErrBadVersionChecksum, name, st.version, *expect)
+		}
+	}
+	for _, opt := range opts {
+		opt(&st)
+	}
+	s.steps = append(s.steps, st)
 	return nil
 }
 
+// Validate checks the migration steps without a database. It recomputes the checksum
+// chain from the root name and reports the steps whose checksum doesn't match with
+// ErrBadVersionChecksum, and the steps having an up function without a down function
+// with ErrMissingDown. It returns all the problems found as a joined error.
+func (s *Steps) Validate() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var errs []error
+	checksum := s.rootChecksum()
+	for ID, st := range s.steps {
+		if ID > 0 {
+			checksum = s.stepChecksum(checksum, ID, st.name, st.content)
+		}
+		if st.version.ID != ID || st.version.Checksum != checksum {
+			errs = append(errs, fmt.Errorf("%w: step %d '%s'", ErrBadVersionChecksum, ID, st.name))
+		}
+		if st.up != nil && st.down == nil {
+			errs = append(errs, fmt.Errorf("%w: step %d '%s'", ErrMissingDown, ID, st.name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckUnique returns ErrDuplicateChecksum with the IDs of the colliding steps if two
+// steps have the same checksum.
+func (s *Steps) CheckUnique() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var errs []error
+	ids := make(map[[32]byte]int, len(s.steps))
+	for ID, st := range s.steps {
+		if prevID, ok := ids[st.version.Checksum]; ok {
+			errs = append(errs, fmt.Errorf("%w: steps %d and %d", ErrDuplicateChecksum, prevID, ID))
+			continue
+		}
+		ids[st.version.Checksum] = ID
+	}
+	return errors.Join(errs...)
+}
+
 // Len returns the number of Steps.
 func (s *Steps) Len() int {
 	s.mu.RLock()
@@ -115,6 +277,43 @@ func (s *Steps) Name(ID int) (name string, err error) {
 	return s.steps[ID].name, nil
 }
 
+// StepMeta describes a migration step.
+type StepMeta struct {
+	ID      int     // ID is the step ID.
+	Name    string  // Name is the step name.
+	Version Version // Version is the database version after the step.
+}
+
+// All returns the description of all the migration steps, starting with the root step
+// with ID 0 whose name is the name passed to NewSteps. The description is a consistent
+// snapshot of the steps.
+func (s *Steps) All() []StepMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make([]StepMeta, len(s.steps))
+	for ID, st := range s.steps {
+		all[ID] = StepMeta{ID: ID, Name: st.name, Version: st.version}
+	}
+	return all
+}
+
+// Truncate returns a new migration step sequence with the n first steps of s, the root
+// step with ID 0 included, so that its Len is n. The steps keep their checksum and the
+// versions of a database migrated with s up to step n-1 are valid for the returned
+// steps. It is intended to test an older version of the application against a newer
+// database. The value n is clamped to the range 1 to Len.
+func (s *Steps) Truncate(n int) *Steps {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n = max(1, min(n, len(s.steps)))
+	return &Steps{
+		steps:    append([]step(nil), s.steps[:n]...),
+		checksum: s.checksum,
+		unique:   s.unique,
+		size:     s.size,
+	}
+}
+
 // Check returns an error if the version is invalid.
 func (s *Steps) check(v Version) error {
 	if err := s.checkID(v.ID); err != nil {
@@ -175,3 +374,86 @@ func (s *Steps) Down(v Version) (nfo StepInfo, f StepFunc, err error) {
 	to := &s.steps[v.ID-1]
 	return &stepInfo{from: from.version, to: to.version, name: from.name}, from.down, nil
 }
+
+// loggingStepper is a Stepper logging every call to the wrapped Stepper.
+type loggingStepper struct {
+	s   Stepper
+	log Logger
+}
+
+// LoggingStepper returns a Stepper delegating all calls to s and logging each call
+// with its result at the debug level. It helps understanding how migration steps are
+// resolved by a Stepper.
+func LoggingStepper(s Stepper, log Logger) Stepper {
+	if log == nil {
+		log = NewNilLogger()
+	}
+	return &loggingStepper{s: s, log: log}
+}
+
+// Unwrap returns the wrapped Stepper.
+func (l *loggingStepper) Unwrap() Stepper {
+	return l.s
+}
+
+// Len returns the number of steps.
+func (l *loggingStepper) Len() int {
+	n := l.s.Len()
+	l.log.Debug("stepper len", F("len", n))
+	return n
+}
+
+// Version returns the version of step ID.
+func (l *loggingStepper) Version(ID int) (Version, error) {
+	v, err := l.s.Version(ID)
+	if err != nil {
+		l.log.Debug("stepper version", F("id", ID), F("error", err.Error()))
+	} else {
+		l.log.Debug("stepper version", F("id", ID), F("version", v))
+	}
+	return v, err
+}
+
+// Name returns the migration step name.
+func (l *loggingStepper) Name(ID int) (string, error) {
+	name, err := l.s.Name(ID)
+	if err != nil {
+		l.log.Debug("stepper name", F("id", ID), F("error", err.Error()))
+	} else {
+		l.log.Debug("stepper name", F("id", ID), F("name", name))
+	}
+	return name, err
+}
+
+// Check returns an error if the given version is invalid.
+func (l *loggingStepper) Check(v Version) error {
+	err := l.s.Check(v)
+	if err != nil {
+		l.log.Debug("stepper check", F("version", v), F("error", err.Error()))
+	} else {
+		l.log.Debug("stepper check", F("version", v))
+	}
+	return err
+}
+
+// Up returns the StepInfo and function for one step up migration.
+func (l *loggingStepper) Up(v Version) (StepInfo, StepFunc, error) {
+	info, f, err := l.s.Up(v)
+	if err != nil {
+		l.log.Debug("stepper up", F("version", v), F("error", err.Error()))
+	} else {
+		l.log.Debug("stepper up", F("version", v), F("step", info), F("nilFunc", f == nil))
+	}
+	return info, f, err
+}
+
+// Down returns the StepInfo and function for one step down migration.
+func (l *loggingStepper) Down(v Version) (StepInfo, StepFunc, error) {
+	info, f, err := l.s.Down(v)
+	if err != nil {
+		l.log.Debug("stepper down", F("version", v), F("error", err.Error()))
+	} else {
+		l.log.Debug("stepper down", F("version", v), F("step", info), F("nilFunc", f == nil))
+	}
+	return info, f, err
+}
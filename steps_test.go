@@ -1,11 +1,15 @@
 package migrate
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -85,6 +89,33 @@ func TestSteps_Append(t *testing.T) {
 	}
 }
 
+// TestSteps_UniqueNames tests the rejection of duplicate step names
+func TestSteps_UniqueNames(t *testing.T) {
+	steps := NewSteps("test-db")
+	if err := steps.Append("step1", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := steps.Append("step1", nil, nil); err != nil {
+		t.Fatalf("Unexpected error on permissive append: %v", err)
+	}
+
+	steps = NewSteps("test-db")
+	steps.SetUniqueNames(true)
+	if err := steps.Append("test-db", nil, nil); err != nil {
+		t.Fatalf("Unexpected error on append: %v", err)
+	}
+	if err := steps.Append("step1", nil, nil); err != nil {
+		t.Fatalf("Unexpected error on append: %v", err)
+	}
+	err := steps.AppendWithContent("step1", []byte("content"), nil, nil)
+	if !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("Expected %v, got %v", ErrDuplicateName, err)
+	}
+	if steps.Len() != 3 {
+		t.Errorf("Expected 3 steps, got %d", steps.Len())
+	}
+}
+
 // TestSteps_Len tests the Len method of Steps
 func TestSteps_Len(t *testing.T) {
 	// Setup
@@ -105,6 +136,61 @@ func TestSteps_Len(t *testing.T) {
 }
 
 // TestSteps_Version tests the Version method of Steps
+func TestSteps_All(t *testing.T) {
+	s := NewSteps("test")
+	_ = s.Append("step 1", nil, nil)
+	_ = s.Append("step 2", nil, nil)
+	all := s.All()
+	if len(all) != 3 {
+		t.Fatalf("expect 3 steps, got %d", len(all))
+	}
+	for ID, step := range all {
+		name, _ := s.Name(ID)
+		v, _ := s.Version(ID)
+		if exp := (StepMeta{ID: ID, Name: name, Version: v}); step != exp {
+			t.Fatalf("expect %+v, got %+v", exp, step)
+		}
+	}
+}
+
+func TestSteps_Truncate(t *testing.T) {
+	s := NewSteps("test")
+	_ = s.Append("step 1", nil, nil)
+	_ = s.Append("step 2", nil, nil)
+	_ = s.Append("step 3", nil, nil)
+	tr := s.Truncate(3)
+	if tr.Len() != 3 {
+		t.Fatalf("expect 3 steps, got %d", tr.Len())
+	}
+	if exp := s.All()[:3]; !slices.Equal(tr.All(), exp) {
+		t.Fatalf("expect %v, got %v", exp, tr.All())
+	}
+	v2, _ := s.Version(2)
+	if err := tr.Check(v2); err != nil {
+		t.Fatal(err)
+	}
+	v3, _ := s.Version(3)
+	if err := tr.Check(v3); !errors.Is(err, ErrBadVersionID) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionID, err)
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	_ = tr.Append("step 3", nil, nil)
+	if v, _ := tr.Version(3); v != v3 {
+		t.Fatalf("expect %v, got %v", v3, v)
+	}
+	if s.Len() != 4 {
+		t.Fatalf("expect 4 steps, got %d", s.Len())
+	}
+	if n := s.Truncate(0).Len(); n != 1 {
+		t.Fatalf("expect 1 step, got %d", n)
+	}
+	if n := s.Truncate(10).Len(); n != 4 {
+		t.Fatalf("expect 4 steps, got %d", n)
+	}
+}
+
 func TestSteps_Version(t *testing.T) {
 	// Setup
 	steps := NewSteps("test-db")
@@ -316,3 +402,193 @@ func TestSteps_Concurrency(t *testing.T) {
 
 	// If we get here without a deadlock or panic, the test passes
 }
+
+// TestLoggingStepper tests that the logging stepper logs the step resolutions
+func TestLoggingStepper(t *testing.T) {
+	steps := NewSteps("test-db")
+	_ = steps.Append("step1", nil, nil)
+
+	var buf bytes.Buffer
+	s := LoggingStepper(steps, NewLogLoggerWith(log.New(&buf, "", 0), LevelDebug))
+
+	if s.Len() != 2 {
+		t.Fatalf("expect 2, got %d", s.Len())
+	}
+	v0, err := s.Version(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(v0); err != nil {
+		t.Fatal(err)
+	}
+	info, _, err := s.Up(v0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "[DEBUG] stepper up | version='v0:0f3182d0b4...' step=''step1' v0:0f3182d0b4... -> v1:b4d9cdaf09...' nilFunc='true'"; !strings.Contains(buf.String(), exp) {
+		t.Fatalf("expect %q in %q", exp, buf.String())
+	}
+
+	buf.Reset()
+	if _, _, err := s.Up(info.To()); !errors.Is(err, ErrEndOfSteps) {
+		t.Fatalf("expect %v, got %v", ErrEndOfSteps, err)
+	}
+	if exp := "[DEBUG] stepper up | version='v1:b4d9cdaf09...' error='end of steps: v1:b4d9cdaf09...'"; !strings.Contains(buf.String(), exp) {
+		t.Fatalf("expect %q in %q", exp, buf.String())
+	}
+
+	buf.Reset()
+	if _, _, err := s.Down(v0); !errors.Is(err, ErrEndOfSteps) {
+		t.Fatalf("expect %v, got %v", ErrEndOfSteps, err)
+	}
+	if _, _, err := s.Down(info.To()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Name(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Name(5); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := s.Version(5); err == nil {
+		t.Fatal("expect error")
+	}
+	if err := s.Check(Version{ID: 5}); err == nil {
+		t.Fatal("expect error")
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 6 {
+		t.Fatalf("expect 6 log lines, got %d in %q", n, buf.String())
+	}
+}
+
+func TestSteps_Validate(t *testing.T) {
+	s := NewSteps("test")
+	s.Append("step 1", mockFunc, mockFunc)
+	s.Append("step 2", nil, nil)
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.Append("step 3", mockFunc, nil)
+	s.Append("step 4", mockFunc, mockFunc)
+	s.steps[2].version.Checksum[0]++
+	err := s.Validate()
+	if !errors.Is(err, ErrMissingDown) || !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v and %v, got %v", ErrMissingDown, ErrBadVersionChecksum, err)
+	}
+	exp := "bad version checksum: step 2 'step 2'\nmissing down function: step 3 'step 3'"
+	if err.Error() != exp {
+		t.Fatalf("expect %q, got %q", exp, err)
+	}
+}
+
+func TestSteps_CheckUnique(t *testing.T) {
+	s := NewSteps("test")
+	s.Append("step 1", nil, nil)
+	s.Append("step 1", nil, nil)
+	s.Append("step 3", nil, nil)
+	if err := s.CheckUnique(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.steps[3].version.Checksum = s.steps[1].version.Checksum
+	err := s.CheckUnique()
+	if !errors.Is(err, ErrDuplicateChecksum) {
+		t.Fatalf("expect %v, got %v", ErrDuplicateChecksum, err)
+	}
+	if exp := "duplicate checksum: steps 1 and 3"; err.Error() != exp {
+		t.Fatalf("expect %q, got %q", exp, err)
+	}
+}
+
+func TestNewStepsWith(t *testing.T) {
+	s1 := NewSteps("test-db")
+	s2 := NewStepsWith("test-db", nil)
+	s3 := NewStepsWith("test-db", ContentChecksum)
+	for _, s := range []*Steps{s1, s2, s3} {
+		if err := s.AppendWithContent("step 1", []byte(`CREATE TABLE "test" ("id" INTEGER)`), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v1, _ := s1.Version(1)
+	v2, _ := s2.Version(1)
+	v3, _ := s3.Version(1)
+	if v1 != v2 {
+		t.Fatalf("expect %v, got %v", v1, v2)
+	}
+	if v1 == v3 {
+		t.Fatalf("expect content in checksum, got %v", v3)
+	}
+
+	s4 := NewStepsWith("test-db", ContentChecksum)
+	s4.AppendWithContent("step 1", []byte(`CREATE TABLE "test" ("id" TEXT)`), nil, nil)
+	if v4, _ := s4.Version(1); v4 == v3 {
+		t.Fatalf("expect different checksums, got %v", v4)
+	}
+	if err := s4.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s4.AppendWithContent("", nil, nil, nil); err == nil {
+		t.Fatal("expect error")
+	}
+}
+
+func TestSteps_SetChecksumSize(t *testing.T) {
+	s := NewSteps("test")
+	s.Append("step 1", nil, nil)
+	s.SetChecksumSize(16)
+	s.Append("step 2", nil, nil)
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for ID := range s.Len() {
+		v, _ := s.Version(ID)
+		if [16]byte(v.Checksum[16:]) != [16]byte{} {
+			t.Fatalf("unexpected checksum %x of step %d", v.Checksum, ID)
+		}
+	}
+
+	o := NewSteps("test")
+	o.Append("step 1", nil, nil)
+	o.Append("step 2", nil, nil)
+	v2, _ := o.Version(2)
+	o.SetChecksumSize(16)
+	if v, _ := o.Version(2); v == v2 {
+		t.Fatal("expect checksum change")
+	}
+	if v, _ := s.Version(2); v != o.steps[2].version {
+		t.Fatalf("expect %v, got %v", o.steps[2].version, v)
+	}
+	o.SetChecksumSize(0)
+	if v, _ := o.Version(2); v != v2 {
+		t.Fatalf("expect %v, got %v", v2, v)
+	}
+}
+
+func TestSteps_AppendRaw(t *testing.T) {
+	ref := NewSteps("test")
+	ref.Append("step 1", nil, nil)
+	ref.Append("step 2", nil, nil)
+	v1, _ := ref.Version(1)
+	v2, _ := ref.Version(2)
+
+	s := NewSteps("test")
+	if err := s.AppendRaw("step 1", nil, nil, v1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendRaw("step 2", nil, nil, v1); !errors.Is(err, ErrBadVersionID) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionID, err)
+	}
+	if err := s.AppendRaw("step two", nil, nil, v2); !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionChecksum, err)
+	}
+	if s.Len() != 2 {
+		t.Fatalf("expect 2 steps, got %d", s.Len())
+	}
+	if err := s.AppendRaw("step 2", nil, nil, v2); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Version(2); v != v2 {
+		t.Fatalf("expect %v, got %v", v2, v)
+	}
+}
@@ -0,0 +1,164 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// sqlFileName matches the migration step file names NNN_name.up.sql and NNN_name.down.sql.
+var sqlFileName = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+
+// sqlFile is a pair of up and down migration step files.
+type sqlFile struct {
+	name string
+	up   string
+	down string
+}
+
+// StepsFromFS returns the migration steps defined by the files of the fsys root directory
+// named NNN_name.up.sql and NNN_name.down.sql. The steps are appended in the order of
+// their sequence number NNN which must start at 1 and have no gap or duplicate. The step
+// name is the name part of the file names and the SQL statements of the files, split
+// with CmdsFromSQL, are executed wrapped in a transaction with Tx. A missing down file results in a nil down function.
+// Files without the .sql extension are ignored.
+//
+// The name is the name passed to NewSteps. Renaming or reordering files changes the
+// checksums of the steps.
+func StepsFromFS(fsys fs.FS, name string) (*Steps, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("steps from fs: %w", err)
+	}
+	files := make(map[int]*sqlFile)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		m := sqlFileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("steps from fs: invalid file name '%s'", entry.Name())
+		}
+		ID, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("steps from fs: invalid file name '%s': %w", entry.Name(), err)
+		}
+		f := files[ID]
+		if f == nil {
+			f = &sqlFile{name: m[2]}
+			files[ID] = f
+		} else if f.name != m[2] {
+			return nil, fmt.Errorf("steps from fs: duplicate step number %d: '%s' and '%s'", ID, f.name, m[2])
+		}
+		if m[3] == "up" {
+			f.up = entry.Name()
+		} else {
+			f.down = entry.Name()
+		}
+	}
+
+	IDs := make([]int, 0, len(files))
+	for ID := range files {
+		IDs = append(IDs, ID)
+	}
+	sort.Ints(IDs)
+	s := NewSteps(name)
+	for i, ID := range IDs {
+		if ID != i+1 {
+			return nil, fmt.Errorf("steps from fs: expect step number %d, got %d", i+1, ID)
+		}
+		f := files[ID]
+		if f.up == "" {
+			return nil, fmt.Errorf("steps from fs: missing up file of step %d '%s'", ID, f.name)
+		}
+		up, err := readSQLFile(fsys, f.up)
+		if err != nil {
+			return nil, err
+		}
+		var down StepFunc
+		if f.down != "" {
+			if down, err = readSQLFile(fsys, f.down); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.Append(f.name, up, down); err != nil {
+			return nil, fmt.Errorf("steps from fs: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// readSQLFile returns a step function executing the SQL statements of the file in a
+// transaction.
+func readSQLFile(fsys fs.FS, name string) (StepFunc, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("steps from fs: %w", err)
+	}
+	cmds, err := CmdsFromSQL(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("steps from fs: %s: %w", name, err)
+	}
+	return Tx(cmds...), nil
+}
+
+// validFileStepName matches a step name usable in a migration step file name.
+var validFileStepName = regexp.MustCompile(`^[^\s/\\]+$`)
+
+// NewFile creates the empty migration step files NNN_name.up.sql and NNN_name.down.sql
+// in the directory dir and returns their path. The sequence number NNN follows the
+// highest sequence number of the migration step files in dir, or is 001 when there are
+// none. The name must not be empty or contain spaces or path separators.
+func NewFile(dir, name string) (upPath, downPath string, err error) {
+	if !validFileStepName.MatchString(name) {
+		return "", "", fmt.Errorf("new file: %w: invalid step name '%s'", ErrBadParameters, name)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("new file: %w", err)
+	}
+	ID := 0
+	for _, entry := range entries {
+		m := sqlFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(m[1]); err == nil && n > ID {
+			ID = n
+		}
+	}
+	ID++
+
+	prefix := fmt.Sprintf("%03d_%s", ID, name)
+	upPath = filepath.Join(dir, prefix+".up.sql")
+	downPath = filepath.Join(dir, prefix+".down.sql")
+	if err := createSQLFile(upPath, fmt.Sprintf("-- Migration step %d '%s' up.\n", ID, name)); err != nil {
+		return "", "", err
+	}
+	if err := createSQLFile(downPath, fmt.Sprintf("-- Migration step %d '%s' down.\n", ID, name)); err != nil {
+		return "", "", errors.Join(err, os.Remove(upPath))
+	}
+	return upPath, downPath, nil
+}
+
+// createSQLFile creates the file with the given content. It fails if the file exists.
+func createSQLFile(name, content string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("new file: %w", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return fmt.Errorf("new file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("new file: %w", err)
+	}
+	return nil
+}
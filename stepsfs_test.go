@@ -0,0 +1,132 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStepsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001_create_table.up.sql":   {Data: []byte(`CREATE TABLE "test" ("id" INTEGER);`)},
+		"001_create_table.down.sql": {Data: []byte(`DROP TABLE "test";`)},
+		"002_insert_row.up.sql":     {Data: []byte(`INSERT INTO "test" ("id") VALUES (1);`)},
+		"README.md":                 {Data: []byte(`ignored`)},
+	}
+	s, err := StepsFromFS(fsys, "test-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 3 {
+		t.Fatalf("expect 3 steps, got %d", s.Len())
+	}
+
+	exp := NewSteps("test-db")
+	_ = exp.Append("create_table", nil, nil)
+	_ = exp.Append("insert_row", nil, nil)
+	for ID := range 3 {
+		v, _ := s.Version(ID)
+		ev, _ := exp.Version(ID)
+		if v != ev {
+			t.Fatalf("step %d: expect %v, got %v", ID, ev, v)
+		}
+	}
+	if s.steps[1].up == nil || s.steps[1].down == nil {
+		t.Fatal("expect non-nil up and down functions of step 1")
+	}
+	if s.steps[2].up == nil || s.steps[2].down != nil {
+		t.Fatal("expect non-nil up and nil down functions of step 2")
+	}
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"gap", fstest.MapFS{
+			"001_a.up.sql": {Data: []byte(`SELECT 1`)},
+			"003_c.up.sql": {Data: []byte(`SELECT 1`)},
+		}},
+		{"duplicate", fstest.MapFS{
+			"001_a.up.sql": {Data: []byte(`SELECT 1`)},
+			"001_b.up.sql": {Data: []byte(`SELECT 1`)},
+		}},
+		{"not starting at 1", fstest.MapFS{
+			"000_a.up.sql": {Data: []byte(`SELECT 1`)},
+		}},
+		{"missing up", fstest.MapFS{
+			"001_a.down.sql": {Data: []byte(`SELECT 1`)},
+		}},
+		{"unterminated string", fstest.MapFS{
+			"001_a.up.sql": {Data: []byte(`SELECT 'a`)},
+		}},
+		{"invalid name", fstest.MapFS{
+			"a.up.sql": {Data: []byte(`SELECT 1`)},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := StepsFromFS(test.fsys, "test-db"); err == nil {
+				t.Fatal("expect error")
+			}
+		})
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	dir := t.TempDir()
+	upPath, downPath, err := NewFile(dir, "create_table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := filepath.Join(dir, "001_create_table.up.sql"); upPath != exp {
+		t.Fatalf("expect %q, got %q", exp, upPath)
+	}
+	if exp := filepath.Join(dir, "001_create_table.down.sql"); downPath != exp {
+		t.Fatalf("expect %q, got %q", exp, downPath)
+	}
+	b, err := os.ReadFile(upPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "--") {
+		t.Fatalf("expect header comment, got %q", b)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "009_other.up.sql"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if upPath, _, err = NewFile(dir, "insert_row"); err != nil {
+		t.Fatal(err)
+	}
+	if exp := filepath.Join(dir, "010_insert_row.up.sql"); upPath != exp {
+		t.Fatalf("expect %q, got %q", exp, upPath)
+	}
+	if err := os.Remove(filepath.Join(dir, "009_other.up.sql")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(upPath, filepath.Join(dir, "002_insert_row.up.sql")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "010_insert_row.down.sql"), filepath.Join(dir, "002_insert_row.down.sql")); err != nil {
+		t.Fatal(err)
+	}
+	s, err := StepsFromFS(os.DirFS(dir), "test-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 3 {
+		t.Fatalf("expect 3 steps, got %d", s.Len())
+	}
+
+	for _, name := range []string{"", "with space", "a/b", `a\b`} {
+		if _, _, err := NewFile(dir, name); !errors.Is(err, ErrBadParameters) {
+			t.Fatalf("name %q: expect %v, got %v", name, ErrBadParameters, err)
+		}
+	}
+	if _, _, err := NewFile(filepath.Join(dir, "missing"), "name"); err == nil {
+		t.Fatal("expect error")
+	}
+}
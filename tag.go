@@ -0,0 +1,183 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// StepOption is an option of a migration step given to Append.
+type StepOption func(*step)
+
+// Tag labels the migration step with tag, like the name of a subsystem. The tags are
+// used by AllUpTagged to apply only the steps of a subsystem. They are not folded in the
+// checksum of the step so that adding or removing a tag doesn't change the versions.
+func Tag(tag string) StepOption {
+	return func(st *step) {
+		st.tags = append(st.tags, tag)
+	}
+}
+
+// HasTag returns true when the step ID is labeled with tag.
+func (s *Steps) HasTag(ID int, tag string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.checkID(ID) != nil {
+		return false
+	}
+	return slices.Contains(s.steps[ID].tags, tag)
+}
+
+// tagger is a Stepper whose steps may be labeled with tags.
+type tagger interface {
+	HasTag(ID int, tag string) bool
+}
+
+// findTagger returns the stepper s, or the first stepper wrapped by s, like with
+// LoggingStepper, that may be labeled with tags.
+func findTagger(s Stepper) (tagger, bool) {
+	for {
+		if t, ok := s.(tagger); ok {
+			return t, true
+		}
+		u, ok := s.(interface{ Unwrap() Stepper })
+		if !ok {
+			return nil, false
+		}
+		s = u.Unwrap()
+	}
+}
+
+// SkipFilteredByTag is the reason of the steps skipped because they are not labeled with
+// the tag of AllUpTagged, PlanUpTagged or StatusTagged.
+const SkipFilteredByTag = "filtered by tag"
+
+// skipper is a Stepper whose up function of some steps only changes the version.
+type skipper interface {
+	// SkipReason returns the reason why the step ID is skipped, or an empty string.
+	SkipReason(ID int) string
+}
+
+// skipReason returns the reason why the step ID of s is skipped, or an empty string.
+func skipReason(s Stepper, ID int) string {
+	if sk, ok := s.(skipper); ok {
+		return sk.SkipReason(ID)
+	}
+	return ""
+}
+
+// taggedStepper is a Stepper replacing the up function of the steps without the tag
+// with a function only changing the version.
+type taggedStepper struct {
+	Stepper
+	tagger      tagger
+	tag         string
+	defaultStep StepFunc // step function set with WithDefaultStepFunc
+}
+
+func (s *taggedStepper) Up(v Version) (StepInfo, StepFunc, error) {
+	info, up, err := s.Stepper.Up(v)
+	if err == nil && s.SkipReason(info.To().ID) != "" {
+		up = s.versionOnly
+	}
+	return info, up, err
+}
+
+func (s *taggedStepper) SkipReason(ID int) string {
+	if s.tagger.HasTag(ID, s.tag) {
+		return ""
+	}
+	return SkipFilteredByTag
+}
+
+// versionOnly is the step function of the steps skipped by AllUpTagged. It only changes
+// the version with the step function set with WithDefaultStepFunc, or the
+// DefaultStepFunc of the database.
+func (s *taggedStepper) versionOnly(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+	log.Info("skipped step", F("name", info.Name()), F("from", info.From()), F("to", info.To()), F("reason", SkipFilteredByTag))
+	if s.defaultStep != nil {
+		return s.defaultStep(ctx, db, info, dryRun, log)
+	}
+	return db.DefaultStepFunc(ctx, info, dryRun, log)
+}
+
+// tagged calls f with the stepper replaced by a stepper skipping the steps not labeled
+// with tag, where t is the stepper. It requires that the migrator is locked.
+func (m *Migrator) tagged(t tagger, tag string, f func() error) error {
+	steps := m.steps
+	m.steps = &taggedStepper{Stepper: steps, tagger: t, tag: tag, defaultStep: m.defaultStep}
+	defer func() { m.steps = steps }()
+	return f()
+}
+
+// AllUpTagged executes all the migration steps up, but only executes the up function of
+// the steps labeled with tag.
+func (m *Migrator) AllUpTagged(tag string) error {
+	return m.AllUpTaggedCtx(context.Background(), tag)
+}
+
+// AllUpTaggedCtx executes all the migration steps up like AllUpCtx, but the steps that are
+// not labeled with tag only change the database version like a nil step function. It
+// allows to deploy the steps of a subsystem to its own database while keeping a single
+// ordered list of steps. The skipped steps are logged at the info level with the reason
+// SkipFilteredByTag.
+//
+// The versions, and thus the checksums, are the same as with AllUp. A skipped step is
+// recorded as applied and won't be executed by a later AllUp. A database must thus
+// always be migrated with the same tag. The stepper, or the stepper it wraps like with
+// LoggingStepper, must have a HasTag method like Steps.
+func (m *Migrator) AllUpTaggedCtx(ctx context.Context, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := findTagger(m.steps)
+	if !ok {
+		return m.setLastError(fmt.Errorf("all up tagged: %w: stepper without tags", ErrBadParameters))
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return m.setLastError(fmt.Errorf("all up tagged: %w", err))
+	}
+	return m.setLastError(unlock(m.tagged(t, tag, func() error { return m.allUp(ctx) })))
+}
+
+// PlanUpTagged returns the migration steps that AllUpTagged would execute.
+func (m *Migrator) PlanUpTagged(tag string) ([]PlannedStep, error) {
+	return m.PlanUpTaggedCtx(context.Background(), tag)
+}
+
+// PlanUpTaggedCtx returns the migration steps that AllUpTagged would execute like
+// PlanUpCtx. The steps not labeled with tag have the Skipped reason SkipFilteredByTag.
+func (m *Migrator) PlanUpTaggedCtx(ctx context.Context, tag string) (plan []PlannedStep, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := findTagger(m.steps)
+	if !ok {
+		return nil, fmt.Errorf("plan up tagged: %w: stepper without tags", ErrBadParameters)
+	}
+	err = m.tagged(t, tag, func() error {
+		plan, err = m.planUp(ctx)
+		return err
+	})
+	return plan, err
+}
+
+// StatusTagged returns the status of all migration steps as seen by AllUpTagged.
+func (m *Migrator) StatusTagged(tag string) ([]StepStatus, error) {
+	return m.StatusTaggedCtx(context.Background(), tag)
+}
+
+// StatusTaggedCtx returns the status of all migration steps like StatusCtx. The steps
+// not labeled with tag have the Skipped reason SkipFilteredByTag.
+func (m *Migrator) StatusTaggedCtx(ctx context.Context, tag string) (status []StepStatus, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := findTagger(m.steps)
+	if !ok {
+		return nil, fmt.Errorf("status tagged: %w: stepper without tags", ErrBadParameters)
+	}
+	err = m.tagged(t, tag, func() error {
+		status, err = m.status(ctx)
+		return err
+	})
+	return status, err
+}
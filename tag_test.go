@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMigratorAllUpTagged(t *testing.T) {
+	var ran []string
+	run := func(name string) StepFunc {
+		return func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+			ran = append(ran, name)
+			return db.DefaultStepFunc(ctx, info, dryRun, log)
+		}
+	}
+	steps := NewSteps("test")
+	if err := steps.Append("step 1", run("step 1"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := steps.Append("step 2", run("step 2"), nil, Tag("analytics")); err != nil {
+		t.Fatal(err)
+	}
+	if err := steps.Append("step 3", run("step 3"), nil, Tag("billing"), Tag("analytics")); err != nil {
+		t.Fatal(err)
+	}
+	if !steps.HasTag(3, "billing") || steps.HasTag(1, "analytics") || steps.HasTag(4, "analytics") {
+		t.Fatal("unexpected tags")
+	}
+	v3, err := steps.Version(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &mockDatabase{}
+	m, err := New(db, steps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUpTagged("analytics"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ran, []string{"step 2", "step 3"}) {
+		t.Fatalf("unexpected steps executed: %v", ran)
+	}
+	if db.version != v3 {
+		t.Fatalf("expect %v, got %v", v3, db.version)
+	}
+	if _, ok := m.steps.(*Steps); !ok {
+		t.Fatal("stepper not restored")
+	}
+
+	refuse := func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		return errMock
+	}
+	ran = nil
+	db = &mockDatabase{}
+	m, err = New(db, steps, nil, WithDefaultStepFunc(refuse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUpTagged("analytics"); !errors.Is(err, errMock) {
+		t.Fatalf("expect %v, got %v", errMock, err)
+	}
+	if len(ran) != 0 || db.version.ID != 0 {
+		t.Fatalf("expect v0 and no step executed, got %v and %v", db.version, ran)
+	}
+
+	m, err = New(&mockDatabase{}, &mockStepper{[]StepFunc{nil, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUpTagged("analytics"); !errors.Is(err, ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", ErrBadParameters, err)
+	}
+}
+
+func TestMigratorTaggedSkipReason(t *testing.T) {
+	steps := NewSteps("test")
+	steps.Append("step 1", mockFunc, nil)
+	steps.Append("step 2", mockFunc, nil, Tag("analytics"))
+	var buf bytes.Buffer
+	m, err := New(&mockDatabase{}, steps, NewLogLoggerWith(log.New(&buf, "", 0), LevelInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := m.StatusTagged("analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range []string{"", SkipFilteredByTag, ""} {
+		if status[i].Skipped != exp {
+			t.Fatalf("expect step %d skipped %q, got %q", i, exp, status[i].Skipped)
+		}
+	}
+	if !status[1].Transactional {
+		t.Fatal("expect skipped step to only change the version in a transaction")
+	}
+	if status, err := m.Status(); err != nil || status[1].Skipped != "" {
+		t.Fatalf("expect step not skipped, got %+v %v", status, err)
+	}
+
+	plan, err := m.PlanUpTagged("analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 2 || plan[0].Skipped != SkipFilteredByTag || plan[1].Skipped != "" {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if data, err := json.Marshal(plan[0]); err != nil || !strings.Contains(string(data), `"skipped":"filtered by tag"`) {
+		t.Fatalf("expect skipped reason in %s %v", data, err)
+	}
+
+	if err := m.AllUpTagged("analytics"); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "skipped step | name='step 1' from='v0:"; !strings.Contains(buf.String(), exp) || !strings.Contains(buf.String(), "reason='filtered by tag'") {
+		t.Fatalf("expect skip reason logged, got %q", buf.String())
+	}
+
+	m, err = New(&mockDatabase{}, &mockStepper{[]StepFunc{nil, mockFunc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.StatusTagged("analytics"); !errors.Is(err, ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", ErrBadParameters, err)
+	}
+	if _, err := m.PlanUpTagged("analytics"); !errors.Is(err, ErrBadParameters) {
+		t.Fatalf("expect %v, got %v", ErrBadParameters, err)
+	}
+}
+
+func TestMigratorAllUpTaggedLoggingStepper(t *testing.T) {
+	var ran []string
+	steps := NewSteps("test")
+	steps.Append("step 1", func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+		ran = append(ran, info.Name())
+		return db.DefaultStepFunc(ctx, info, dryRun, log)
+	}, nil, Tag("analytics"))
+	steps.Append("step 2", mockFunc, nil, Tag("billing"))
+	v2, _ := steps.Version(2)
+	var buf bytes.Buffer
+	logger := NewLogLoggerWith(log.New(&buf, "", 0), LevelDebug)
+	db := &mockDatabase{}
+	m, err := New(db, LoggingStepper(steps, logger), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllUpTagged("analytics"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ran, []string{"step 1"}) || db.version != v2 {
+		t.Fatalf("expect step 1 executed and %v, got %v and %v", v2, ran, db.version)
+	}
+	if !strings.Contains(buf.String(), "stepper up") {
+		t.Fatalf("expect stepper up logged, got %q", buf.String())
+	}
+}
@@ -12,11 +12,18 @@ import (
 // integrity that should be rolled back in case of error of if dryRun is true.
 type StepFunc func(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error
 
+// Irreversible is a step function returning ErrIrreversible. It is intended to be used as
+// the down function of a step that can't be undone, so that OneDown and AllDown fail
+// instead of changing the version without undoing anything.
+func Irreversible(ctx context.Context, db Database, info StepInfo, dryRun bool, log Logger) error {
+	return fmt.Errorf("%w: step '%s'", ErrIrreversible, info.Name())
+}
+
 // Database is the interface to a database.
 type Database interface {
 	// InitVersion initialize the version information. Returns ErrAlreadyInitialized
-	// if the database is already initialized. The ID of the given version MUST be 0.
-	// Leaves the database unchanged if dryRun is true.
+	// if the database is already initialized. The ID of the given version is 0, except
+	// for Baseline. Leaves the database unchanged if dryRun is true.
 	InitVersion(ctx context.Context, v Version, dryRun bool) error
 
 	// Version returns the current database version. Returns ErrNotInitialized if
@@ -78,6 +85,16 @@ type Stepper interface {
 	Down(Version) (StepInfo, StepFunc, error)
 }
 
+// Locker prevents concurrent migrations of a database by multiple migrators.
+type Locker interface {
+	// Lock acquires the migration lock. It returns ErrMigrationLocked if the lock
+	// is held by another migrator.
+	Lock(ctx context.Context) error
+
+	// Unlock releases the migration lock.
+	Unlock(ctx context.Context) error
+}
+
 // Migrater manages database migration steps.
 type Migrater interface {
 	// Init initializes the database version to v0 after verifying that it is not initialized.
@@ -130,6 +147,51 @@ type Queries struct {
 	// The first parameter is the version ID which is an integer and the second
 	// parameter is the checksum which is a 32 character string.
 	SetVersionQuery string // DB specific set version query.
+
+	// CommentTableQuery, when not empty, is executed by Init after CreateTableQuery to
+	// document the version table, like with a COMMENT ON TABLE.
+	CommentTableQuery string
+
+	// Extra, when not nil, provides the values of extra columns of the version table.
+	Extra *ExtraColumns
+
+	// BinaryChecksum is true when the checksum column is a binary column, like a BLOB
+	// or BYTEA, holding the 32 bytes of the checksum instead of its hexadecimal string.
+	BinaryChecksum bool
+
+	// ChecksumSize is the number of bytes of the checksum stored in the database, like 16
+	// for the MD5 digests of the version tables of other tools. Only the first bytes of
+	// the checksum are stored, so the steps must be given the same size with
+	// Steps.SetChecksumSize. It is 32 when zero.
+	ChecksumSize int
+
+	// TransactionalDDL is true when the database rolls back the schema changes of a
+	// transaction, so that the NoTx step functions may be executed in a transaction in
+	// a deep dry run.
+	TransactionalDDL bool
+
+	// CreateHistoryQuery is the query to create the history table if it doesn't exist.
+	// The history is disabled when it is empty.
+	CreateHistoryQuery string
+
+	// InsertHistoryQuery is the query to insert a row in the history table. The
+	// parameters are the from and to version IDs, the step name, the time of the change
+	// and the dry run flag. The history is disabled when it is empty.
+	InsertHistoryQuery string
+
+	// HistoryQuery is the query returning the rows of the history table ordered by id.
+	// The values are the id, the from and to version IDs, the step name, the time of
+	// the change and the dry run flag.
+	HistoryQuery string
+}
+
+// ExtraColumns provides the values of extra columns of the version table, like the time
+// of the change and the user performing it. The values are the first parameters of
+// InitTableQuery and SetVersionQuery, followed by the version parameters. The extra
+// columns are ignored by VersionQuery.
+type ExtraColumns struct {
+	// Args returns the values of the extra columns.
+	Args func() []any
 }
 
 // SQLTx is an sql database transaction handle.
@@ -186,4 +248,8 @@ type Logger interface {
 
 	// Level returns the log level.
 	Level() LogLevel
+
+	// With returns a child logger adding the fields to all its messages. The child
+	// logger has its own log level, initially the level of the logger.
+	With(fields ...Field) Logger
 }
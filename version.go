@@ -2,6 +2,7 @@ package migrate
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 )
 
@@ -19,6 +20,33 @@ func (v Version) ChecksumString() string {
 	return hex.EncodeToString(v.Checksum[:])
 }
 
+// versionJSON is the JSON encoding of a version.
+type versionJSON struct {
+	ID       int    `json:"id"`
+	Checksum string `json:"checksum"`
+}
+
+// MarshalJSON encodes the version as a JSON object with its id and the hexadecimal string
+// of its checksum.
+func (v Version) MarshalJSON() ([]byte, error) {
+	return json.Marshal(versionJSON{ID: v.ID, Checksum: v.ChecksumString()})
+}
+
+// UnmarshalJSON decodes a version encoded by MarshalJSON. It returns an error wrapping
+// ErrBadVersionID for a negative id, or ErrBadVersionChecksum for an invalid checksum.
+func (v *Version) UnmarshalJSON(b []byte) error {
+	var j versionJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	nv, err := MakeVersion(j.ID, j.Checksum)
+	if err != nil {
+		return err
+	}
+	*v = nv
+	return nil
+}
+
 // BadVersion represent an invalid version.
 var badVersion = Version{ID: -1}
 var BadVersion = badVersion
@@ -40,3 +68,33 @@ func MakeVersion(id int, checksum string) (Version, error) {
 	v.ID = id
 	return v, nil
 }
+
+// MakeVersionBytes make a version from an id and the bytes of the checksum.
+func MakeVersionBytes(id int, checksum []byte) (Version, error) {
+	var v Version
+	if id < 0 {
+		return badVersion, fmt.Errorf("%w: id %d", ErrBadVersionID, id)
+	}
+	if len(checksum) != len(v.Checksum) {
+		return badVersion, fmt.Errorf("%w: invalid length", ErrBadVersionChecksum)
+	}
+	copy(v.Checksum[:], checksum)
+	v.ID = id
+	return v, nil
+}
+
+// CheckFrom returns nil when the database version dbv is info.From(). When only the
+// checksums differ, the returned error wraps ErrBadVersionChecksum as the migration
+// steps don't match the ones applied to the database. Otherwise it wraps ErrBadVersion
+// as another process may have changed the database version.
+func CheckFrom(dbv Version, info StepInfo) error {
+	from := info.From()
+	switch {
+	case dbv == from:
+		return nil
+	case dbv.ID == from.ID:
+		return fmt.Errorf("%w: db is %v, step expects %v", ErrBadVersionChecksum, dbv, from)
+	default:
+		return fmt.Errorf("%w: db is %v", ErrBadVersion, dbv)
+	}
+}
@@ -1,6 +1,7 @@
 package migrate
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 )
@@ -66,3 +67,60 @@ func TestVersion(t *testing.T) {
 		t.Fatalf("expect %v, got %v", badVersion, out)
 	}
 }
+
+func TestCheckFrom(t *testing.T) {
+	info := &stepInfo{name: "step", from: Version{ID: 1, Checksum: [32]byte{1}}, to: Version{ID: 2}}
+	if err := CheckFrom(Version{ID: 1, Checksum: [32]byte{1}}, info); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckFrom(Version{ID: 1, Checksum: [32]byte{2}}, info); !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionChecksum, err)
+	}
+	if err := CheckFrom(Version{ID: 2}, info); err == nil || errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect version error, got %v", err)
+	}
+}
+
+func TestMakeVersionBytes(t *testing.T) {
+	in := Version{ID: 3, Checksum: [32]byte{1, 2, 3}}
+	out, err := MakeVersionBytes(in.ID, in.Checksum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Fatalf("expect %v, got %v", in, out)
+	}
+	if _, err := MakeVersionBytes(3, in.Checksum[:31]); !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionChecksum, err)
+	}
+	if _, err := MakeVersionBytes(-1, in.Checksum[:]); !errors.Is(err, ErrBadVersionID) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionID, err)
+	}
+}
+
+func TestVersionJSON(t *testing.T) {
+	in := Version{ID: 3, Checksum: [32]byte{1, 2, 3}}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `{"id":3,"checksum":"` + in.ChecksumString() + `"}`; string(b) != exp {
+		t.Fatalf("expect %s, got %s", exp, b)
+	}
+	var out Version
+	if err := json.Unmarshal(b, &out); err != nil || out != in {
+		t.Fatalf("expect %v, got %v %v", in, out, err)
+	}
+	if err := json.Unmarshal([]byte(`{"id":-1,"checksum":"`+in.ChecksumString()+`"}`), &out); !errors.Is(err, ErrBadVersionID) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionID, err)
+	}
+	if err := json.Unmarshal([]byte(`{"id":3,"checksum":"0102"}`), &out); !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionChecksum, err)
+	}
+	if err := json.Unmarshal([]byte(`{"id":3,"checksum":"xyz"}`), &out); !errors.Is(err, ErrBadVersionChecksum) {
+		t.Fatalf("expect %v, got %v", ErrBadVersionChecksum, err)
+	}
+	if out != in {
+		t.Fatalf("expect unchanged %v, got %v", in, out)
+	}
+}
@@ -49,6 +49,18 @@ func (a *zapAdapter) SetLevel(lvl migrate.LogLevel) {
 	a.mu.Unlock()
 }
 
+// With returns a child logger adding the fields to all its messages.
+func (a *zapAdapter) With(fields ...migrate.Field) migrate.Logger {
+	zapFields := make([]zap.Field, 0, len(fields))
+	for _, f := range fields {
+		zapFields = append(zapFields, zap.Any(f.Key, f.Render()))
+	}
+	return &zapAdapter{
+		logger: a.logger.With(zapFields...),
+		level:  a.Level(),
+	}
+}
+
 // Error logs an error level message.
 func (a *zapAdapter) Error(msg string, fields ...migrate.Field) {
 	a.mu.RLock()
@@ -59,7 +71,7 @@ func (a *zapAdapter) Error(msg string, fields ...migrate.Field) {
 	}
 	zapFields := make([]zap.Field, 0, len(fields))
 	for _, f := range fields {
-		zapFields = append(zapFields, zap.Any(f.Key, f.Value))
+		zapFields = append(zapFields, zap.Any(f.Key, f.Render()))
 	}
 	a.logger.Error(msg, zapFields...)
 }
@@ -74,7 +86,7 @@ func (a *zapAdapter) Warn(msg string, fields ...migrate.Field) {
 	}
 	zapFields := make([]zap.Field, 0, len(fields))
 	for _, f := range fields {
-		zapFields = append(zapFields, zap.Any(f.Key, f.Value))
+		zapFields = append(zapFields, zap.Any(f.Key, f.Render()))
 	}
 	a.logger.Warn(msg, zapFields...)
 }
@@ -89,7 +101,7 @@ func (a *zapAdapter) Info(msg string, fields ...migrate.Field) {
 	}
 	zapFields := make([]zap.Field, 0, len(fields))
 	for _, f := range fields {
-		zapFields = append(zapFields, zap.Any(f.Key, f.Value))
+		zapFields = append(zapFields, zap.Any(f.Key, f.Render()))
 	}
 	a.logger.Info(msg, zapFields...)
 }
@@ -104,7 +116,7 @@ func (a *zapAdapter) Debug(msg string, fields ...migrate.Field) {
 	}
 	zapFields := make([]zap.Field, 0, len(fields))
 	for _, f := range fields {
-		zapFields = append(zapFields, zap.Any(f.Key, f.Value))
+		zapFields = append(zapFields, zap.Any(f.Key, f.Render()))
 	}
 	a.logger.Debug(msg, zapFields...)
 }
@@ -295,3 +295,18 @@ func TestLogAllLevels(t *testing.T) {
 	adapter.Error("no show message")
 	assert.Equal(t, 4, logs.Len(), "Should have 4 log entries")
 }
+
+func TestZapAdapter_With(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := NewWith(zap.New(core), migrate.LevelInfo)
+	child := logger.With(migrate.F("step", "add_index"))
+	child.SetLevel(migrate.LevelDebug)
+	assert.Equal(t, migrate.LevelInfo, logger.Level(), "Parent level should be unchanged")
+
+	child.Debug("debug message", migrate.F("key", "value"))
+	logger.Debug("discarded")
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "add_index", fields["step"])
+	assert.Equal(t, "value", fields["key"])
+}
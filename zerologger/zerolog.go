@@ -39,6 +39,26 @@ func (a *zerologAdapter) SetLevel(lvl migrate.LogLevel) {
 	a.mu.Unlock()
 }
 
+// With returns a child logger adding the fields to all its messages.
+func (a *zerologAdapter) With(fields ...migrate.Field) migrate.Logger {
+	ctx := a.logger.With()
+	for _, f := range fields {
+		switch v := f.Render().(type) {
+		case string:
+			ctx = ctx.Str(f.Key, v)
+		case int:
+			ctx = ctx.Int(f.Key, v)
+		case float64:
+			ctx = ctx.Float64(f.Key, v)
+		case bool:
+			ctx = ctx.Bool(f.Key, v)
+		default:
+			ctx = ctx.Interface(f.Key, v)
+		}
+	}
+	return &zerologAdapter{logger: ctx.Logger(), level: a.Level()}
+}
+
 // Error logs an error level message.
 func (a *zerologAdapter) Error(msg string, fields ...migrate.Field) {
 	a.mu.RLock()
@@ -82,7 +102,7 @@ func (a *zerologAdapter) Debug(msg string, fields ...migrate.Field) {
 // Log logs the message and associated fields.
 func (a *zerologAdapter) log(event *zerolog.Event, msg string, fields ...migrate.Field) {
 	for _, f := range fields {
-		switch v := f.Value.(type) {
+		switch v := f.Render().(type) {
 		case string:
 			event = event.Str(f.Key, v)
 		case int:
@@ -245,6 +245,13 @@ func TestAllFieldTypes(t *testing.T) {
 	assert.Equal(t, 3.14, logMap["float"], "Float field should match")
 	assert.Equal(t, true, logMap["bool"], "Bool field should match")
 	assert.NotNil(t, logMap["complex"], "Complex field should exist")
+
+	// Stringer values are logged with their String method
+	buf.Reset()
+	adapter.Info("test stringer", migrate.F("cmd", migrate.SQLCommand{Cmd: "SELECT ?", Args: []any{1}}))
+	logMap = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logMap), "Should be able to unmarshal log JSON")
+	assert.Equal(t, "`SELECT ?` args:[1]", logMap["cmd"], "Stringer field should match")
 }
 
 func TestLogAllLevels(t *testing.T) {
@@ -349,3 +356,18 @@ func (w syncWriter) Write(p []byte) (n int, err error) {
 	defer w.mu.Unlock()
 	return w.Writer.Write(p)
 }
+
+func TestZerologAdapter_With(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewWith(zerolog.New(&buf), migrate.LevelInfo)
+	child := logger.With(migrate.F("step", "add_index"))
+	child.SetLevel(migrate.LevelDebug)
+	assert.Equal(t, migrate.LevelInfo, logger.Level(), "Parent level should be unchanged")
+
+	child.Debug("debug message", migrate.F("key", "value"))
+	logger.Debug("discarded")
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "add_index", entry["step"])
+	assert.Equal(t, "value", entry["key"])
+}